@@ -0,0 +1,95 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+
+	"github.com/google/docblog/pkg/ai"
+	"github.com/google/docblog/pkg/alttext"
+	"github.com/google/docblog/pkg/drive"
+	"github.com/google/docblog/pkg/manifest"
+)
+
+// addAltText sets the alt text of the assets referenced by images without one
+// in the document. The text is taken from the alt text file, or generated and
+// stored there if enabled. Failing to generate it is not fatal, the image
+// just stays without alt text. It returns the hashes of the images looked up
+// in the alt text file.
+func addAltText(
+	ctx context.Context,
+	logger *log.Logger,
+	htmlContent []byte,
+	unzippedFiles []*drive.UnzippedFile,
+	assets map[string]*drive.Asset,
+) ([]string, error) {
+	sources, err := drive.ImagesWithoutAltText(htmlContent)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse input HTML document: %v", err)
+	}
+
+	imageDescriber, _ := describer.(ai.ImageDescriber)
+	var hashes []string
+	for _, unzippedFile := range unzippedFiles {
+		asset, ok := assets[unzippedFile.Name]
+		if !ok || !slices.Contains(sources, unzippedFile.Name) {
+			continue
+		}
+
+		// The hash of the exported image, rather than the name, identifies it
+		// as the names are only numbered within the document.
+		hash := manifest.Hash(unzippedFile.Content)
+		hashes = append(hashes, hash)
+		if entry, ok := altTexts.Get(hash); ok {
+			asset.Alt = entry.Text
+			continue
+		}
+		if !args.GenerateAltText || imageDescriber == nil {
+			continue
+		}
+
+		logger.Printf("Generating alt text of %s\n", unzippedFile.Name)
+		text, err := imageDescriber.DescribeImage(ctx,
+			drive.DetectImageType(unzippedFile.Content), unzippedFile.Content)
+		if err != nil {
+			logger.Printf("Error generating alt text: %v\n", err)
+			continue
+		}
+		asset.Alt = text
+		altTexts.Set(hash, &alttext.Entry{Text: text, Url: asset.Url})
+	}
+	return hashes, nil
+}
+
+// hashAltText returns the hash of the alt text of the images with the
+// provided hashes, so that editing the alt text file updates the posts that
+// use it. It's empty without images.
+func hashAltText(images []string) string {
+	if len(images) == 0 {
+		return ""
+	}
+	texts := make([]string, len(images))
+	for i, image := range images {
+		if entry, ok := altTexts.Get(image); ok {
+			texts[i] = entry.Text
+		}
+	}
+	content, _ := json.Marshal(texts)
+	return manifest.Hash(content)
+}
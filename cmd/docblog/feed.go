@@ -0,0 +1,160 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/google/docblog/pkg/drive"
+	"github.com/google/docblog/pkg/feed"
+)
+
+// writeFeeds writes the Atom and RSS feeds of the latest listed posts.
+func writeFeeds(filesMetadata []*drive.GoogleDocMetadata) error {
+	var listed []*drive.GoogleDocMetadata
+	for _, metadata := range filesMetadata {
+		if metadata.IsListed() {
+			listed = append(listed, metadata)
+		}
+	}
+	slices.SortStableFunc(listed, func(a, b *drive.GoogleDocMetadata) int {
+		return b.CreatedTime.Compare(a.CreatedTime)
+	})
+	if args.FeedLimit > 0 && len(listed) > args.FeedLimit {
+		listed = listed[:args.FeedLimit]
+	}
+
+	f := &feed.Feed{
+		Title:   args.FeedTitle,
+		Author:  args.FeedAuthor,
+		SiteUrl: args.SiteUrl,
+	}
+	if f.Title == "" {
+		u, err := url.Parse(args.SiteUrl)
+		if err != nil {
+			return fmt.Errorf("invalid site URL: %v", err)
+		}
+		f.Title = u.Host
+	}
+	if f.Author == "" {
+		f.Author = f.Title
+	}
+	for _, metadata := range listed {
+		entry, err := feedEntry(metadata)
+		if err != nil {
+			return err
+		}
+		f.Entries = append(f.Entries, entry)
+	}
+
+	atom, err := f.Atom()
+	if err != nil {
+		return fmt.Errorf("failed to generate Atom feed: %v", err)
+	}
+	atomPath := filepath.Join(args.FeedOutputPath, feed.AtomFileName)
+	if err := output.WriteFile(atomPath, atom); err != nil {
+		return fmt.Errorf("failed to write Atom feed: %v", err)
+	}
+
+	rss, err := f.Rss()
+	if err != nil {
+		return fmt.Errorf("failed to generate RSS feed: %v", err)
+	}
+	rssPath := filepath.Join(args.FeedOutputPath, feed.RssFileName)
+	if err := output.WriteFile(rssPath, rss); err != nil {
+		return fmt.Errorf("failed to write RSS feed: %v", err)
+	}
+	return nil
+}
+
+func feedEntry(metadata *drive.GoogleDocMetadata) (*feed.Entry, error) {
+	id, err := feedId(metadata)
+	if err != nil {
+		return nil, err
+	}
+	postUrl, err := postUrl(metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &feed.Entry{
+		Id:        id,
+		Title:     metadata.Name,
+		Url:       postUrl,
+		Published: metadata.CreatedTime,
+		Updated:   metadata.ModifiedTime,
+		Summary:   metadata.Description,
+	}
+	// Local sources may not know the modification time.
+	if entry.Updated.IsZero() {
+		entry.Updated = metadata.CreatedTime
+	}
+	for _, term := range append(metadata.AllCategories(), metadata.Tags...) {
+		if !slices.Contains(entry.Categories, term) {
+			entry.Categories = append(entry.Categories, term)
+		}
+	}
+
+	if args.FeedContent == feed.FullContent {
+		// The post may not be written, e.g. if it failed to be processed.
+		post, err := os.ReadFile(postOutputPath(metadata))
+		if err != nil {
+			log.Printf("Missing content of %s in the feeds: %v\n", metadata.Name, err)
+			return entry, nil
+		}
+		_, content, err := drive.UnmarshalFrontmatter(post)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read post of %s: %v", metadata.Name, err)
+		}
+		if entry.Content, err = drive.BodyContent(content, postUrl); err != nil {
+			return nil, fmt.Errorf("failed to read post of %s: %v", metadata.Name, err)
+		}
+	}
+	return entry, nil
+}
+
+// feedId returns the ID of the post in the feeds. The ID assigned when the
+// post was first included in the feeds is kept in the manifest, as the date
+// of the post it's based on may be edited in the index sheet.
+func feedId(metadata *drive.GoogleDocMetadata) (string, error) {
+	entry, ok := state.Get(metadata.Id)
+	if ok && entry.FeedId != "" {
+		return entry.FeedId, nil
+	}
+	id, err := feed.TagUri(args.SiteUrl, metadata.CreatedTime, metadata.Id)
+	if err != nil {
+		return "", err
+	}
+	if ok {
+		updated := *entry
+		updated.FeedId = id
+		state.Set(metadata.Id, &updated)
+	}
+	return id, nil
+}
+
+// postUrl returns the absolute URL of the post.
+func postUrl(metadata *drive.GoogleDocMetadata) (string, error) {
+	u, err := url.Parse(args.SiteUrl)
+	if err != nil {
+		return "", fmt.Errorf("invalid site URL: %v", err)
+	}
+	return u.JoinPath(metadata.Permalink(profile.Permalink)).String(), nil
+}
@@ -16,54 +16,263 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
+	"strings"
 
 	"github.com/alexflint/go-arg"
 	"github.com/google/docblog/pkg/ai"
+	"github.com/google/docblog/pkg/alttext"
 	"github.com/google/docblog/pkg/drive"
+	"github.com/google/docblog/pkg/feed"
+	"github.com/google/docblog/pkg/imaging"
+	"github.com/google/docblog/pkg/manifest"
+	"github.com/google/docblog/pkg/retry"
+	"github.com/google/docblog/pkg/sitemap"
+	"golang.org/x/sync/errgroup"
 	"google.golang.org/api/option"
 )
 
 var args struct {
-	ai.GeminiOptions
+	ai.Options
+	feed.FeedOptions
+	drive.ListOptions
+	drive.LimitOptions
+	imaging.ImageOptions
+	retry.Policy
+	sitemap.SitemapOptions
 
-	DriveDirId string `arg:"positional,required" help:"Google Drive directory with blog posts." placeholder:"DRIVE-DIR-ID"`
+	DriveDirId string `arg:"positional" help:"Google Drive directory with blog posts, not needed with --source-dir." placeholder:"DRIVE-DIR-ID"`
 
+	AltTextPath               string `arg:"--alt-text,env:DOCBLOG_ALT_TEXT" default:".docblog/alt-text.yaml" help:"file with the alt text of the images, edit it to override the generated one"`
+	ArchiveOutputPath         string `arg:"--archive-output,env:DOCBLOG_ARCHIVE_OUTPUT" help:"directory to archive the exported documents to, usable with --source-dir"`
 	AssetsOutputPath          string `arg:"--assets-output,env:DOCBLOG_ASSETS_OUTPUT" default:"assets" help:"asset output path"`
 	AssetsPathPrefix          string `arg:"--assets-prefix,env:DOCBLOG_ASSETS_PREFIX" help:"asset path prefix (html)"`
 	GcloudCredentialsFilePath string `arg:"--credentials,env:DOCBLOG_GCLOUD_CREDENTIALS" default:".gcloud/application_default_credentials.json" help:"file with Google Cloud credentials"`
+	Layout                    string `arg:"--layout,env:DOCBLOG_LAYOUT" help:"post layout, defaults to the one of the target"`
+	ManifestPath              string `arg:"--manifest,env:DOCBLOG_MANIFEST" default:".docblog/manifest.json" help:"file with the state of previous runs"`
+	MirrorFolders             bool   `arg:"--mirror-folders,env:DOCBLOG_MIRROR_FOLDERS" help:"mirror the Google Drive subdirectories in the posts output"`
+	Parallelism               int    `arg:"--parallelism,env:DOCBLOG_PARALLELISM" default:"4" help:"number of documents processed concurrently"`
+	OutputFormat              string `arg:"--format,env:DOCBLOG_FORMAT" default:"html" help:"post output format: html or markdown"`
+	Permalink                 string `arg:"--permalink,env:DOCBLOG_PERMALINK" help:"URL pattern of the posts, e.g. /:year/:month/:day/:slug/, defaults to the one of the target"`
 	PostsOutputPath           string `arg:"--posts-output,env:DOCBLOG_POSTS_OUTPUT" default:"posts" help:"HTML output path"`
+	SiteUrl                   string `arg:"--site-url,env:DOCBLOG_SITE_URL" help:"absolute URL of the site, e.g. https://example.com"`
+	SourceDir                 string `arg:"--source-dir,env:DOCBLOG_SOURCE_DIR" help:"directory with documents exported earlier to read instead of Google Drive"`
+	RedirectsOutputPath       string `arg:"--redirects-output,env:DOCBLOG_REDIRECTS_OUTPUT" help:"site root to write redirect pages from previous post URLs to"`
+	Target                    string `arg:"--target,env:DOCBLOG_TARGET" default:"jekyll" help:"static site generator: jekyll, hugo, zola or eleventy"`
+
+	DryRun      bool `arg:"--dry-run,env:DOCBLOG_DRY_RUN" help:"print the changes with diffs instead of writing them, the index sheet and the manifest are not updated either"`
+	Force       bool `arg:"--force,env:DOCBLOG_FORCE" help:"process all documents, even if they didn't change since the last run"`
+	Prune       bool `arg:"--prune,env:DOCBLOG_PRUNE" help:"remove outputs of documents that are no longer published"`
+	PruneDryRun bool `arg:"--prune-dry-run,env:DOCBLOG_PRUNE_DRY_RUN" help:"list outputs that --prune would remove without removing them"`
 }
 
+var (
+	// profile describes the conventions of the targeted static site generator.
+	profile *drive.GeneratorProfile
+	// state is the manifest of documents processed by previous runs.
+	state *manifest.Manifest
+	// altTexts contains the alt text of the images, by their hash.
+	altTexts *alttext.File
+	// describer generates the missing descriptions, nil if disabled.
+	describer ai.Describer
+	// tagVocabulary contains the tags used across the index sheet, the
+	// suggested tags are chosen from them.
+	tagVocabulary []string
+	// optionsHash is the hash of the options affecting the outputs, see
+	// hashOptions.
+	optionsHash string
+)
+
 func main() {
-	arg.MustParse(&args)
+	ctx := context.Background()
+
+	// Subcommands are dispatched by hand, go-arg would take DRIVE-DIR-ID for
+	// an unknown subcommand.
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case watchCommand:
+			runSubcommand(ctx, watchCommand, &watchArgs, watch)
+			return
+		case webhookCommand:
+			runSubcommand(ctx, webhookCommand, &webhookArgs, serveWebhook)
+			return
+		case serveCommand:
+			runSubcommand(ctx, serveCommand, &serveArgs, servePreview)
+			return
+		}
+	}
+
+	p := arg.MustParse(&args)
+	source, index := setup(ctx, p)
+	failures, err := syncDocuments(ctx, source, index, nil)
+	if err != nil {
+		panic(err)
+	}
+	if len(failures) > 0 {
+		os.Exit(1)
+	}
+}
 
-	if err := os.MkdirAll(args.PostsOutputPath, 0o750); err != nil {
+// runSubcommand parses the arguments of a subcommand, along with the global
+// ones, and runs it.
+func runSubcommand(
+	ctx context.Context,
+	name string,
+	subcommandArgs any,
+	run func(context.Context, drive.Source, drive.IndexStore) error,
+) {
+	p, err := arg.NewParser(arg.Config{Program: "docblog " + name}, &args, subcommandArgs)
+	if err != nil {
 		panic(err)
 	}
-	if err := os.MkdirAll(args.AssetsOutputPath, 0o750); err != nil {
+	p.MustParse(os.Args[2:])
+	// Only the preview works with the exports of the local source.
+	if args.SourceDir != "" && name != serveCommand {
+		p.Fail("--source-dir can't be watched for changes")
+	}
+	source, index := setup(ctx, p)
+	if err := run(ctx, source, index); err != nil {
 		panic(err)
 	}
+}
+
+// setup validates the parsed arguments, initializes the global state and
+// returns the source of the documents.
+func setup(ctx context.Context, p *arg.Parser) (drive.Source, drive.IndexStore) {
+	configure(p)
+
+	if args.SourceDir != "" {
+		localSource, err := drive.NewLocalSource(args.SourceDir)
+		if err != nil {
+			panic(err)
+		}
+		return localSource, localSource
+	}
 
-	ctx := context.Background()
 	srv, err := drive.NewDriveService(ctx, []option.ClientOption{
 		option.WithCredentialsFile(args.GcloudCredentialsFilePath),
-	})
+	}, args.LimitOptions, args.Policy)
 	if err != nil {
 		panic(err)
 	}
+	return srv, srv
+}
 
-	indexSheet, err := srv.GetIndexSheet(args.DriveDirId)
-	if err != nil {
+// configure validates the parsed arguments and initializes the global state.
+func configure(p *arg.Parser) {
+	if args.DriveDirId == "" && args.SourceDir == "" {
+		p.Fail("either DRIVE-DIR-ID or --source-dir is required")
+	}
+	if args.OutputFormat != drive.HtmlFormat &&
+		args.OutputFormat != drive.MarkdownFormat {
+		p.Fail(fmt.Sprintf("unsupported output format: %s", args.OutputFormat))
+	}
+	if err := args.Policy.Validate(); err != nil {
+		p.Fail(err.Error())
+	}
+	for _, width := range args.ImageWidths {
+		if width <= 0 {
+			p.Fail(fmt.Sprintf("--image-widths must be positive: %d", width))
+		}
+	}
+	if args.ImageQuality < 1 || args.ImageQuality > 100 {
+		p.Fail(fmt.Sprintf("--image-quality must be between 1 and 100: %d", args.ImageQuality))
+	}
+	targetProfile, ok := drive.GeneratorProfiles[args.Target]
+	if !ok {
+		p.Fail(fmt.Sprintf("unsupported target: %s", args.Target))
+	}
+	profile = targetProfile.With(args.Layout, args.Permalink)
+	if args.SiteUrl != "" {
+		if u, err := url.Parse(args.SiteUrl); err != nil || u.Scheme == "" || u.Host == "" {
+			p.Fail(fmt.Sprintf("--site-url must be an absolute URL: %s", args.SiteUrl))
+		}
+	}
+	if args.FeedOutputPath != "" {
+		if args.SiteUrl == "" {
+			p.Fail("--feed-output requires --site-url")
+		}
+		if args.FeedContent != feed.ExcerptContent && args.FeedContent != feed.FullContent {
+			p.Fail(fmt.Sprintf("unsupported feed content: %s", args.FeedContent))
+		}
+		// Feed readers expect HTML.
+		if args.FeedContent == feed.FullContent && args.OutputFormat != drive.HtmlFormat {
+			p.Fail("--feed-content full requires --format html")
+		}
+	}
+	if args.SitemapOutputPath != "" && args.SiteUrl == "" {
+		p.Fail("--sitemap-output requires --site-url")
+	}
+	if args.Robots && args.SitemapOutputPath == "" {
+		p.Fail("--robots requires --sitemap-output")
+	}
+
+	if args.DryRun {
+		output = &dryRunWriter{w: os.Stdout}
+	} else {
+		if err := os.MkdirAll(args.PostsOutputPath, 0o750); err != nil {
+			panic(err)
+		}
+		if err := os.MkdirAll(args.AssetsOutputPath, 0o750); err != nil {
+			panic(err)
+		}
+	}
+
+	var err error
+	if optionsHash, err = hashOptions(); err != nil {
+		panic(err)
+	}
+	if state, err = manifest.Load(args.ManifestPath); err != nil {
 		panic(err)
 	}
+	if altTexts, err = alttext.Load(args.AltTextPath); err != nil {
+		panic(err)
+	}
+
+	// AI quotas are per minute, the limiter is shared by all workers.
+	args.Options.Limiter = drive.NewLimiter(args.AiRpm / 60)
+	args.Options.Retry = args.Policy
+	args.Options.ReadOnlyCache = args.DryRun
+	if describer, err = ai.NewDescriber(args.Options); err != nil {
+		p.Fail(err.Error())
+	}
+}
 
-	filesMetadata, err := srv.ListGoogleDocs(args.DriveDirId)
+// syncDocuments writes the posts of the documents from the source and updates
+// the index store. If docIds is not nil, only those documents are processed.
+// It returns the descriptions of documents that failed to be processed, errors
+// that affect all the documents are returned directly.
+func syncDocuments(
+	ctx context.Context,
+	source drive.Source,
+	index drive.IndexStore,
+	docIds []string,
+) ([]string, error) {
+	// The alt text file may have been edited since the previous pass.
+	if err := altTexts.Reload(); err != nil {
+		return nil, err
+	}
+
+	// Dry runs don't create the index sheet, a missing one is empty.
+	getIndexSheet := index.GetIndexSheet
+	if args.DryRun {
+		getIndexSheet = index.FindIndexSheet
+	}
+	indexSheet, err := getIndexSheet(args.DriveDirId)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+
+	filesMetadata, err := source.ListGoogleDocs(args.DriveDirId, args.ListOptions)
+	if err != nil {
+		return nil, err
 	}
 
 	for i, fileMetadata := range filesMetadata {
@@ -72,58 +281,377 @@ func main() {
 			filesMetadata[i].UpdateWith(metadata)
 		}
 	}
+	tagVocabulary = drive.AllTags(filesMetadata)
+
+	// Documents are processed concurrently. Errors are reported at the end,
+	// so that they don't get lost among the logs of other documents.
+	docErrors := make([]error, len(filesMetadata))
+	var g errgroup.Group
+	g.SetLimit(max(1, args.Parallelism))
+	for i, fileMetadata := range filesMetadata {
+		if docIds != nil && !slices.Contains(docIds, fileMetadata.Id) {
+			continue
+		}
+		g.Go(func() error {
+			logger := log.New(log.Writer(), fmt.Sprintf("[%s] ", fileMetadata.Name),
+				log.Flags()|log.Lmsgprefix)
+			logger.Printf("Found file: %s\n", fileMetadata.Id)
+
+			if err := processDocument(ctx, logger, source, fileMetadata); err != nil {
+				logger.Printf("Error processing file: %v\n", err)
+				docErrors[i] = err
+			}
+			return nil
+		})
+	}
+	_ = g.Wait()
 
-	for _, fileMetadata := range filesMetadata {
-		log.Printf("Found file: %s (%s)", fileMetadata.Name, fileMetadata.Id)
+	if args.Prune || args.PruneDryRun {
+		if err = prune(filesMetadata, args.PruneDryRun || args.DryRun); err != nil {
+			return nil, err
+		}
+	}
 
-		unzippedFiles, err := srv.ExportGoogleDocToZippedHtml(fileMetadata)
+	if args.FeedOutputPath != "" {
+		if err = writeFeeds(filesMetadata); err != nil {
+			return nil, err
+		}
+	}
+	if args.SitemapOutputPath != "" {
+		if err = writeSitemap(filesMetadata); err != nil {
+			return nil, err
+		}
+	}
+
+	if args.DryRun {
+		// Local sources have no "index" sheet.
+		if args.SourceDir == "" {
+			printIndexChanges(os.Stdout, indexSheet, filesMetadata)
+		}
+	} else if len(indexChanges(indexSheet, filesMetadata)) > 0 {
+		// Unchanged sheets are not written, so that the watch mode isn't
+		// triggered by its own writes.
+		if err = index.UpdateIndexMetadata(args.DriveDirId, filesMetadata); err != nil {
+			return nil, err
+		}
+	}
+
+	if !args.DryRun {
+
+		if args.ArchiveOutputPath != "" {
+			err = drive.WriteLocalMetadata(args.ArchiveOutputPath, filesMetadata)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if err = state.Save(); err != nil {
+			return nil, err
+		}
+		if err = altTexts.Save(); err != nil {
+			return nil, err
+		}
+	}
+
+	var failures []string
+	for i, err := range docErrors {
 		if err != nil {
-			log.Printf("Error exporting file: %s\n", fileMetadata.Name)
-			continue
+			failures = append(failures, fmt.Sprintf("%s (%s): %v",
+				filesMetadata[i].Name, filesMetadata[i].Id, err))
+		}
+	}
+	if len(failures) > 0 {
+		log.Printf("Failed to process %d of %d documents:\n",
+			len(failures), len(filesMetadata))
+		for _, failure := range failures {
+			log.Printf("  %s\n", failure)
 		}
+	}
+	return failures, nil
+}
 
-		for _, unzippedFile := range unzippedFiles {
-			switch filepath.Ext(unzippedFile.Name) {
-			case ".html":
-				log.Printf("Processing HTML document: %s\n", unzippedFile.Name)
-				outputPath := fmt.Sprintf(
-					"%s/%s", args.PostsOutputPath, fileMetadata.FileName())
-				err := processHtml(ctx, outputPath, fileMetadata, unzippedFile.Content)
-				if err != nil {
-					log.Printf("Error processing HTML file: %v\n", err)
-				}
-			case ".png":
-				log.Printf("Processing PNG asset: %s\n", unzippedFile.Name)
-				modifiedName := drive.NormalizedAssetPath(
-					args.AssetsPathPrefix, fileMetadata.Id, unzippedFile.Name)
-				outputPath := fmt.Sprintf("%s/%s", args.AssetsOutputPath, modifiedName)
-				if err := drive.WriteFile(outputPath, unzippedFile.Content); err != nil {
-					log.Printf("Error processing PNG file: %v\n", err)
+// processDocument exports the document and writes the post along with its
+// assets. Documents that didn't change since the previous run are skipped.
+func processDocument(
+	ctx context.Context,
+	logger *log.Logger,
+	source drive.Source,
+	fileMetadata *drive.GoogleDocMetadata,
+) error {
+	if fileMetadata.Status == drive.StatusDraft {
+		logger.Printf("Skipping draft: %s\n", fileMetadata.Name)
+		return removeOutputs(logger, fileMetadata.Id)
+	}
+
+	// Posts keep their slug, so a different one means it was modified in the
+	// index sheet. The previous URL should keep working.
+	prev, ok := state.Get(fileMetadata.Id)
+	if ok && prev.Slug != "" && prev.Slug != fileMetadata.Slug {
+		logger.Printf("Slug of %s changed from %s to %s\n",
+			fileMetadata.Name, prev.Slug, fileMetadata.Slug)
+		fileMetadata.AddRedirectFrom(prev.Slug)
+	}
+
+	metadataHash, err := hashMetadata(fileMetadata)
+	if err != nil {
+		return err
+	}
+
+	// The alt text file may have been edited since, the images looked up in
+	// it are the same unless the content changed.
+	var altTextHash string
+	if ok {
+		altTextHash = hashAltText(prev.AltTextImages)
+	}
+
+	postPath := postOutputPath(fileMetadata)
+	if !args.Force && isArchived(fileMetadata.Id) && state.IsUpToDate(fileMetadata.Id,
+		fileMetadata.ModifiedTime, metadataHash, optionsHash, altTextHash, postPath) {
+		logger.Printf("Skipping unchanged file: %s\n", fileMetadata.Name)
+		return nil
+	}
+
+	zipContent, err := source.ExportGoogleDocToZip(fileMetadata)
+	if err != nil {
+		return fmt.Errorf("failed to export file: %v", err)
+	}
+	if args.ArchiveOutputPath != "" && !args.DryRun {
+		archivePath := drive.LocalArchivePath(args.ArchiveOutputPath, fileMetadata.Id)
+		if err := drive.WriteFile(archivePath, zipContent); err != nil {
+			return fmt.Errorf("failed to archive file: %v", err)
+		}
+	}
+
+	unzippedFiles, err := drive.Unzip(zipContent)
+	if err != nil {
+		return fmt.Errorf("failed to unzip file: %v", err)
+	}
+
+	entry := &manifest.Entry{
+		ModifiedTime: fileMetadata.ModifiedTime,
+		OptionsHash:  optionsHash,
+		Slug:         fileMetadata.Slug,
+	}
+	if ok {
+		entry.FeedId = prev.FeedId
+	}
+	for _, unzippedFile := range unzippedFiles {
+		if filepath.Ext(unzippedFile.Name) == ".html" {
+			entry.ContentHash = manifest.Hash(unzippedFile.Content)
+		}
+	}
+
+	// Drive bumps the modification time on changes that don't affect the
+	// exported content, e.g. new comments.
+	if prev, ok := state.Get(fileMetadata.Id); !args.Force && ok &&
+		prev.ContentHash == entry.ContentHash &&
+		state.IsUpToDate(fileMetadata.Id, prev.ModifiedTime,
+			metadataHash, optionsHash, altTextHash, postPath) {
+		logger.Printf("Skipping file with unchanged content: %s\n", fileMetadata.Name)
+		unchanged := *prev
+		unchanged.ModifiedTime = fileMetadata.ModifiedTime
+		state.Set(fileMetadata.Id, &unchanged)
+		return nil
+	}
+
+	if err := writePost(ctx, logger, entry, postPath, fileMetadata, unzippedFiles); err != nil {
+		return err
+	}
+	entry.Post = postPath
+
+	if args.RedirectsOutputPath != "" {
+		if entry.Redirects, err = writeRedirects(logger, fileMetadata); err != nil {
+			return err
+		}
+	}
+
+	// The description may have been generated while processing the document,
+	// it will be stored in the index sheet from now on.
+	if entry.MetadataHash, err = hashMetadata(fileMetadata); err != nil {
+		return err
+	}
+
+	// Outputs may have moved, e.g. after the slug or the date was changed.
+	if ok {
+		for _, outputPath := range prev.Outputs() {
+			if !slices.Contains(entry.Outputs(), outputPath) {
+				logger.Printf("Removing stale file: %s\n", outputPath)
+				if err := removeOutput(outputPath); err != nil {
+					return err
 				}
-			default:
-				log.Printf("Skipping unsupported file: %s\n", unzippedFile.Name)
 			}
 		}
 	}
+	state.Set(fileMetadata.Id, entry)
 
-	if err = srv.UpdateIndexMetadata(args.DriveDirId, filesMetadata); err != nil {
-		panic(err)
+	return nil
+}
+
+// writePost writes the post of the exported document along with its assets.
+// The paths of the written assets and the images looked up in the alt text
+// file are recorded in the entry.
+func writePost(
+	ctx context.Context,
+	logger *log.Logger,
+	entry *manifest.Entry,
+	postPath string,
+	fileMetadata *drive.GoogleDocMetadata,
+	unzippedFiles []*drive.UnzippedFile,
+) error {
+	// Assets are written first, so that the post only references the ones
+	// that are available.
+	assets := map[string]*drive.Asset{}
+	var htmlFile *drive.UnzippedFile
+	for _, unzippedFile := range unzippedFiles {
+		if filepath.Ext(unzippedFile.Name) == ".html" {
+			htmlFile = unzippedFile
+			continue
+		}
+
+		mimeType := drive.DetectImageType(unzippedFile.Content)
+		if mimeType == "" {
+			logger.Printf("Skipping unsupported file: %s\n", unzippedFile.Name)
+			continue
+		}
+
+		logger.Printf("Processing %s asset: %s\n", mimeType, unzippedFile.Name)
+		assetName := drive.ImageFileName(unzippedFile.Name, mimeType)
+		asset, paths, err := writeAsset(
+			postPath, fileMetadata.Id, assetName, mimeType, unzippedFile.Content)
+		if err != nil {
+			return err
+		}
+		entry.Assets = append(entry.Assets, paths...)
+
+		asset.Source = unzippedFile.Name
+		assets[unzippedFile.Name] = asset
+	}
+
+	if htmlFile == nil {
+		return fmt.Errorf("missing HTML document in the exported archive")
+	}
+	altTextImages, err := addAltText(ctx, logger, htmlFile.Content, unzippedFiles, assets)
+	if err != nil {
+		return err
+	}
+	entry.AltTextImages = altTextImages
+	entry.AltTextHash = hashAltText(altTextImages)
+
+	logger.Printf("Processing HTML document: %s\n", htmlFile.Name)
+	err = processHtml(ctx, logger, postPath, fileMetadata, htmlFile.Content, assets)
+	if err != nil {
+		return fmt.Errorf("failed to process HTML file: %v", err)
 	}
+	return nil
+}
+
+// writeAsset writes the asset of the document along with its optimized
+// variants, if enabled. It returns the paths of the written files.
+func writeAsset(
+	postPath string,
+	docId string,
+	assetName string,
+	mimeType string,
+	content []byte,
+) (*drive.Asset, []string, error) {
+	asset := &drive.Asset{
+		Url: profile.AssetUrl(args.AssetsPathPrefix, docId, assetName),
+	}
+
+	var variants []*imaging.Variant
+	if args.OptimizeImages {
+		image, err := imaging.Optimize(assetName, mimeType, content, args.ImageOptions)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to optimize asset: %v", err)
+		}
+		content = image.Content
+		variants = image.Variants
+		asset.Width, asset.Height = image.Width, image.Height
+	}
+
+	outputPath := assetOutputPath(postPath, docId, assetName)
+	if err := output.WriteFile(outputPath, content); err != nil {
+		return nil, nil, fmt.Errorf("failed to write asset: %v", err)
+	}
+	outputPaths := []string{outputPath}
+
+	var srcset, webpSrcset []string
+	if len(variants) > 0 {
+		srcset = append(srcset, fmt.Sprintf("%s %dw", asset.Url, asset.Width))
+	}
+	for _, variant := range variants {
+		outputPath := assetOutputPath(postPath, docId, variant.Name)
+		if err := output.WriteFile(outputPath, variant.Content); err != nil {
+			return nil, nil, fmt.Errorf("failed to write asset: %v", err)
+		}
+		outputPaths = append(outputPaths, outputPath)
+
+		url := profile.AssetUrl(args.AssetsPathPrefix, docId, variant.Name)
+		candidate := fmt.Sprintf("%s %dw", url, variant.Width)
+		if variant.MimeType == imaging.WebpMimeType {
+			webpSrcset = append(webpSrcset, candidate)
+		} else {
+			srcset = append(srcset, candidate)
+		}
+	}
+	asset.Srcset = strings.Join(srcset, ", ")
+	asset.WebpSrcset = strings.Join(webpSrcset, ", ")
+
+	return asset, outputPaths, nil
+}
+
+// writeRedirects writes pages redirecting from the previous URLs of the post
+// to the current one. It returns the paths of the written pages.
+func writeRedirects(
+	logger *log.Logger,
+	metadata *drive.GoogleDocMetadata,
+) ([]string, error) {
+	var outputPaths []string
+	for _, permalink := range metadata.RedirectPermalinks(profile.Permalink) {
+		outputPath := filepath.Join(args.RedirectsOutputPath, permalink)
+		if strings.HasSuffix(permalink, "/") || filepath.Ext(permalink) == "" {
+			outputPath = filepath.Join(outputPath, "index.html")
+		}
+
+		logger.Printf("Writing redirect from %s\n", permalink)
+		page := drive.RedirectPage(metadata.Permalink(profile.Permalink))
+		if err := output.WriteFile(outputPath, page); err != nil {
+			return outputPaths, fmt.Errorf("failed to write redirect: %v", err)
+		}
+		outputPaths = append(outputPaths, outputPath)
+	}
+	return outputPaths, nil
 }
 
 func processHtml(
 	ctx context.Context,
+	logger *log.Logger,
 	outputPath string,
 	metadata *drive.GoogleDocMetadata,
 	fileContent []byte,
+	assets map[string]*drive.Asset,
 ) error {
-	if metadata.Description == "" {
-		description, err := ai.DescribeContent(
-			ctx, args.GeminiOptions, string(fileContent))
+	// Most of the exported HTML is styling, the model only needs the text.
+	text, err := drive.PlainText(fileContent)
+	if err != nil {
+		return fmt.Errorf("failed to extract text: %v", err)
+	}
+	if metadata.Description == "" && describer != nil {
+		description, err := describer.Describe(ctx, text)
 		if err == nil {
 			metadata.Description = description
 		} else {
-			log.Printf("Error generating description: %v\n", err)
+			logger.Printf("Error generating description: %v\n", err)
+		}
+	}
+	if tagger, ok := describer.(ai.Tagger); ok && args.SuggestTags &&
+		len(metadata.Tags) == 0 && len(metadata.SuggestedTags) == 0 &&
+		len(tagVocabulary) > 0 {
+		tags, err := tagger.SuggestTags(ctx, text, tagVocabulary)
+		if err == nil {
+			metadata.SuggestedTags = tags
+		} else {
+			logger.Printf("Error suggesting tags: %v\n", err)
 		}
 	}
 
@@ -132,15 +660,86 @@ func processHtml(
 		return fmt.Errorf("failed to parse input HTML document: %v", err)
 	}
 
-	htmlDoc, err = htmlDoc.WithFixedContent(args.AssetsPathPrefix)
-	if err != nil {
-		return fmt.Errorf("failed to fix assets: %v", err)
+	if args.OutputFormat == drive.MarkdownFormat {
+		htmlDoc, err = htmlDoc.WithMarkdownContent(assets)
+		if err != nil {
+			return fmt.Errorf("failed to convert to Markdown: %v", err)
+		}
+	} else {
+		htmlDoc, err = htmlDoc.WithFixedContent(assets)
+		if err != nil {
+			return fmt.Errorf("failed to fix assets: %v", err)
+		}
 	}
 
-	htmlDoc, err = htmlDoc.WithFrontmatter()
+	htmlDoc, err = htmlDoc.WithFrontmatter(profile)
 	if err != nil {
 		return fmt.Errorf("failed to add frontmatter: %v", err)
 	}
 
-	return drive.WriteFile(outputPath, htmlDoc.Content)
+	return output.WriteFile(outputPath, htmlDoc.Content)
+}
+
+// postOutputPath returns the path the post of the document is written to.
+func postOutputPath(metadata *drive.GoogleDocMetadata) string {
+	postPath := profile.PostPath(metadata, args.OutputFormat)
+	if args.MirrorFolders && metadata.Folder != "" {
+		postPath = path.Join(metadata.Folder, postPath)
+	}
+	return fmt.Sprintf("%s/%s", args.PostsOutputPath, postPath)
+}
+
+// assetOutputPath returns the path the asset of the document is written to.
+// Page bundles keep the assets next to the post.
+func assetOutputPath(postPath string, docId string, assetRelativePath string) string {
+	if profile.PageBundle {
+		return filepath.Join(filepath.Dir(postPath), filepath.Base(assetRelativePath))
+	}
+
+	modifiedName := drive.NormalizedAssetPath(
+		args.AssetsPathPrefix, docId, assetRelativePath)
+	return fmt.Sprintf("%s/%s", args.AssetsOutputPath, modifiedName)
+}
+
+// isArchived reports whether the export of the document is archived, if
+// requested. Otherwise unchanged documents would be missing from the archive.
+func isArchived(docId string) bool {
+	if args.ArchiveOutputPath == "" || args.DryRun {
+		return true
+	}
+	_, err := os.Stat(drive.LocalArchivePath(args.ArchiveOutputPath, docId))
+	return err == nil
+}
+
+// hashMetadata returns a hash of the metadata that affects the output of the
+// document, i.e. everything that can be modified through the index sheet.
+func hashMetadata(metadata *drive.GoogleDocMetadata) (string, error) {
+	content, err := json.Marshal(metadata)
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize metadata: %v", err)
+	}
+	return manifest.Hash(content), nil
+}
+
+// hashOptions returns a hash of the options that affect the output of the
+// documents, so that changing them rewrites the existing posts.
+func hashOptions() (string, error) {
+	content, err := json.Marshal(struct {
+		Profile          *drive.GeneratorProfile
+		OutputFormat     string
+		AssetsOutputPath string
+		AssetsPathPrefix string
+		Images           imaging.ImageOptions
+	}{
+		// The profile includes the layout and the permalink pattern.
+		Profile:          profile,
+		OutputFormat:     args.OutputFormat,
+		AssetsOutputPath: args.AssetsOutputPath,
+		AssetsPathPrefix: args.AssetsPathPrefix,
+		Images:           args.ImageOptions,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize options: %v", err)
+	}
+	return manifest.Hash(content), nil
 }
@@ -0,0 +1,636 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexflint/go-arg"
+	"github.com/google/docblog/pkg/ai/aitest"
+	"github.com/google/docblog/pkg/drive"
+	"github.com/google/docblog/pkg/drive/drivetest"
+	"github.com/google/docblog/pkg/manifest"
+)
+
+// initialArgs are the arguments before parsing, so that each test starts from
+// the defaults.
+var initialArgs = args
+
+// configureTest parses the arguments and initializes the global state like
+// setup does. The outputs, the manifest and the alt text file are placed in a
+// temporary directory, which is returned.
+func configureTest(t *testing.T, driveDirId string, extraArgs ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	args = initialArgs
+	output = diskWriter{}
+
+	p, err := arg.NewParser(arg.Config{}, &args)
+	if err != nil {
+		t.Fatalf("NewParser() failed: %v", err)
+	}
+	err = p.Parse(append([]string{
+		driveDirId,
+		"--ai-backend", "none",
+		"--posts-output", filepath.Join(dir, "posts"),
+		"--assets-output", filepath.Join(dir, "assets"),
+		"--manifest", filepath.Join(dir, ".docblog/manifest.json"),
+		"--alt-text", filepath.Join(dir, ".docblog/alt-text.yaml"),
+		"--ai-cache", "",
+	}, extraArgs...))
+	if err != nil {
+		t.Fatalf("Parse() failed: %v", err)
+	}
+	configure(p)
+	return dir
+}
+
+// waitFor waits until the condition holds, failing the test after a while.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// readFile returns the content of the file, empty if it doesn't exist.
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatalf("ReadFile() failed: %v", err)
+	}
+	return string(content)
+}
+
+// pngHeader is enough for the content to be detected as a PNG image.
+var pngHeader = []byte("\x89PNG\r\n\x1a\nimage data")
+
+// indexRows returns the metadata stored in the rows of the index sheet of the
+// directory, after the header.
+func indexRows(t *testing.T, fake *drivetest.Fake, driveDirId string) []drive.GoogleDocMetadata {
+	t.Helper()
+	files, err := fake.ListFiles(context.Background(),
+		fmt.Sprintf(drive.GoogleSheetIndexListQuery, driveDirId), "files(id)", "")
+	if err != nil {
+		t.Fatalf("ListFiles() failed: %v", err)
+	}
+	if len(files.Files) != 1 {
+		t.Fatalf("got %d index sheets, want 1", len(files.Files))
+	}
+	spreadsheet, _ := fake.Spreadsheet(files.Files[0].Id)
+
+	rows := spreadsheet.Sheets[0].Data[0].RowData
+	if len(rows) == 0 || rows[0].Values[0].FormattedValue != "Id" {
+		t.Fatalf("index sheet has no header")
+	}
+	var result []drive.GoogleDocMetadata
+	for _, row := range rows[1:] {
+		var metadata drive.GoogleDocMetadata
+		if errs := metadata.ParseRowData(row); len(errs) > 0 {
+			t.Errorf("ParseRowData() failed: %v", errs)
+		}
+		result = append(result, metadata)
+	}
+	return result
+}
+
+func TestSyncDocuments(t *testing.T) {
+	fake := drivetest.NewFake()
+	dirId := fake.AddFolder("", "blog")
+	created := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	helloId := fake.AddDoc(dirId, "Hello", created, map[string][]byte{
+		"hello.html": []byte(`<html><body><p class="title">Hello</p>` +
+			`<p>First version</p><p><img src="images/image1.png"></p></body></html>`),
+		"images/image1.png": pngHeader,
+	})
+	otherId := fake.AddDoc(dirId, "Other", created.Add(24*time.Hour), map[string][]byte{
+		"other.html": []byte("<html><body><p>Other post</p></body></html>"),
+	})
+	dir := configureTest(t, dirId)
+	srv := drivetest.NewService(fake)
+	ctx := context.Background()
+
+	failures, err := syncDocuments(ctx, srv, srv, nil)
+	if err != nil || len(failures) > 0 {
+		t.Fatalf("syncDocuments() = %v, %v, want no failures", failures, err)
+	}
+
+	helloPath := filepath.Join(dir, "posts", "2024-05-01-Hello.html")
+	otherPath := filepath.Join(dir, "posts", "2024-05-02-Other.html")
+	assetPath := filepath.Join(dir, "assets", helloId+"-image1.png")
+
+	post := readFile(t, helloPath)
+	for _, want := range []string{
+		"---\n",
+		"title: Hello\n",
+		"google_doc_id: " + helloId + "\n",
+		"date: 2024-05-01T10:00:00Z\n",
+		"<p>First version</p>",
+		`src="/` + helloId + `-image1.png"`,
+	} {
+		if !strings.Contains(post, want) {
+			t.Errorf("post = %q, want it to contain %q", post, want)
+		}
+	}
+	if asset := readFile(t, assetPath); asset != string(pngHeader) {
+		t.Errorf("asset = %q, want the exported image", asset)
+	}
+	if !strings.Contains(readFile(t, otherPath), "Other post") {
+		t.Errorf("missing the other post")
+	}
+
+	saved, err := manifest.Load(args.ManifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, ok := saved.Get(helloId)
+	if !ok {
+		t.Fatalf("manifest has no entry of %s", helloId)
+	}
+	if entry.Post != helloPath || !slices.Equal(entry.Assets, []string{assetPath}) {
+		t.Errorf("entry = %+v, want the post %s and the asset %s", entry, helloPath, assetPath)
+	}
+	if !entry.ModifiedTime.Equal(created) || entry.Slug != "Hello" ||
+		entry.ContentHash == "" || entry.OptionsHash != optionsHash {
+		t.Errorf("entry = %+v, want the modification time, the slug and the hashes", entry)
+	}
+	if _, ok := saved.Get(otherId); !ok {
+		t.Errorf("manifest has no entry of %s", otherId)
+	}
+
+	rows := indexRows(t, fake, dirId)
+	if len(rows) != 2 {
+		t.Fatalf("index sheet has %d rows, want 2", len(rows))
+	}
+	// The sheet only keeps the day.
+	if rows[0].Id != helloId || rows[0].Name != "Hello" || rows[0].Slug != "Hello" ||
+		!rows[0].CreatedTime.Equal(created.Truncate(24*time.Hour)) {
+		t.Errorf("first row = %+v, want the metadata of %s", rows[0], helloId)
+	}
+	if rows[1].Id != otherId || rows[1].Slug != "Other" {
+		t.Errorf("second row = %+v, want the metadata of %s", rows[1], otherId)
+	}
+
+	// Unchanged documents are skipped on the next run, so their posts are not
+	// rewritten. The modified one is, and its removed image is deleted.
+	const marker = "not rewritten"
+	if err := os.WriteFile(otherPath, []byte(marker), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fake.UpdateDoc(helloId, created.Add(time.Hour), map[string][]byte{
+		"hello.html": []byte("<html><body><p>Second version</p></body></html>"),
+	})
+
+	failures, err = syncDocuments(ctx, srv, srv, nil)
+	if err != nil || len(failures) > 0 {
+		t.Fatalf("syncDocuments() = %v, %v, want no failures", failures, err)
+	}
+
+	if got := readFile(t, otherPath); got != marker {
+		t.Errorf("unchanged post = %q, want it skipped", got)
+	}
+	if post := readFile(t, helloPath); !strings.Contains(post, "Second version") ||
+		strings.Contains(post, "<img") {
+		t.Errorf("post = %q, want the second version", post)
+	}
+	if _, err := os.Stat(assetPath); !os.IsNotExist(err) {
+		t.Errorf("stale asset exists, want it removed: %v", err)
+	}
+
+	saved, err = manifest.Load(args.ManifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, _ = saved.Get(helloId)
+	if !entry.ModifiedTime.Equal(created.Add(time.Hour)) || len(entry.Assets) != 0 {
+		t.Errorf("entry = %+v, want the new modification time and no assets", entry)
+	}
+	if rows := indexRows(t, fake, dirId); len(rows) != 2 {
+		t.Errorf("index sheet has %d rows, want 2", len(rows))
+	}
+}
+
+func TestSyncDocumentsDryRun(t *testing.T) {
+	fake := drivetest.NewFake()
+	dirId := fake.AddFolder("", "blog")
+	created := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	fake.AddDoc(dirId, "Hello", created, map[string][]byte{
+		"hello.html": []byte("<html><body><p>Hello</p></body></html>"),
+	})
+	dir := configureTest(t, dirId, "--dry-run")
+	var b bytes.Buffer
+	output = &dryRunWriter{w: &b}
+	srv := drivetest.NewService(fake)
+
+	failures, err := syncDocuments(context.Background(), srv, srv, nil)
+	if err != nil || len(failures) > 0 {
+		t.Fatalf("syncDocuments() = %v, %v, want no failures", failures, err)
+	}
+
+	// The folder has no index sheet, which must not be created.
+	files, err := fake.ListFiles(context.Background(),
+		fmt.Sprintf(drive.GoogleSheetIndexListQuery, dirId), "files(id)", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files.Files) != 0 {
+		t.Errorf("got %d index sheets, want none", len(files.Files))
+	}
+	for _, path := range []string{"posts", "assets", ".docblog"} {
+		if _, err := os.Stat(filepath.Join(dir, path)); !os.IsNotExist(err) {
+			t.Errorf("%s exists, want nothing written: %v", path, err)
+		}
+	}
+	if want := "Would create " + filepath.Join(dir, "posts", "2024-05-01-Hello.html"); !strings.Contains(b.String(), want) {
+		t.Errorf("output = %q, want it to contain %q", b.String(), want)
+	}
+}
+
+func TestSyncDocumentsFolders(t *testing.T) {
+	fake := drivetest.NewFake()
+	dirId := fake.AddFolder("", "blog")
+	created := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	fake.AddDoc(dirId, "Top", created, map[string][]byte{
+		"top.html": []byte("<html><body><p>Top</p></body></html>"),
+	})
+	travelId := fake.AddFolder(dirId, "travel")
+	japanId := fake.AddFolder(travelId, "japan")
+	fake.AddDoc(japanId, "Tokyo", created, map[string][]byte{
+		"tokyo.html": []byte("<html><body><p>Tokyo</p></body></html>"),
+	})
+	draftsId := fake.AddFolder(travelId, "drafts")
+	fake.AddDoc(draftsId, "Unfinished", created, map[string][]byte{
+		"unfinished.html": []byte("<html><body><p>Unfinished</p></body></html>"),
+	})
+
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{
+			name: "top level only",
+			want: []string{"posts/2024-05-01-Top.html"},
+		},
+		{
+			name: "recursive",
+			args: []string{"--recursive", "--exclude-folder", "drafts"},
+			want: []string{"posts/2024-05-01-Tokyo.html", "posts/2024-05-01-Top.html"},
+		},
+		{
+			name: "mirrored folders",
+			args: []string{"--recursive", "--exclude-folder", "travel/drafts", "--mirror-folders"},
+			want: []string{"posts/2024-05-01-Top.html", "posts/travel/japan/2024-05-01-Tokyo.html"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := configureTest(t, dirId, tt.args...)
+			srv := drivetest.NewService(fake)
+
+			failures, err := syncDocuments(context.Background(), srv, srv, nil)
+			if err != nil || len(failures) > 0 {
+				t.Fatalf("syncDocuments() = %v, %v, want no failures", failures, err)
+			}
+
+			var got []string
+			err = filepath.WalkDir(filepath.Join(dir, "posts"), func(path string, d fs.DirEntry, err error) error {
+				if err == nil && !d.IsDir() {
+					rel, _ := filepath.Rel(dir, path)
+					got = append(got, filepath.ToSlash(rel))
+				}
+				return err
+			})
+			if err != nil {
+				t.Fatalf("WalkDir() failed: %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("posts = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSyncDocumentsSlugChanged(t *testing.T) {
+	fake := drivetest.NewFake()
+	dirId := fake.AddFolder("", "blog")
+	created := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	helloId := fake.AddDoc(dirId, "Hello", created, map[string][]byte{
+		"hello.html": []byte("<html><body><p>Hello</p></body></html>"),
+	})
+	dir := configureTest(t, dirId)
+	args.RedirectsOutputPath = filepath.Join(dir, "site")
+	srv := drivetest.NewService(fake)
+	ctx := context.Background()
+
+	failures, err := syncDocuments(ctx, srv, srv, nil)
+	if err != nil || len(failures) > 0 {
+		t.Fatalf("syncDocuments() = %v, %v, want no failures", failures, err)
+	}
+
+	// The slug is edited in the index sheet.
+	files, err := fake.ListFiles(ctx,
+		fmt.Sprintf(drive.GoogleSheetIndexListQuery, dirId), "files(id)", "")
+	if err != nil || len(files.Files) != 1 {
+		t.Fatalf("ListFiles() = %v, %v, want the index sheet", files, err)
+	}
+	spreadsheet, _ := fake.Spreadsheet(files.Files[0].Id)
+	rows := spreadsheet.Sheets[0].Data[0].RowData
+	for i, cell := range rows[0].Values {
+		if cell.FormattedValue == "Slug" {
+			rows[1].Values[i].FormattedValue = "hello-world"
+		}
+	}
+
+	failures, err = syncDocuments(ctx, srv, srv, nil)
+	if err != nil || len(failures) > 0 {
+		t.Fatalf("syncDocuments() = %v, %v, want no failures", failures, err)
+	}
+
+	oldPath := filepath.Join(dir, "posts", "2024-05-01-Hello.html")
+	newPath := filepath.Join(dir, "posts", "2024-05-01-hello-world.html")
+	if _, err := os.Stat(oldPath); !os.IsNotExist(err) {
+		t.Errorf("previous post exists, want it removed: %v", err)
+	}
+	if post := readFile(t, newPath); !strings.Contains(post, "redirect_from:\n  - /2024/05/01/Hello.html\n") ||
+		!strings.Contains(post, "<p>Hello</p>") {
+		t.Errorf("post = %q, want the content and the previous slug", post)
+	}
+
+	redirectPath := filepath.Join(dir, "site", "2024", "05", "01", "Hello.html")
+	want := string(drive.RedirectPage("/2024/05/01/hello-world.html"))
+	if got := readFile(t, redirectPath); got != want {
+		t.Errorf("redirect page = %q, want %q", got, want)
+	}
+
+	if rows := indexRows(t, fake, dirId); len(rows) != 1 || rows[0].Slug != "hello-world" ||
+		!slices.Equal(rows[0].RedirectFrom, []string{"Hello"}) {
+		t.Errorf("rows = %+v, want the new slug redirecting from the previous one", rows)
+	}
+	saved, err := manifest.Load(args.ManifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry, _ := saved.Get(helloId); entry.Post != newPath ||
+		!slices.Equal(entry.Redirects, []string{redirectPath}) {
+		t.Errorf("entry = %+v, want the new post and the redirect page", entry)
+	}
+}
+
+func TestSyncDocumentsLocalSource(t *testing.T) {
+	sourceDir := t.TempDir()
+	archives := map[string]map[string][]byte{
+		"doc1": {
+			"hello.html": []byte(`<html><body><p>Hello from the archive</p>` +
+				`<p><img src="images/image1.png"></p></body></html>`),
+			"images/image1.png": pngHeader,
+		},
+		"doc2": {
+			"trip.html": []byte("<html><body><p>Trip</p></body></html>"),
+		},
+		"doc3": {
+			"draft.html": []byte("<html><body><p>Draft</p></body></html>"),
+		},
+	}
+	for docId, files := range archives {
+		if err := os.WriteFile(drive.LocalArchivePath(sourceDir, docId), drivetest.Zip(files), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The modification time of the second document is the one of its archive.
+	metadata := `
+- google_doc_id: doc1
+  title: Hello
+  date: 2024-05-01T10:00:00Z
+  modified_time: 2024-05-02T10:00:00Z
+  tags: [go]
+- google_doc_id: doc2
+  title: Trip
+  date: 2024-05-03T10:00:00Z
+  folder: travel
+- google_doc_id: doc3
+  title: Draft
+  date: 2024-05-04T10:00:00Z
+  status: Draft
+`
+	if err := os.WriteFile(filepath.Join(sourceDir, "metadata.yaml"), []byte(metadata), 0644); err != nil {
+		t.Fatal(err)
+	}
+	archiveInfo, err := os.Stat(drive.LocalArchivePath(sourceDir, "doc2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := configureTest(t, "", "--source-dir", sourceDir, "--recursive")
+	source, err := drive.NewLocalSource(sourceDir)
+	if err != nil {
+		t.Fatalf("NewLocalSource() failed: %v", err)
+	}
+
+	failures, err := syncDocuments(context.Background(), source, source, nil)
+	if err != nil || len(failures) > 0 {
+		t.Fatalf("syncDocuments() = %v, %v, want no failures", failures, err)
+	}
+
+	helloPath := filepath.Join(dir, "posts", "2024-05-01-Hello.html")
+	post := readFile(t, helloPath)
+	for _, want := range []string{
+		"title: Hello\n",
+		"google_doc_id: doc1\n",
+		"tags:\n  - go\n",
+		"<p>Hello from the archive</p>",
+		`src="/doc1-image1.png"`,
+	} {
+		if !strings.Contains(post, want) {
+			t.Errorf("post = %q, want it to contain %q", post, want)
+		}
+	}
+	if asset := readFile(t, filepath.Join(dir, "assets", "doc1-image1.png")); asset != string(pngHeader) {
+		t.Errorf("asset = %q, want the archived image", asset)
+	}
+	if !strings.Contains(readFile(t, filepath.Join(dir, "posts", "2024-05-03-Trip.html")), "<p>Trip</p>") {
+		t.Errorf("missing the post of the subdirectory")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "posts", "2024-05-04-Draft.html")); !os.IsNotExist(err) {
+		t.Errorf("draft post exists, want it skipped: %v", err)
+	}
+
+	saved, err := manifest.Load(args.ManifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		docId    string
+		modified time.Time
+	}{
+		{"doc1", time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC)},
+		{"doc2", archiveInfo.ModTime()},
+	}
+	for _, tt := range tests {
+		entry, ok := saved.Get(tt.docId)
+		if !ok || !entry.ModifiedTime.Equal(tt.modified) {
+			t.Errorf("entry of %s = %+v, want the modification time %v", tt.docId, entry, tt.modified)
+		}
+	}
+
+	// The builds are reproducible, unchanged documents are skipped.
+	const marker = "not rewritten"
+	if err := os.WriteFile(helloPath, []byte(marker), 0644); err != nil {
+		t.Fatal(err)
+	}
+	failures, err = syncDocuments(context.Background(), source, source, nil)
+	if err != nil || len(failures) > 0 {
+		t.Fatalf("syncDocuments() = %v, %v, want no failures", failures, err)
+	}
+	if got := readFile(t, helloPath); got != marker {
+		t.Errorf("unchanged post = %q, want it skipped", got)
+	}
+	if got := readFile(t, filepath.Join(sourceDir, "metadata.yaml")); got != metadata {
+		t.Errorf("metadata file = %q, want it unchanged", got)
+	}
+}
+
+func TestSyncDocumentsAltTextEdited(t *testing.T) {
+	s := aitest.NewServer(aitest.StaticReply("A generated text"))
+	defer s.Close()
+	fake := drivetest.NewFake()
+	dirId := fake.AddFolder("", "blog")
+	created := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	fake.AddDoc(dirId, "Hello", created, map[string][]byte{
+		"hello.html":        []byte(`<html><body><p><img src="images/image1.png"></p></body></html>`),
+		"images/image1.png": pngHeader,
+	})
+	dir := configureTest(t, dirId, "--ai-backend", "openai", "--openai-base-url", s.BaseUrl(),
+		"--ai-rpm", "60000", "--generate-alt-text")
+	srv := drivetest.NewService(fake)
+	ctx := context.Background()
+
+	failures, err := syncDocuments(ctx, srv, srv, nil)
+	if err != nil || len(failures) > 0 {
+		t.Fatalf("syncDocuments() = %v, %v, want no failures", failures, err)
+	}
+	helloPath := filepath.Join(dir, "posts", "2024-05-01-Hello.html")
+	if post := readFile(t, helloPath); !strings.Contains(post, `alt="A generated text"`) {
+		t.Fatalf("post = %q, want the generated alt text", post)
+	}
+
+	// The author fixes the generated text while the process keeps running, as
+	// with watch, then another image is added.
+	content := readFile(t, args.AltTextPath)
+	edited := strings.Replace(content, "A generated text", "Edited by hand", 1)
+	if edited == content {
+		t.Fatalf("alt text file = %q, want the generated entry", content)
+	}
+	if err := os.WriteFile(args.AltTextPath, []byte(edited), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fake.AddDoc(dirId, "Other", created.Add(24*time.Hour), map[string][]byte{
+		"other.html":        []byte(`<html><body><p><img src="images/image1.png"></p></body></html>`),
+		"images/image1.png": []byte("\x89PNG\r\n\x1a\nother image"),
+	})
+
+	failures, err = syncDocuments(ctx, srv, srv, nil)
+	if err != nil || len(failures) > 0 {
+		t.Fatalf("syncDocuments() = %v, %v, want no failures", failures, err)
+	}
+	if post := readFile(t, helloPath); !strings.Contains(post, `alt="Edited by hand"`) {
+		t.Errorf("post = %q, want the edited alt text", post)
+	}
+	otherPath := filepath.Join(dir, "posts", "2024-05-02-Other.html")
+	if post := readFile(t, otherPath); !strings.Contains(post, `alt="A generated text"`) {
+		t.Errorf("post = %q, want the generated alt text", post)
+	}
+	saved := readFile(t, args.AltTextPath)
+	if !strings.HasPrefix(saved, edited) || strings.Count(saved, "text: A generated text") != 1 {
+		t.Errorf("alt text file =\n%s\nwant the edit kept and the new entry added", saved)
+	}
+}
+
+func TestWriteAssetSrcset(t *testing.T) {
+	var b bytes.Buffer
+	if err := png.Encode(&b, image.NewGray(image.Rect(0, 0, 500, 250))); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		target         string
+		wantSrcset     string
+		wantWebpSrcset string
+		wantPaths      []string
+	}{
+		{
+			target:         "jekyll",
+			wantSrcset:     "/doc1-image1.png 400w, /doc1-image1-100w.png 100w",
+			wantWebpSrcset: "/doc1-image1.webp 400w, /doc1-image1-100w.webp 100w",
+			wantPaths: []string{"assets/doc1-image1.png", "assets/doc1-image1-100w.png",
+				"assets/doc1-image1.webp", "assets/doc1-image1-100w.webp"},
+		},
+		{
+			// Page bundles reference the assets next to the post.
+			target:         "hugo",
+			wantSrcset:     "image1.png 400w, image1-100w.png 100w",
+			wantWebpSrcset: "image1.webp 400w, image1-100w.webp 100w",
+			wantPaths: []string{"posts/hello/image1.png", "posts/hello/image1-100w.png",
+				"posts/hello/image1.webp", "posts/hello/image1-100w.webp"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			dir := configureTest(t, "blog", "--target", tt.target, "--optimize-images",
+				"--image-widths", "100", "400", "--image-webp")
+			files := newMemoryWriter()
+			output = files
+
+			postPath := filepath.Join(dir, "posts", "hello", "index.html")
+			asset, paths, err := writeAsset(postPath, "doc1", "image1.png", "image/png", b.Bytes())
+			if err != nil {
+				t.Fatalf("writeAsset() failed: %v", err)
+			}
+			if asset.Width != 400 || asset.Height != 200 {
+				t.Errorf("dimensions = %dx%d, want 400x200", asset.Width, asset.Height)
+			}
+			if asset.Srcset != tt.wantSrcset {
+				t.Errorf("srcset = %q, want %q", asset.Srcset, tt.wantSrcset)
+			}
+			if asset.WebpSrcset != tt.wantWebpSrcset {
+				t.Errorf("WebP srcset = %q, want %q", asset.WebpSrcset, tt.wantWebpSrcset)
+			}
+			for i, path := range paths {
+				paths[i], _ = filepath.Rel(dir, path)
+				if _, ok := files.ReadFile(path); !ok {
+					t.Errorf("%s was not written", path)
+				}
+			}
+			if !slices.Equal(paths, tt.wantPaths) {
+				t.Errorf("paths = %v, want %v", paths, tt.wantPaths)
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/google/docblog/pkg/diff"
+	"github.com/google/docblog/pkg/drive"
+)
+
+// outputWriter writes and removes the generated files.
+type outputWriter interface {
+	WriteFile(outputPath string, content []byte) error
+	RemoveFile(outputPath string) error
+}
+
+// output receives all the generated files. In the dry run mode the changes are
+// only printed.
+var output outputWriter = diskWriter{}
+
+// diskWriter writes the generated files to disk.
+type diskWriter struct{}
+
+func (diskWriter) WriteFile(outputPath string, content []byte) error {
+	return drive.WriteFile(outputPath, content)
+}
+
+// RemoveFile deletes the file along with the parent directories that become
+// empty, e.g. page bundles. The output directories themselves are kept.
+func (diskWriter) RemoveFile(outputPath string) error {
+	if err := os.Remove(outputPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove %s: %v", outputPath, err)
+	}
+
+	roots := []string{
+		filepath.Clean(args.PostsOutputPath),
+		filepath.Clean(args.AssetsOutputPath),
+		filepath.Clean(args.RedirectsOutputPath),
+	}
+	for dir := filepath.Dir(outputPath); dir != "." && dir != "/" &&
+		!slices.Contains(roots, dir); dir = filepath.Dir(dir) {
+		// Removing a directory that is not empty fails.
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// dryRunWriter prints the changes to the existing files instead of making
+// them, along with unified diffs of the text files.
+type dryRunWriter struct {
+	w io.Writer
+	// mu keeps the output of concurrently processed documents apart.
+	mu sync.Mutex
+}
+
+func (dw *dryRunWriter) WriteFile(outputPath string, content []byte) error {
+	prev, err := os.ReadFile(outputPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	exists := err == nil
+	if exists && bytes.Equal(prev, content) {
+		return nil
+	}
+
+	dw.mu.Lock()
+	defer dw.mu.Unlock()
+
+	if !exists {
+		fmt.Fprintf(dw.w, "Would create %s\n", outputPath)
+		if isText(content) {
+			fmt.Fprint(dw.w, diff.Unified(
+				"/dev/null", outputPath, "", diffText(content)))
+		}
+		return nil
+	}
+
+	fmt.Fprintf(dw.w, "Would modify %s\n", outputPath)
+	if isText(prev) && isText(content) {
+		fmt.Fprint(dw.w, diff.Unified(outputPath, outputPath,
+			diffText(prev), diffText(content)))
+	} else {
+		fmt.Fprintf(dw.w, "Binary file changed from %d to %d bytes\n",
+			len(prev), len(content))
+	}
+	return nil
+}
+
+func (dw *dryRunWriter) RemoveFile(outputPath string) error {
+	if _, err := os.Stat(outputPath); os.IsNotExist(err) {
+		return nil
+	}
+
+	dw.mu.Lock()
+	defer dw.mu.Unlock()
+	fmt.Fprintf(dw.w, "Would remove %s\n", outputPath)
+	return nil
+}
+
+// memoryWriter keeps the generated files in memory, e.g. for the preview. It's
+// safe for concurrent use.
+type memoryWriter struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+func newMemoryWriter() *memoryWriter {
+	return &memoryWriter{files: map[string][]byte{}}
+}
+
+func (mw *memoryWriter) WriteFile(outputPath string, content []byte) error {
+	mw.mu.Lock()
+	defer mw.mu.Unlock()
+	mw.files[filepath.Clean(outputPath)] = content
+	return nil
+}
+
+func (mw *memoryWriter) RemoveFile(outputPath string) error {
+	mw.mu.Lock()
+	defer mw.mu.Unlock()
+	delete(mw.files, filepath.Clean(outputPath))
+	return nil
+}
+
+// ReadFile returns the content of the written file, if any.
+func (mw *memoryWriter) ReadFile(outputPath string) ([]byte, bool) {
+	mw.mu.Lock()
+	defer mw.mu.Unlock()
+	content, ok := mw.files[filepath.Clean(outputPath)]
+	return content, ok
+}
+
+// blockTagRegex matches the start of the tags of block elements that are not
+// already at the beginning of a line, along with the preceding character.
+var blockTagRegex = regexp.MustCompile(
+	`([^\n])(<(?:/?(?:html|head|body|ul|ol|table)|p|h[1-6]|li|div|tr|blockquote|pre|hr|figure)\b)`)
+
+// diffText returns the content as it's compared in the diffs. The HTML
+// documents written by docblog are on a single line, each block element is put
+// on its own line so that the changes of a paragraph don't show as a change of
+// the whole post. Posts may be HTML whatever their extension, e.g. for Zola.
+func diffText(content []byte) string {
+	if !bytes.Contains(content, []byte("<body")) {
+		return string(content)
+	}
+	return blockTagRegex.ReplaceAllString(string(content), "$1\n$2")
+}
+
+// isText reports whether the content looks like text rather than binary data,
+// e.g. an image.
+func isText(content []byte) bool {
+	return utf8.Valid(content) && !bytes.ContainsRune(content, 0)
+}
+
+// printIndexChanges prints the changes that updating the "index" sheet would
+// make to its rows.
+func printIndexChanges(
+	w io.Writer,
+	indexSheet map[string]drive.GoogleDocMetadata,
+	filesMetadata []*drive.GoogleDocMetadata,
+) {
+	for _, change := range indexChanges(indexSheet, filesMetadata) {
+		fmt.Fprintf(w, "Would %s\n", change)
+	}
+}
+
+// indexChanges describes the changes that updating the "index" sheet would
+// make to its rows, one per row.
+func indexChanges(
+	indexSheet map[string]drive.GoogleDocMetadata,
+	filesMetadata []*drive.GoogleDocMetadata,
+) []string {
+	var changes []string
+	listed := map[string]bool{}
+	for _, metadata := range filesMetadata {
+		listed[metadata.Id] = true
+
+		row, ok := indexSheet[metadata.Id]
+		if !ok {
+			changes = append(changes, fmt.Sprintf("add index row: %s (%s)",
+				metadata.Name, metadata.Id))
+			continue
+		}
+		if columns := metadata.ChangedColumns(&row); len(columns) > 0 {
+			changes = append(changes, fmt.Sprintf("update index row: %s (%s): %s",
+				metadata.Name, metadata.Id, strings.Join(columns, ", ")))
+		}
+	}
+
+	var removed []string
+	for docId, row := range indexSheet {
+		if !listed[docId] {
+			removed = append(removed, fmt.Sprintf("remove index row: %s (%s)",
+				row.Name, docId))
+		}
+	}
+	slices.Sort(removed)
+	return append(changes, removed...)
+}
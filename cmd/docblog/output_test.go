@@ -0,0 +1,100 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDryRunWriterHtmlDiff(t *testing.T) {
+	// The posts are written on a single line, as rendered by the HTML package.
+	const header = "---\ntitle: Hello\n---\n"
+	post := func(second string) string {
+		return header + `<html><head></head><body><h2 id="h.1">Intro</h2>` +
+			`<p>First paragraph</p><p>` + second + `</p>` +
+			`<ul><li>One</li><li>Two</li></ul><p>Last paragraph</p></body></html>`
+	}
+	postPath := filepath.Join(t.TempDir(), "2024-05-01-Hello.html")
+	if err := os.WriteFile(postPath, []byte(post("Second paragraph")), 0o640); err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	dw := &dryRunWriter{w: &b}
+	if err := dw.WriteFile(postPath, []byte(post("Second <b>edited</b> paragraph"))); err != nil {
+		t.Fatalf("WriteFile() failed: %v", err)
+	}
+
+	want := "Would modify " + postPath + "\n" +
+		"--- " + postPath + "\n" +
+		"+++ " + postPath + "\n" +
+		"@@ -7,7 +7,7 @@\n" +
+		" <body>\n" +
+		` <h2 id="h.1">Intro</h2>` + "\n" +
+		" <p>First paragraph</p>\n" +
+		"-<p>Second paragraph</p>\n" +
+		"+<p>Second <b>edited</b> paragraph</p>\n" +
+		" <ul>\n" +
+		" <li>One</li>\n" +
+		" <li>Two</li>\n"
+	if got := b.String(); got != want {
+		t.Errorf("output =\n%s\nwant:\n%s", got, want)
+	}
+
+	// The file itself is left as it was.
+	if got := readFile(t, postPath); got != post("Second paragraph") {
+		t.Errorf("post = %q, want it unchanged", got)
+	}
+}
+
+func TestDiffText(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "html",
+			content: "<html><head></head><body><p>A</p><hr/><pre>x</pre></body></html>",
+			want:    "<html>\n<head>\n</head>\n<body>\n<p>A</p>\n<hr/>\n<pre>x</pre>\n</body>\n</html>",
+		},
+		{
+			name:    "already broken",
+			content: "<html>\n<body>\n<p>A</p>\n</body>\n</html>\n",
+			want:    "<html>\n<body>\n<p>A</p>\n</body>\n</html>\n",
+		},
+		{
+			// Inline elements and tags with a similar name stay in place.
+			name:    "inline elements",
+			content: "<body><p>A <a href=\"/p\">link</a><param/><span>B</span></p></body>",
+			want:    "<body>\n<p>A <a href=\"/p\">link</a><param/><span>B</span></p>\n</body>",
+		},
+		{
+			name:    "markdown",
+			content: "# Title\n\nText with <p>inline HTML</p>.\n",
+			want:    "# Title\n\nText with <p>inline HTML</p>.\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := diffText([]byte(tt.content)); got != tt.want {
+				t.Errorf("diffText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
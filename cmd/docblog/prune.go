@@ -0,0 +1,215 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/google/docblog/pkg/drive"
+)
+
+// docIdRegex matches the document ID in both YAML and TOML frontmatter.
+var docIdRegex = regexp.MustCompile(`(?m)^\s*google_doc_id\s*[:=]\s*"?([\w-]+)"?\s*$`)
+
+// bundleAssetRegex matches the names of the images exported from Google Docs,
+// including their variants, see imaging.VariantName. Other files in page
+// bundles were not written by docblog.
+var bundleAssetRegex = regexp.MustCompile(`^image\d+(-\d+w)?\.\w+$`)
+
+// prune removes the files written for documents that are no longer published,
+// i.e. ones that were deleted, trashed or moved out of the Google Drive
+// directory. The files are only listed in the dry run mode.
+func prune(filesMetadata []*drive.GoogleDocMetadata, dryRun bool) error {
+	orphans, orphanedDocIds, err := findOrphans(filesMetadata)
+	if err != nil {
+		return err
+	}
+
+	for _, orphan := range orphans {
+		if dryRun {
+			log.Printf("Would remove orphaned file: %s\n", orphan)
+			continue
+		}
+
+		log.Printf("Removing orphaned file: %s\n", orphan)
+		if err := removeOutput(orphan); err != nil {
+			return err
+		}
+	}
+
+	if !dryRun {
+		for _, docId := range orphanedDocIds {
+			state.Delete(docId)
+		}
+	}
+	return nil
+}
+
+// findOrphans returns the files owned by docblog that don't belong to any of
+// the published documents, along with the IDs of documents they belonged to.
+// Files are owned by docblog if they are listed in the manifest, if they are
+// posts with a document ID in the frontmatter, or if they are assets named
+// after a known document ID.
+func findOrphans(
+	filesMetadata []*drive.GoogleDocMetadata,
+) ([]string, []string, error) {
+	published := map[string]bool{}
+	for _, metadata := range filesMetadata {
+		if metadata.Status != drive.StatusDraft {
+			published[metadata.Id] = true
+		}
+	}
+
+	var orphans, orphanedDocIds []string
+	owned := map[string]bool{}
+	for _, docId := range state.DocIds() {
+		entry, _ := state.Get(docId)
+		if published[docId] {
+			for _, outputPath := range entry.Outputs() {
+				owned[filepath.Clean(outputPath)] = true
+			}
+			continue
+		}
+
+		orphanedDocIds = append(orphanedDocIds, docId)
+		orphans = append(orphans, entry.Outputs()...)
+	}
+
+	// Posts written before the manifest was introduced, or with a manifest
+	// that was lost, can still be recognized by their frontmatter.
+	err := filepath.WalkDir(args.PostsOutputPath, func(
+		path string, d fs.DirEntry, err error,
+	) error {
+		if err != nil || d.IsDir() || owned[filepath.Clean(path)] {
+			return err
+		}
+
+		docId, err := readDocId(path)
+		if err != nil || docId == "" || published[docId] {
+			return err
+		}
+
+		if !slices.Contains(orphanedDocIds, docId) {
+			orphanedDocIds = append(orphanedDocIds, docId)
+		}
+		orphans = append(orphans, path)
+
+		// Page bundles contain assets of the post as well.
+		if strings.HasPrefix(filepath.Base(path), "index.") {
+			siblings, err := os.ReadDir(filepath.Dir(path))
+			if err != nil {
+				return err
+			}
+			for _, sibling := range siblings {
+				if !sibling.IsDir() && bundleAssetRegex.MatchString(sibling.Name()) {
+					orphans = append(orphans,
+						filepath.Join(filepath.Dir(path), sibling.Name()))
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+
+	// Assets are prefixed with the document ID, see drive.NormalizedAssetPath.
+	assetsDir := filepath.Join(args.AssetsOutputPath, args.AssetsPathPrefix)
+	assets, err := os.ReadDir(assetsDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+	for _, asset := range assets {
+		assetPath := filepath.Join(assetsDir, asset.Name())
+		if asset.IsDir() || owned[assetPath] {
+			continue
+		}
+
+		for _, docId := range orphanedDocIds {
+			if strings.HasPrefix(asset.Name(), docId+"-") {
+				orphans = append(orphans, assetPath)
+			}
+		}
+		// Assets that were removed from a published document.
+		for docId := range published {
+			if _, ok := state.Get(docId); ok &&
+				strings.HasPrefix(asset.Name(), docId+"-") {
+				orphans = append(orphans, assetPath)
+			}
+		}
+	}
+
+	for i, orphan := range orphans {
+		orphans[i] = filepath.Clean(orphan)
+	}
+	slices.Sort(orphans)
+	return slices.Compact(orphans), orphanedDocIds, nil
+}
+
+// readDocId returns the ID of the document the post was generated from, or an
+// empty string if the file doesn't look like a docblog post.
+func readDocId(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	for _, delimiter := range []string{"---\n", "+++\n"} {
+		if !bytes.HasPrefix(content, []byte(delimiter)) {
+			continue
+		}
+
+		frontmatter, _, found := bytes.Cut(
+			content[len(delimiter):], []byte("\n"+delimiter))
+		if !found {
+			return "", nil
+		}
+		if match := docIdRegex.FindSubmatch(frontmatter); match != nil {
+			return string(match[1]), nil
+		}
+	}
+	return "", nil
+}
+
+// removeOutputs deletes the files previously written for the document, e.g.
+// when it was moved back to drafts.
+func removeOutputs(logger *log.Logger, docId string) error {
+	entry, ok := state.Get(docId)
+	if !ok {
+		return nil
+	}
+
+	for _, outputPath := range entry.Outputs() {
+		logger.Printf("Removing file: %s\n", outputPath)
+		if err := removeOutput(outputPath); err != nil {
+			return err
+		}
+	}
+
+	state.Delete(docId)
+	return nil
+}
+
+// removeOutput deletes the file written previously, see outputWriter.
+func removeOutput(outputPath string) error {
+	return output.RemoveFile(outputPath)
+}
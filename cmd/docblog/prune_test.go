@@ -0,0 +1,207 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/google/docblog/pkg/drive"
+	"github.com/google/docblog/pkg/manifest"
+)
+
+// writeFiles creates the files with the provided contents, by their path
+// relative to the directory.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o640); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReadDocId(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"yaml", "---\ntitle: Hello\ngoogle_doc_id: doc-1_a\n---\n<p>Hello</p>", "doc-1_a"},
+		{"yaml quoted", "---\ngoogle_doc_id: \"doc1\"\n---\n", "doc1"},
+		{"toml", "+++\ntitle = \"Hello\"\ngoogle_doc_id = \"doc1\"\n+++\n", "doc1"},
+		{"toml nested", "+++\n[extra]\n  google_doc_id = \"doc1\"\n+++\n", "doc1"},
+		{"no document ID", "---\ntitle: Hello\n---\n", ""},
+		{"no frontmatter", "<p>google_doc_id: doc1</p>\n", ""},
+		{"unterminated frontmatter", "---\ngoogle_doc_id: doc1\n", ""},
+		{"document ID in the body", "---\ntitle: Hello\n---\ngoogle_doc_id: doc1\n", ""},
+		{"other key", "---\nnot_google_doc_id: doc1\n---\n", ""},
+		{"invalid ID", "---\ngoogle_doc_id: doc 1\n---\n", ""},
+	}
+	dir := t.TempDir()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, strings.ReplaceAll(tt.name, " ", "-"))
+			if err := os.WriteFile(path, []byte(tt.content), 0o640); err != nil {
+				t.Fatal(err)
+			}
+			got, err := readDocId(path)
+			if err != nil {
+				t.Fatalf("readDocId() failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("readDocId() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := readDocId(filepath.Join(dir, "missing")); err == nil {
+		t.Errorf("readDocId() of a missing file succeeded, want error")
+	}
+}
+
+func TestPrune(t *testing.T) {
+	dir := configureTest(t, "blog")
+	writeFiles(t, dir, map[string]string{
+		// Listed in the manifest.
+		"posts/2024-01-01-Gone.html":    "---\ngoogle_doc_id: gone\n---\n",
+		"assets/gone-image1.png":        "image",
+		"posts/2024-01-02-Kept.html":    "---\ngoogle_doc_id: kept\n---\n",
+		"assets/kept-image1.png":        "image",
+		"assets/kept-image2.png":        "removed from the document",
+		"redirects/old-gone/index.html": "redirect",
+		// Only recognized by their frontmatter.
+		"posts/2023-01-01-Yaml.html":    "---\ntitle: Yaml\ngoogle_doc_id: yamlDoc\n---\n",
+		"assets/yamlDoc-image1.png":     "image",
+		"posts/2023-01-02-Toml.md":      "+++\ntitle = \"Toml\"\ngoogle_doc_id = \"tomlDoc\"\n+++\n",
+		"assets/tomlDoc-image1.png":     "image",
+		"posts/2023-01-03-Draft.html":   "---\ngoogle_doc_id: draftDoc\n---\n",
+		"posts/2023-01-04-Live.html":    "---\ngoogle_doc_id: liveDoc\n---\n",
+		"assets/liveDoc-image1.png":     "image",
+		"posts/bundle/index.md":         "+++\ngoogle_doc_id = \"bundleDoc\"\n+++\n",
+		"posts/bundle/image1.png":       "image",
+		"posts/bundle/image1-640w.webp": "variant",
+		"posts/bundle/notes.txt":        "written by hand",
+		"posts/bundle/extra/photo.png":  "added by hand",
+		// Not written by docblog.
+		"posts/about.html": "<p>About</p>",
+		"assets/logo.png":  "logo",
+	})
+	abs := func(name string) string { return filepath.Join(dir, name) }
+	state.Set("gone", &manifest.Entry{
+		Post:      abs("posts/2024-01-01-Gone.html"),
+		Assets:    []string{abs("assets/gone-image1.png")},
+		Redirects: []string{abs("redirects/old-gone/index.html")},
+	})
+	state.Set("kept", &manifest.Entry{
+		Post:   abs("posts/2024-01-02-Kept.html"),
+		Assets: []string{abs("assets/kept-image1.png")},
+	})
+	filesMetadata := []*drive.GoogleDocMetadata{
+		{Id: "kept", Status: drive.StatusPublished},
+		{Id: "liveDoc"},
+		{Id: "draftDoc", Status: drive.StatusDraft},
+	}
+
+	orphans, orphanedDocIds, err := findOrphans(filesMetadata)
+	if err != nil {
+		t.Fatalf("findOrphans() failed: %v", err)
+	}
+	var want []string
+	for _, name := range []string{
+		"assets/gone-image1.png",
+		"assets/kept-image2.png",
+		"assets/tomlDoc-image1.png",
+		"assets/yamlDoc-image1.png",
+		"posts/2023-01-01-Yaml.html",
+		"posts/2023-01-02-Toml.md",
+		"posts/2023-01-03-Draft.html",
+		"posts/2024-01-01-Gone.html",
+		"posts/bundle/image1-640w.webp",
+		"posts/bundle/image1.png",
+		"posts/bundle/index.md",
+		"redirects/old-gone/index.html",
+	} {
+		want = append(want, abs(name))
+	}
+	slices.Sort(want)
+	if !slices.Equal(orphans, want) {
+		t.Errorf("orphans =\n%s\nwant:\n%s",
+			strings.Join(orphans, "\n"), strings.Join(want, "\n"))
+	}
+	slices.Sort(orphanedDocIds)
+	wantDocIds := []string{"bundleDoc", "draftDoc", "gone", "tomlDoc", "yamlDoc"}
+	if !slices.Equal(orphanedDocIds, wantDocIds) {
+		t.Errorf("orphaned document IDs = %v, want %v", orphanedDocIds, wantDocIds)
+	}
+
+	// The dry run only lists the files.
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	err = prune(filesMetadata, true)
+	log.SetOutput(os.Stderr)
+	if err != nil {
+		t.Fatalf("prune() failed: %v", err)
+	}
+	for _, orphan := range want {
+		if _, err := os.Stat(orphan); err != nil {
+			t.Errorf("dry run removed %s: %v", orphan, err)
+		}
+		if !strings.Contains(logs.String(), "Would remove orphaned file: "+orphan+"\n") {
+			t.Errorf("dry run didn't list %s", orphan)
+		}
+	}
+	if _, ok := state.Get("gone"); !ok {
+		t.Errorf("dry run removed the manifest entry")
+	}
+
+	if err := prune(filesMetadata, false); err != nil {
+		t.Fatalf("prune() failed: %v", err)
+	}
+	for _, orphan := range want {
+		if _, err := os.Stat(orphan); !os.IsNotExist(err) {
+			t.Errorf("%s exists, want it removed: %v", orphan, err)
+		}
+	}
+	for _, name := range []string{
+		"posts/2024-01-02-Kept.html",
+		"assets/kept-image1.png",
+		"posts/2023-01-04-Live.html",
+		"assets/liveDoc-image1.png",
+		"posts/bundle/notes.txt",
+		"posts/bundle/extra/photo.png",
+		"posts/about.html",
+		"assets/logo.png",
+	} {
+		if _, err := os.Stat(abs(name)); err != nil {
+			t.Errorf("%s was removed, want it kept: %v", name, err)
+		}
+	}
+	if _, ok := state.Get("gone"); ok {
+		t.Errorf("manifest has an entry of the removed document")
+	}
+	if _, ok := state.Get("kept"); !ok {
+		t.Errorf("manifest has no entry of the published document")
+	}
+}
@@ -0,0 +1,508 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"log"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/docblog/pkg/drive"
+	"github.com/google/docblog/pkg/manifest"
+)
+
+const serveCommand = "serve"
+
+// serveArgs are the arguments of the serve subcommand, along with the global
+// ones.
+var serveArgs struct {
+	Listen string `arg:"--listen,env:DOCBLOG_LISTEN" default:"localhost:4000" help:"address to serve the preview on"`
+}
+
+// previewPath is the URL path of the previews, it's not likely to be used by
+// the assets.
+const previewPath = "/_preview/"
+
+// previewAssetsPrefix is the assets path prefix of the previews. The one of the
+// site may be empty, the assets would then be served from the root.
+const previewAssetsPrefix = "_assets"
+
+// servePreview serves the preview of the posts, until interrupted. The
+// documents are exported when first previewed. The outputs are kept in memory,
+// neither the index sheet nor the manifest is updated.
+func servePreview(ctx context.Context, source drive.Source, index drive.IndexStore) error {
+	s, err := newPreviewServer(ctx, source, index)
+	if err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("tcp", serveArgs.Listen)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{Handler: s.routes()}
+	stopCtx := notifyStop(ctx)
+	go func() {
+		<-stopCtx.Done()
+		shutdownCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Error shutting down the server: %v\n", err)
+		}
+	}()
+
+	log.Printf("Serving the preview on http://%s\n", listener.Addr())
+	if err := server.Serve(listener); err != http.ErrServerClosed {
+		return err
+	}
+	log.Printf("Stopped serving the preview\n")
+	return nil
+}
+
+// newPreviewServer returns the server of the previews, with the documents
+// listed.
+func newPreviewServer(
+	ctx context.Context,
+	source drive.Source,
+	index drive.IndexStore,
+) (*previewServer, error) {
+	// There's no Markdown renderer, the posts are previewed as HTML.
+	args.OutputFormat = drive.HtmlFormat
+	files := newMemoryWriter()
+	output = files
+
+	s := &previewServer{
+		ctx:       ctx,
+		source:    source,
+		index:     index,
+		files:     files,
+		assetsDir: filepath.Join(args.AssetsOutputPath, args.AssetsPathPrefix),
+		previews:  map[string]*preview{},
+	}
+	args.AssetsPathPrefix = previewAssetsPrefix
+	if err := s.list(); err != nil {
+		return nil, err
+	}
+	tagVocabulary = drive.AllTags(s.docs)
+	return s, nil
+}
+
+// previewServer renders the posts of the documents in a built-in layout. The
+// exported documents are kept in memory until fetched again.
+type previewServer struct {
+	ctx    context.Context
+	source drive.Source
+	index  drive.IndexStore
+	// files contains the posts and the assets of the previews.
+	files *memoryWriter
+	// assetsDir contains the assets written earlier, under the prefix of the
+	// site.
+	assetsDir string
+
+	mu       sync.Mutex
+	docs     []*drive.GoogleDocMetadata
+	previews map[string]*preview
+}
+
+// preview is a rendered post.
+type preview struct {
+	postPath string
+	// metadata is the one the post was written with, including the generated
+	// description.
+	metadata drive.GoogleDocMetadata
+	// frontmatter is the one written for the metadata.
+	frontmatter drive.Frontmatter
+	// content is the inner HTML of the body of the post.
+	content string
+	// outputs are the paths of the post and its assets in files.
+	outputs []string
+	fetched time.Time
+}
+
+func (s *previewServer) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", s.handleIndex)
+	mux.HandleFunc("GET "+previewPath+"{docId}/{$}", s.handlePost)
+	mux.HandleFunc("GET "+previewPath+"{docId}/{name}", s.handleBundleAsset)
+	mux.HandleFunc("POST "+previewPath+"{docId}/refetch", s.handleRefetch)
+	mux.HandleFunc("GET /"+previewAssetsPrefix+"/{name}", s.handleAsset)
+	return mux
+}
+
+// list lists the documents along with their metadata from the index sheet.
+func (s *previewServer) list() error {
+	indexSheet, err := s.index.GetIndexSheet(args.DriveDirId)
+	if err != nil {
+		return err
+	}
+	docs, err := s.source.ListGoogleDocs(args.DriveDirId, args.ListOptions)
+	if err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		if metadata, ok := indexSheet[doc.Id]; ok {
+			doc.UpdateWith(metadata)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.docs = docs
+	return nil
+}
+
+// doc returns the metadata of the listed document, nil if not listed.
+func (s *previewServer) doc(docId string) *drive.GoogleDocMetadata {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, doc := range s.docs {
+		if doc.Id == docId {
+			return doc
+		}
+	}
+	return nil
+}
+
+// preview returns the preview of the document, it's exported unless it was
+// previewed already.
+func (s *previewServer) preview(metadata *drive.GoogleDocMetadata) (*preview, error) {
+	s.mu.Lock()
+	p, ok := s.previews[metadata.Id]
+	s.mu.Unlock()
+	if ok {
+		return p, nil
+	}
+
+	// The description may be generated, the listed metadata stays unchanged.
+	m := *metadata
+	logger := log.New(log.Writer(), fmt.Sprintf("[%s] ", m.Name),
+		log.Flags()|log.Lmsgprefix)
+	logger.Printf("Exporting file: %s\n", m.Id)
+	zipContent, err := s.source.ExportGoogleDocToZip(&m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export file: %v", err)
+	}
+	unzippedFiles, err := drive.Unzip(zipContent)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unzip file: %v", err)
+	}
+
+	p = &preview{postPath: postOutputPath(&m), fetched: time.Now()}
+	var written manifest.Entry
+	err = writePost(s.ctx, logger, &written, p.postPath, &m, unzippedFiles)
+	p.outputs = append(written.Assets, p.postPath)
+	if err != nil {
+		s.remove(p)
+		return nil, err
+	}
+
+	// The post starts with the frontmatter of the metadata, see processHtml.
+	p.metadata = m
+	p.frontmatter = profile.Frontmatter(&m)
+	header, err := p.frontmatter.Marshal(profile.FrontmatterFormat)
+	if err != nil {
+		s.remove(p)
+		return nil, err
+	}
+	// Like in the feeds, the body is embedded in the layout. URLs relative to
+	// the post, e.g. of the assets of page bundles, are resolved against the
+	// preview.
+	post, _ := s.files.ReadFile(p.postPath)
+	p.content, err = drive.BodyContent(bytes.TrimPrefix(post, header), previewPath+m.Id+"/")
+	if err != nil {
+		s.remove(p)
+		return nil, fmt.Errorf("failed to parse post: %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if prev, ok := s.previews[m.Id]; ok {
+		// Previewed concurrently, the outputs are the same.
+		return prev, nil
+	}
+	s.previews[m.Id] = p
+	return p, nil
+}
+
+// remove removes the outputs of the preview.
+func (s *previewServer) remove(p *preview) {
+	for _, outputPath := range p.outputs {
+		_ = s.files.RemoveFile(outputPath)
+	}
+}
+
+func (s *previewServer) handleIndex(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	page := indexPage{}
+	for _, doc := range s.docs {
+		_, fetched := s.previews[doc.Id]
+		page.Docs = append(page.Docs, indexEntry{doc, fetched})
+	}
+	s.mu.Unlock()
+
+	render(w, indexTemplate, page)
+}
+
+func (s *previewServer) handlePost(w http.ResponseWriter, r *http.Request) {
+	metadata := s.doc(r.PathValue("docId"))
+	if metadata == nil {
+		http.NotFound(w, r)
+		return
+	}
+	p, err := s.preview(metadata)
+	if err != nil {
+		log.Printf("Error previewing %s: %v\n", metadata.Name, err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	render(w, postTemplate, newPostPage(p))
+}
+
+// handleRefetch drops the preview, so that the document is exported again
+// along with its metadata.
+func (s *previewServer) handleRefetch(w http.ResponseWriter, r *http.Request) {
+	docId := r.PathValue("docId")
+	s.mu.Lock()
+	p, ok := s.previews[docId]
+	delete(s.previews, docId)
+	s.mu.Unlock()
+	if ok {
+		s.remove(p)
+	}
+
+	if err := s.list(); err != nil {
+		log.Printf("Error listing documents: %v\n", err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	http.Redirect(w, r, previewPath+docId+"/", http.StatusSeeOther)
+}
+
+// handleBundleAsset serves the assets of page bundles, which are referenced
+// relative to the post.
+func (s *previewServer) handleBundleAsset(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	p, ok := s.previews[r.PathValue("docId")]
+	s.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	assetPath := assetOutputPath(p.postPath, r.PathValue("docId"), r.PathValue("name"))
+	s.serveFile(w, r, assetPath, p.fetched)
+}
+
+// handleAsset serves the assets of the previews, falling back to the ones
+// written earlier.
+func (s *previewServer) handleAsset(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	assetPath := filepath.Join(args.AssetsOutputPath, previewAssetsPrefix, name)
+	if _, ok := s.files.ReadFile(assetPath); !ok {
+		assetPath = filepath.Join(s.assetsDir, name)
+	}
+	s.serveFile(w, r, assetPath, time.Time{})
+}
+
+func (s *previewServer) serveFile(
+	w http.ResponseWriter,
+	r *http.Request,
+	filePath string,
+	modified time.Time,
+) {
+	if content, ok := s.files.ReadFile(filePath); ok {
+		http.ServeContent(w, r, filePath, modified, bytes.NewReader(content))
+		return
+	}
+	http.ServeFile(w, r, filePath)
+}
+
+// render writes the page, errors are only logged as the response is already
+// being written.
+func render(w http.ResponseWriter, t *template.Template, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := t.Execute(w, data); err != nil {
+		log.Printf("Error rendering %s: %v\n", t.Name(), err)
+	}
+}
+
+type indexPage struct {
+	Docs []indexEntry
+}
+
+type indexEntry struct {
+	*drive.GoogleDocMetadata
+	Fetched bool
+}
+
+// postPage is the post as the generator would show it.
+type postPage struct {
+	DocId       string
+	Title       string
+	Date        time.Time
+	Description string
+	Categories  []string
+	Tags        []string
+	Draft       bool
+	Unlisted    bool
+	Permalink   string
+	Fields      []drive.FrontmatterField
+	Content     template.HTML
+	Fetched     time.Time
+}
+
+func newPostPage(p *preview) postPage {
+	m := &p.metadata
+	return postPage{
+		DocId:       m.Id,
+		Title:       m.Name,
+		Date:        m.CreatedTime,
+		Description: m.Description,
+		Categories:  m.AllCategories(),
+		Tags:        m.Tags,
+		Draft:       m.Status == drive.StatusDraft,
+		Unlisted:    m.Status == drive.StatusUnlisted,
+		Permalink:   m.Permalink(profile.Permalink),
+		Fields:      flattenFrontmatter(p.frontmatter, ""),
+		// The content comes from the author's own document.
+		Content: template.HTML(p.content),
+		Fetched: p.fetched,
+	}
+}
+
+// flattenFrontmatter returns the fields of the nested tables with dotted keys.
+func flattenFrontmatter(fm drive.Frontmatter, prefix string) []drive.FrontmatterField {
+	var fields []drive.FrontmatterField
+	for _, field := range fm {
+		if table, ok := field.Value.(drive.Frontmatter); ok {
+			fields = append(fields, flattenFrontmatter(table, prefix+field.Key+".")...)
+		} else {
+			fields = append(fields, drive.FrontmatterField{
+				Key: prefix + field.Key, Value: field.Value})
+		}
+	}
+	return fields
+}
+
+var templateFuncs = template.FuncMap{
+	"date": func(t time.Time) string {
+		return t.Format("January 2, 2006")
+	},
+	"value": func(value any) string {
+		switch v := value.(type) {
+		case time.Time:
+			return v.Format(time.RFC3339)
+		case []string:
+			return strings.Join(v, ", ")
+		default:
+			return fmt.Sprint(v)
+		}
+	},
+	"previewPath": func() string { return previewPath },
+}
+
+const previewStyle = `
+<style>
+  body { font-family: sans-serif; max-width: 48rem; margin: 2rem auto; padding: 0 1rem; line-height: 1.5; }
+  header.preview { display: flex; gap: 1rem; align-items: center; border-bottom: 1px solid #ddd; padding-bottom: .5rem; font-size: .9rem; color: #555; }
+  header.preview form { margin-left: auto; }
+  .banner { background: #fff4d6; border: 1px solid #f0d48a; padding: .5rem 1rem; margin: 1rem 0; }
+  .meta, .terms { color: #555; }
+  .terms span { background: #eee; border-radius: .25rem; padding: 0 .4rem; margin-right: .25rem; }
+  table { border-collapse: collapse; }
+  td, th { text-align: left; padding: .25rem .75rem .25rem 0; vertical-align: top; }
+  img { max-width: 100%; height: auto; }
+</style>`
+
+var indexTemplate = template.Must(template.New("index").Funcs(templateFuncs).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>docblog preview</title>` + previewStyle + `
+</head>
+<body>
+<h1>Posts</h1>
+<table>
+  <tr><th>Title</th><th>Status</th><th>Date</th><th></th></tr>
+  {{- range .Docs}}
+  <tr>
+    <td><a href="{{previewPath}}{{.Id}}/">{{.Name}}</a></td>
+    <td>{{.Status}}</td>
+    <td>{{date .CreatedTime}}</td>
+    <td>
+      <form method="post" action="{{previewPath}}{{.Id}}/refetch">
+        <button type="submit">{{if .Fetched}}Re-fetch{{else}}Fetch{{end}}</button>
+      </form>
+    </td>
+  </tr>
+  {{- end}}
+</table>
+</body>
+</html>
+`))
+
+var postTemplate = template.Must(template.New("post").Funcs(templateFuncs).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>` + previewStyle + `
+</head>
+<body>
+<header class="preview">
+  <a href="/">All posts</a>
+  <span>Fetched at {{.Fetched.Format "15:04:05"}}</span>
+  <form method="post" action="{{previewPath}}{{.DocId}}/refetch">
+    <button type="submit">Re-fetch</button>
+  </form>
+</header>
+{{- if .Draft}}
+<p class="banner">This document is a draft, it won't be published.</p>
+{{- else if .Unlisted}}
+<p class="banner">This post is unlisted, it won't be linked anywhere.</p>
+{{- end}}
+<article>
+  <h1>{{.Title}}</h1>
+  <p class="meta">{{if not .Date.IsZero}}{{date .Date}} · {{end}}<code>{{.Permalink}}</code></p>
+  {{- if .Description}}
+  <p class="meta"><em>{{.Description}}</em></p>
+  {{- end}}
+  {{- if .Categories}}
+  <p class="terms">Categories: {{range .Categories}}<span>{{.}}</span>{{end}}</p>
+  {{- end}}
+  {{- if .Tags}}
+  <p class="terms">Tags: {{range .Tags}}<span>{{.}}</span>{{end}}</p>
+  {{- end}}
+  {{.Content}}
+</article>
+<details>
+  <summary>Frontmatter</summary>
+  <table>
+    {{- range .Fields}}
+    <tr><th>{{.Key}}</th><td>{{value .Value}}</td></tr>
+    {{- end}}
+  </table>
+</details>
+</body>
+</html>
+`))
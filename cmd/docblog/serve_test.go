@@ -0,0 +1,173 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/docblog/pkg/drive"
+	"github.com/google/docblog/pkg/drive/drivetest"
+)
+
+// fetch sends the request and returns the status and the body of the response.
+func fetch(t *testing.T, method string, url string) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, url, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading %s failed: %v", url, err)
+	}
+	return resp.StatusCode, string(body)
+}
+
+// newPreviewTest returns the server of the previews of the documents in the
+// directory, along with the temporary directory of the outputs.
+func newPreviewTest(
+	t *testing.T,
+	fake *drivetest.Fake,
+	dirId string,
+	extraArgs ...string,
+) (*httptest.Server, string) {
+	t.Helper()
+	dir := configureTest(t, dirId, extraArgs...)
+	srv := drivetest.NewService(fake)
+	s, err := newPreviewServer(context.Background(), srv, srv)
+	if err != nil {
+		t.Fatalf("newPreviewServer() failed: %v", err)
+	}
+	server := httptest.NewServer(s.routes())
+	t.Cleanup(server.Close)
+	return server, dir
+}
+
+func TestPreviewServer(t *testing.T) {
+	for _, prefix := range []string{"", "static"} {
+		t.Run("prefix "+prefix, func(t *testing.T) {
+			fake := drivetest.NewFake()
+			dirId := fake.AddFolder("", "blog")
+			created := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+			docId := fake.AddDoc(dirId, "Hello", created, map[string][]byte{
+				"hello.html": []byte(`<html><head><style>p{}</style></head><body>` +
+					`<p>First version</p><p><img src="images/image1.png"></p></body></html>`),
+				"images/image1.png": pngHeader,
+			})
+			server, dir := newPreviewTest(t, fake, dirId, "--assets-prefix", prefix)
+			// An asset written by an earlier run.
+			oldAsset := filepath.Join(dir, "assets", prefix, "old.png")
+			if err := drive.WriteFile(oldAsset, []byte("old asset")); err != nil {
+				t.Fatal(err)
+			}
+
+			status, body := fetch(t, http.MethodGet, server.URL+"/")
+			if status != http.StatusOK || !strings.Contains(body, `href="/_preview/`+docId+`/"`) {
+				t.Errorf("index = %d %q, want a link to the preview", status, body)
+			}
+
+			status, body = fetch(t, http.MethodGet, server.URL+"/_preview/"+docId+"/")
+			if status != http.StatusOK {
+				t.Fatalf("preview status = %d, want %d: %s", status, http.StatusOK, body)
+			}
+			// The body of the post is embedded in the layout.
+			for _, want := range []string{
+				"<h1>Hello</h1>",
+				"<p>First version</p>",
+				`src="/_assets/` + docId + `-image1.png"`,
+			} {
+				if !strings.Contains(body, want) {
+					t.Errorf("preview = %q, want it to contain %q", body, want)
+				}
+			}
+			if strings.Count(body, "<body") != 1 || strings.Contains(body, "p{}") {
+				t.Errorf("preview = %q, want the post without its head", body)
+			}
+
+			tests := []struct {
+				path       string
+				wantStatus int
+				wantBody   string
+			}{
+				{"/_assets/" + docId + "-image1.png", http.StatusOK, string(pngHeader)},
+				{"/_assets/old.png", http.StatusOK, "old asset"},
+				{"/_assets/missing.png", http.StatusNotFound, ""},
+				// The directories are not listed.
+				{"/_assets/", http.StatusNotFound, ""},
+				{"/old.png", http.StatusNotFound, ""},
+				{"/_preview/unknown/", http.StatusNotFound, ""},
+			}
+			for _, tt := range tests {
+				status, body := fetch(t, http.MethodGet, server.URL+tt.path)
+				if status != tt.wantStatus || (tt.wantBody != "" && body != tt.wantBody) {
+					t.Errorf("GET %s = %d %q, want %d %q", tt.path, status, body, tt.wantStatus, tt.wantBody)
+				}
+			}
+
+			// Re-fetching exports the document again, then shows the preview.
+			fake.UpdateDoc(docId, created.Add(time.Hour), map[string][]byte{
+				"hello.html": []byte("<html><body><p>Second version</p></body></html>"),
+			})
+			status, body = fetch(t, http.MethodPost, server.URL+"/_preview/"+docId+"/refetch")
+			if status != http.StatusOK || !strings.Contains(body, "<p>Second version</p>") {
+				t.Errorf("re-fetched preview = %d %q, want the second version", status, body)
+			}
+			status, _ = fetch(t, http.MethodGet, server.URL+"/_assets/"+docId+"-image1.png")
+			if status != http.StatusNotFound {
+				t.Errorf("removed asset status = %d, want %d", status, http.StatusNotFound)
+			}
+
+			// Nothing is written to the outputs, which are created empty.
+			if entries, err := os.ReadDir(filepath.Join(dir, "posts")); err != nil || len(entries) > 0 {
+				t.Errorf("posts output = %v, %v, want nothing written", entries, err)
+			}
+		})
+	}
+}
+
+func TestPreviewServerPageBundle(t *testing.T) {
+	fake := drivetest.NewFake()
+	dirId := fake.AddFolder("", "blog")
+	created := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	docId := fake.AddDoc(dirId, "Hello", created, map[string][]byte{
+		"hello.html":        []byte(`<html><body><p><img src="images/image1.png"></p></body></html>`),
+		"images/image1.png": pngHeader,
+	})
+	server, _ := newPreviewTest(t, fake, dirId, "--target", "hugo")
+
+	// The assets are relative to the post, so to the preview as well.
+	_, body := fetch(t, http.MethodGet, server.URL+"/_preview/"+docId+"/")
+	assetPath := "/_preview/" + docId + "/image1.png"
+	if !strings.Contains(body, `src="`+assetPath+`"`) {
+		t.Errorf("preview = %q, want the image at %s", body, assetPath)
+	}
+	if status, body := fetch(t, http.MethodGet, server.URL+assetPath); status != http.StatusOK ||
+		body != string(pngHeader) {
+		t.Errorf("GET %s = %d %q, want the image", assetPath, status, body)
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/google/docblog/pkg/drive"
+	"github.com/google/docblog/pkg/sitemap"
+)
+
+// writeSitemap writes the sitemap of the listed posts, and robots.txt if
+// enabled.
+func writeSitemap(filesMetadata []*drive.GoogleDocMetadata) error {
+	var urls []sitemap.Url
+	for _, metadata := range filesMetadata {
+		if !metadata.IsListed() {
+			continue
+		}
+		loc, err := postUrl(metadata)
+		if err != nil {
+			return err
+		}
+		lastMod := metadata.ModifiedTime
+		// Local sources may not know the modification time.
+		if lastMod.IsZero() {
+			lastMod = metadata.CreatedTime
+		}
+		urls = append(urls, sitemap.Url{Loc: loc, LastMod: lastMod})
+	}
+	// The order of the documents may change from run to run.
+	slices.SortFunc(urls, func(a, b sitemap.Url) int {
+		return strings.Compare(a.Loc, b.Loc)
+	})
+
+	files, err := sitemap.Files(args.SiteUrl, urls)
+	if err != nil {
+		return fmt.Errorf("failed to generate sitemap: %v", err)
+	}
+	for name, content := range files {
+		outputPath := filepath.Join(args.SitemapOutputPath, name)
+		if err := output.WriteFile(outputPath, content); err != nil {
+			return fmt.Errorf("failed to write sitemap: %v", err)
+		}
+	}
+
+	// The sitemaps listed by an index are left behind when there are fewer
+	// URLs. They are numbered from 1, after the index, so the first stale one
+	// is numbered by the count of the files either way.
+	for n := len(files); ; n++ {
+		outputPath := filepath.Join(args.SitemapOutputPath, sitemap.PartFileName(n))
+		if _, err := os.Stat(outputPath); err != nil {
+			break
+		}
+		if err := output.RemoveFile(outputPath); err != nil {
+			return err
+		}
+	}
+
+	if args.Robots {
+		robots, err := sitemap.Robots(args.SiteUrl)
+		if err != nil {
+			return err
+		}
+		outputPath := filepath.Join(args.SitemapOutputPath, sitemap.RobotsFileName)
+		if err := output.WriteFile(outputPath, robots); err != nil {
+			return fmt.Errorf("failed to write robots.txt: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/google/docblog/pkg/drive"
+)
+
+const watchCommand = "watch"
+
+// watchArgs are the arguments of the watch subcommand, along with the global
+// ones.
+var watchArgs struct {
+	PollInterval time.Duration `arg:"--poll-interval,env:DOCBLOG_POLL_INTERVAL" default:"1m" help:"how often to check Google Drive for changes"`
+}
+
+// watch keeps processing the documents that change, until interrupted. The
+// cursor of the changes is stored in the manifest, so that changes made while
+// not watching are processed after a restart.
+func watch(ctx context.Context, source drive.Source, index drive.IndexStore) error {
+	w, err := newChangeWatcher(source, index)
+	if err != nil {
+		return err
+	}
+	stopCtx := notifyStop(ctx)
+
+	for {
+		if err := w.processChanges(ctx); err != nil {
+			return err
+		}
+
+		select {
+		case <-stopCtx.Done():
+			log.Printf("Stopped watching for changes\n")
+			return nil
+		case <-time.After(watchArgs.PollInterval):
+		}
+	}
+}
+
+// changeWatcher processes the documents changed since the cursor. It's not
+// safe for concurrent use.
+type changeWatcher struct {
+	changeSource drive.ChangeSource
+	source       drive.Source
+	index        drive.IndexStore
+
+	pageToken string
+	// pending are the changes that failed to be processed, they are retried
+	// along with the next ones. The cursor only moves past the processed ones.
+	pending *drive.Changes
+}
+
+// newChangeWatcher starts from the cursor stored in the manifest. Without one,
+// all the documents are processed first.
+func newChangeWatcher(source drive.Source, index drive.IndexStore) (*changeWatcher, error) {
+	changeSource, ok := source.(drive.ChangeSource)
+	if !ok {
+		return nil, fmt.Errorf("the source doesn't support watching for changes")
+	}
+
+	// Only the changes to the listed files are reported.
+	if _, err := source.ListGoogleDocs(args.DriveDirId, args.ListOptions); err != nil {
+		return nil, err
+	}
+
+	w := &changeWatcher{
+		changeSource: changeSource,
+		source:       source,
+		index:        index,
+		pageToken:    state.PageToken(),
+	}
+	w.pending = &drive.Changes{Other: w.pageToken == ""}
+	if w.pageToken == "" {
+		var err error
+		if w.pageToken, err = changeSource.GetStartPageToken(); err != nil {
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// processChanges processes the changes made since the previous call. Errors of
+// Google Drive are only logged, so that the changes are retried later.
+func (w *changeWatcher) processChanges(ctx context.Context) error {
+	changes, err := w.changeSource.ListChanges(w.pageToken)
+	if err == nil {
+		w.pending.Other = w.pending.Other || changes.Other
+		for _, docId := range changes.DocIds {
+			if !slices.Contains(w.pending.DocIds, docId) {
+				w.pending.DocIds = append(w.pending.DocIds, docId)
+			}
+		}
+		w.pageToken = changes.PageToken
+	} else {
+		log.Printf("Error listing changes: %v\n", err)
+	}
+
+	if w.pending.Other || len(w.pending.DocIds) > 0 {
+		if syncChanges(ctx, w.source, w.index, w.pending) {
+			w.pending = &drive.Changes{}
+		}
+	}
+	if w.pending.Other || len(w.pending.DocIds) > 0 || args.DryRun {
+		return nil
+	}
+	state.SetPageToken(w.pageToken)
+	return state.Save()
+}
+
+// syncChanges processes the changed documents, or all of them if other files
+// changed. It reports whether all of them were processed.
+func syncChanges(
+	ctx context.Context,
+	source drive.Source,
+	index drive.IndexStore,
+	changes *drive.Changes,
+) bool {
+	var docIds []string
+	if changes.Other {
+		log.Printf("Processing all documents\n")
+	} else {
+		log.Printf("Processing %d changed documents\n", len(changes.DocIds))
+		docIds = changes.DocIds
+	}
+
+	failures, err := syncDocuments(ctx, source, index, docIds)
+	if err != nil {
+		log.Printf("Error processing documents: %v\n", err)
+		return false
+	}
+	return len(failures) == 0
+}
+
+// notifyStop returns a context cancelled on SIGINT or SIGTERM. The documents
+// being processed are finished first, so that the outputs, the index sheet
+// and the manifest stay consistent. Another signal terminates immediately.
+func notifyStop(ctx context.Context) context.Context {
+	stopCtx, stop := context.WithCancel(ctx)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		log.Printf("Stopping after the documents being processed, " +
+			"interrupt again to abort\n")
+		signal.Stop(signals)
+		stop()
+	}()
+	return stopCtx
+}
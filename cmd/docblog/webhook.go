@@ -0,0 +1,295 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/google/docblog/pkg/drive"
+	"github.com/google/docblog/pkg/manifest"
+	gdrive "google.golang.org/api/drive/v3"
+)
+
+const webhookCommand = "webhook"
+
+// webhookArgs are the arguments of the webhook subcommand, along with the
+// global ones.
+var webhookArgs struct {
+	Listen       string        `arg:"--listen,env:DOCBLOG_LISTEN" default:":8080" help:"address to listen on for the notifications"`
+	WebhookUrl   string        `arg:"--webhook-url,required,env:DOCBLOG_WEBHOOK_URL" help:"public HTTPS URL the notifications are sent to, e.g. https://example.com/notifications"`
+	ChannelToken string        `arg:"--channel-token,env:DOCBLOG_CHANNEL_TOKEN" help:"secret sent along with the notifications, random by default"`
+	ChannelTtl   time.Duration `arg:"--channel-ttl,env:DOCBLOG_CHANNEL_TTL" default:"24h" help:"how long the notification channel stays open before it's renewed"`
+}
+
+// Headers of the Google Drive notifications, see
+// https://developers.google.com/drive/api/guides/push#understand-drive-api-notification-events.
+const (
+	channelTokenHeader  = "X-Goog-Channel-Token"
+	resourceStateHeader = "X-Goog-Resource-State"
+	// syncResourceState is the state of the notification sent when the
+	// channel is opened.
+	syncResourceState = "sync"
+)
+
+// channelRetryInterval is how long to wait before retrying to renew the
+// channel.
+const channelRetryInterval = time.Minute
+
+// serveWebhook processes the changed documents whenever Google Drive notifies
+// about changes, until interrupted. The notification channel is renewed before
+// it expires.
+func serveWebhook(ctx context.Context, source drive.Source, index drive.IndexStore) error {
+	listener, err := net.Listen("tcp", webhookArgs.Listen)
+	if err != nil {
+		return err
+	}
+	return runWebhook(ctx, listener, source, index)
+}
+
+// runWebhook serves the notifications on the listener, see serveWebhook.
+func runWebhook(
+	ctx context.Context,
+	listener net.Listener,
+	source drive.Source,
+	index drive.IndexStore,
+) error {
+	defer listener.Close()
+	notifier, ok := source.(drive.ChangeNotifier)
+	if !ok {
+		return fmt.Errorf("the source doesn't support change notifications")
+	}
+	address, err := url.Parse(webhookArgs.WebhookUrl)
+	if err != nil {
+		return fmt.Errorf("invalid webhook URL: %v", err)
+	}
+	token := webhookArgs.ChannelToken
+	if token == "" {
+		if token, err = drive.RandomToken(); err != nil {
+			return err
+		}
+	}
+
+	w, err := newChangeWatcher(source, index)
+	if err != nil {
+		return err
+	}
+	stopCtx := notifyStop(ctx)
+	stopStaleChannels(notifier)
+
+	// The server has to be up before the channel is opened, Google Drive
+	// sends a notification right away.
+	h := newWebhookHandler(address.Path, token)
+	server := &http.Server{Handler: h.routes()}
+	go func() {
+		if err := server.Serve(listener); err != http.ErrServerClosed {
+			log.Printf("Error serving notifications: %v\n", err)
+		}
+	}()
+	log.Printf("Listening for notifications on %s\n", listener.Addr())
+
+	channel, err := h.openChannel(notifier, w.pageToken)
+	if err != nil {
+		return fmt.Errorf("failed to open notification channel: %v", err)
+	}
+	renew := time.NewTimer(renewDelay(channel))
+
+	// Changes made while not listening are processed right away.
+	h.notify()
+	for {
+		select {
+		case <-stopCtx.Done():
+			renew.Stop()
+			shutdownCtx, cancel := context.WithTimeout(
+				context.WithoutCancel(ctx), 10*time.Second)
+			defer cancel()
+			if err := server.Shutdown(shutdownCtx); err != nil {
+				log.Printf("Error shutting down the server: %v\n", err)
+			}
+			stopChannel(notifier, channel)
+			log.Printf("Stopped listening for notifications\n")
+			return nil
+		case <-h.trigger:
+			if err := w.processChanges(ctx); err != nil {
+				return err
+			}
+		case <-renew.C:
+			// The new channel is opened first, so that no notification is
+			// missed in between.
+			renewed, err := h.openChannel(notifier, w.pageToken)
+			if err != nil {
+				log.Printf("Error renewing notification channel: %v\n", err)
+				renew.Reset(channelRetryInterval)
+				continue
+			}
+			stopChannel(notifier, channel)
+			channel = renewed
+			renew.Reset(renewDelay(channel))
+		}
+	}
+}
+
+// renewDelay returns how long to wait before renewing the channel, once 90%
+// of its lifetime passed.
+func renewDelay(channel *gdrive.Channel) time.Duration {
+	lifetime := time.Until(time.UnixMilli(channel.Expiration))
+	return max(channelRetryInterval, lifetime-lifetime/10)
+}
+
+// webhookHandler receives the notifications of Google Drive.
+type webhookHandler struct {
+	path  string
+	token string
+	// trigger is signalled on notifications. It's buffered, so that all the
+	// notifications received while processing the changes trigger a single
+	// run afterwards.
+	trigger chan struct{}
+
+	mu sync.Mutex
+	// expiration is the time the current channel expires at.
+	expiration time.Time
+}
+
+func newWebhookHandler(path string, token string) *webhookHandler {
+	if path == "" {
+		path = "/"
+	}
+	return &webhookHandler{
+		path:    path,
+		token:   token,
+		trigger: make(chan struct{}, 1),
+	}
+}
+
+func (h *webhookHandler) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+h.path, h.handleNotification)
+	mux.HandleFunc("GET /healthz", h.handleHealth)
+	return mux
+}
+
+// handleNotification triggers processing of the changes. The token of the
+// notification is checked, as anyone can send requests to the webhook.
+func (h *webhookHandler) handleNotification(w http.ResponseWriter, r *http.Request) {
+	token := r.Header.Get(channelTokenHeader)
+	if subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) != 1 {
+		http.Error(w, "invalid channel token", http.StatusForbidden)
+		return
+	}
+
+	if r.Header.Get(resourceStateHeader) != syncResourceState {
+		h.notify()
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleHealth reports whether the notification channel is open.
+func (h *webhookHandler) handleHealth(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	expiration := h.expiration
+	h.mu.Unlock()
+
+	if time.Now().After(expiration) {
+		http.Error(w, "no open notification channel", http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintf(w, "ok, channel expires at %s\n", expiration.Format(time.RFC3339))
+}
+
+// notify triggers processing of the changes, unless it's already pending.
+func (h *webhookHandler) notify() {
+	select {
+	case h.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// openChannel opens a notification channel delivering the changes made since
+// the cursor to the webhook.
+func (h *webhookHandler) openChannel(
+	notifier drive.ChangeNotifier,
+	pageToken string,
+) (*gdrive.Channel, error) {
+	channel, err := notifier.WatchChanges(
+		pageToken, webhookArgs.WebhookUrl, h.token, webhookArgs.ChannelTtl)
+	if err != nil {
+		return nil, err
+	}
+
+	expiration := time.UnixMilli(channel.Expiration)
+	if channel.Expiration == 0 {
+		expiration = time.Now().Add(webhookArgs.ChannelTtl)
+		channel.Expiration = expiration.UnixMilli()
+	}
+	h.mu.Lock()
+	h.expiration = expiration
+	h.mu.Unlock()
+
+	log.Printf("Opened notification channel %s, expires at %s\n",
+		channel.Id, expiration.Format(time.RFC3339))
+	state.AddChannel(&manifest.Channel{
+		Id:         channel.Id,
+		ResourceId: channel.ResourceId,
+		Expiration: expiration,
+	})
+	saveChannels()
+	return channel, nil
+}
+
+// stopChannel stops the notification channel and forgets it. Failing to stop
+// it is not fatal, it expires eventually.
+func stopChannel(notifier drive.ChangeNotifier, channel *gdrive.Channel) {
+	if err := notifier.StopChannel(channel); err != nil {
+		log.Printf("Error stopping notification channel %s: %v\n", channel.Id, err)
+	}
+	state.RemoveChannel(channel.Id)
+	saveChannels()
+}
+
+// stopStaleChannels stops the notification channels left open by previous
+// runs, e.g. when killed. Their notifications would fail, as they carry
+// another token unless --channel-token is set. Google Drive has no way to
+// list the channels, they are recorded in the manifest.
+func stopStaleChannels(notifier drive.ChangeNotifier) {
+	for _, channel := range state.OpenChannels() {
+		if time.Now().Before(channel.Expiration) {
+			log.Printf("Stopping notification channel of a previous run: %s\n", channel.Id)
+			stopChannel(notifier, &gdrive.Channel{
+				Id:         channel.Id,
+				ResourceId: channel.ResourceId,
+			})
+		} else {
+			state.RemoveChannel(channel.Id)
+		}
+	}
+}
+
+// saveChannels stores the open notification channels in the manifest, unless
+// it's a dry run.
+func saveChannels() {
+	if args.DryRun {
+		return
+	}
+	if err := state.Save(); err != nil {
+		log.Printf("Error saving the notification channels: %v\n", err)
+	}
+}
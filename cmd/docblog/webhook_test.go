@@ -0,0 +1,193 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/docblog/pkg/drive/drivetest"
+	"github.com/google/docblog/pkg/manifest"
+	gdrive "google.golang.org/api/drive/v3"
+)
+
+var initialWebhookArgs = webhookArgs
+
+func TestWebhookHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		token      string
+		state      string
+		wantStatus int
+		wantSync   bool
+	}{
+		{
+			name:       "change",
+			token:      "secret",
+			state:      "change",
+			wantStatus: http.StatusOK,
+			wantSync:   true,
+		},
+		{
+			name:       "wrong token",
+			token:      "forged",
+			state:      "change",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "missing token",
+			state:      "change",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "sync message",
+			token:      "secret",
+			state:      syncResourceState,
+			wantStatus: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newWebhookHandler("/notifications", "secret")
+			server := httptest.NewServer(h.routes())
+			defer server.Close()
+
+			req, err := http.NewRequest(http.MethodPost, server.URL+"/notifications", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.token != "" {
+				req.Header.Set(channelTokenHeader, tt.token)
+			}
+			req.Header.Set(resourceStateHeader, tt.state)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("POST failed: %v", err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			var synced bool
+			select {
+			case <-h.trigger:
+				synced = true
+			default:
+			}
+			if synced != tt.wantSync {
+				t.Errorf("sync triggered = %v, want %v", synced, tt.wantSync)
+			}
+		})
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	fake := drivetest.NewFake()
+	dirId := fake.AddFolder("", "blog")
+	created := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	docId := fake.AddDoc(dirId, "Hello", created, map[string][]byte{
+		"hello.html": []byte("<html><body><p>First version</p></body></html>"),
+	})
+	dir := configureTest(t, dirId)
+	webhookArgs = initialWebhookArgs
+	webhookArgs.WebhookUrl = "https://example.com/notifications"
+	webhookArgs.ChannelToken = "secret"
+	webhookArgs.ChannelTtl = time.Hour
+	srv := drivetest.NewService(fake)
+
+	// A channel left open by a previous run, e.g. when killed.
+	pageToken, err := srv.GetStartPageToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale, err := srv.WatchChanges(pageToken, webhookArgs.WebhookUrl, "old", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.AddChannel(&manifest.Channel{
+		Id:         stale.Id,
+		ResourceId: stale.ResourceId,
+		Expiration: time.UnixMilli(stale.Expiration),
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- runWebhook(ctx, listener, srv, srv)
+	}()
+
+	// All the documents are processed on start.
+	postPath := filepath.Join(dir, "posts", "2024-05-01-Hello.html")
+	waitFor(t, "the post", func() bool {
+		return strings.Contains(readFile(t, postPath), "First version")
+	})
+	var channels []*gdrive.Channel
+	waitFor(t, "the channel", func() bool {
+		channels = fake.Channels()
+		return len(channels) == 1 && channels[0].Id != stale.Id
+	})
+	if channels[0].Token != "secret" || channels[0].Address != webhookArgs.WebhookUrl {
+		t.Errorf("channel = %+v, want the token and the address of the webhook", channels[0])
+	}
+
+	fake.UpdateDoc(docId, created.Add(time.Hour), map[string][]byte{
+		"hello.html": []byte("<html><body><p>Second version</p></body></html>"),
+	})
+	req, err := http.NewRequest(http.MethodPost,
+		"http://"+listener.Addr().String()+"/notifications", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(channelTokenHeader, "secret")
+	req.Header.Set(resourceStateHeader, "change")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	waitFor(t, "the updated post", func() bool {
+		return strings.Contains(readFile(t, postPath), "Second version")
+	})
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("runWebhook() failed: %v", err)
+	}
+	if channels := fake.Channels(); len(channels) != 0 {
+		t.Errorf("open channels = %v, want none", channels)
+	}
+	saved, err := manifest.Load(args.ManifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved.Channels) != 0 {
+		t.Errorf("channels in the manifest = %v, want none", saved.Channels)
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ai
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/docblog/pkg/retry"
+	"golang.org/x/time/rate"
+)
+
+const DefaultPrompt = "Summarize content of the blog post attached below. " +
+	"Use only plain text in response. Use up to 5 sentences. " +
+	"Skip \"this blog post outlines\" at the beginning."
+
+// Supported AI backends.
+const (
+	GeminiBackend = "gemini"
+	OpenAIBackend = "openai"
+	// OllamaBackend is the OpenAI-compatible API of Ollama, with defaults
+	// suitable for a local server.
+	OllamaBackend = "ollama"
+	NoBackend     = "none"
+)
+
+// Options select and configure the AI backend.
+type Options struct {
+	GeminiOptions
+	OpenAIOptions
+
+	AiBackend         string  `arg:"--ai-backend,env:DOCBLOG_AI_BACKEND" default:"gemini" help:"AI backend generating post descriptions: gemini, openai, ollama or none"`
+	AiRpm             float64 `arg:"--ai-rpm,env:DOCBLOG_AI_RPM" default:"10" help:"maximum number of AI requests per minute"`
+	DescriptionPrompt string  `arg:"--description-prompt,env:DOCBLOG_DESCRIPTION_PROMPT" help:"prompt message to be used to generate post description"`
+	SuggestTags       bool    `arg:"--suggest-tags,env:DOCBLOG_SUGGEST_TAGS" help:"suggest tags of the posts in the index sheet, chosen from the tags already used"`
+	GenerateAltText   bool    `arg:"--generate-alt-text,env:DOCBLOG_GENERATE_ALT_TEXT" help:"generate alt text of the images without one using a multimodal model"`
+
+	AiMaxInputTokens int `arg:"--ai-max-input-tokens,env:DOCBLOG_AI_MAX_INPUT_TOKENS" default:"8000" help:"approximate token budget of the post content sent to the AI backend, longer posts are summarized in parts, zero for no limit"`
+
+	AiCacheDir    string        `arg:"--ai-cache,env:DOCBLOG_AI_CACHE" default:".docblog/ai-cache" help:"directory caching the AI outputs, empty to disable the cache"`
+	AiCacheMaxAge time.Duration `arg:"--ai-cache-max-age,env:DOCBLOG_AI_CACHE_MAX_AGE" default:"720h" help:"how long the AI outputs are cached, zero to keep them forever"`
+	// ReadOnlyCache, if set, only reads the cached outputs, e.g. on dry runs.
+	ReadOnlyCache bool `arg:"-"`
+
+	// Limiter, if set, is shared by all the requests to the AI backend.
+	Limiter *rate.Limiter `arg:"-"`
+	// Retry controls how the failed requests to the AI backend are retried.
+	Retry retry.Policy `arg:"-"`
+}
+
+// Describer generates descriptions of the blog posts.
+type Describer interface {
+	// Describe returns a plain text description of the text content.
+	Describe(ctx context.Context, content string) (string, error)
+}
+
+// backend is implemented by all the AI backends.
+type backend interface {
+	Describer
+	Tagger
+	ImageDescriber
+
+	// modelId identifies the model generating the outputs.
+	modelId() string
+	options() Options
+}
+
+// NewDescriber returns the describer of the selected backend, or nil if the
+// descriptions shouldn't be generated. The describer also implements Tagger
+// and ImageDescriber.
+func NewDescriber(opts Options) (Describer, error) {
+	var b backend
+	switch opts.AiBackend {
+	case GeminiBackend:
+		b = &geminiDescriber{opts}
+	case OpenAIBackend, OllamaBackend:
+		b = newOpenAIDescriber(opts)
+	case NoBackend:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unsupported AI backend: %s", opts.AiBackend)
+	}
+
+	if opts.AiCacheDir == "" {
+		return b, nil
+	}
+	if opts.ReadOnlyCache {
+		cache := NewReadOnlyCache(opts.AiCacheDir, opts.AiCacheMaxAge)
+		return &cachingBackend{backend: b, cache: cache}, nil
+	}
+	cache, err := NewCache(opts.AiCacheDir, opts.AiCacheMaxAge)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open AI cache: %v", err)
+	}
+	return &cachingBackend{backend: b, cache: cache}, nil
+}
+
+// descriptionQuery returns the message asking for the description of the
+// content.
+func (opts Options) descriptionQuery(content string) string {
+	query := DefaultPrompt
+	if opts.DescriptionPrompt != "" {
+		query = opts.DescriptionPrompt
+	} else if opts.GeminiDescriptionPrompt != "" {
+		query = opts.GeminiDescriptionPrompt
+	}
+	return fmt.Sprintf("%s\n\n```%s\n```", query, content)
+}
+
+// call sends the request within the rate limit, retrying it on transient
+// errors.
+func (opts Options) call(ctx context.Context, f func() error) error {
+	return opts.Retry.Do(ctx, func() error {
+		if opts.Limiter != nil {
+			if err := opts.Limiter.Wait(ctx); err != nil {
+				return err
+			}
+		}
+		return f()
+	})
+}
@@ -0,0 +1,344 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ai_test
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/google/docblog/pkg/ai"
+	"github.com/google/docblog/pkg/ai/aitest"
+)
+
+// backends returns the options of each backend talking to the server, along
+// with the model expected in the requests.
+func backends(s *aitest.Server) map[string]struct {
+	opts  ai.Options
+	model string
+} {
+	ollama := ai.Options{
+		AiBackend:     ai.OllamaBackend,
+		OpenAIOptions: ai.OpenAIOptions{OpenAIBaseUrl: s.BaseUrl()},
+	}
+	return map[string]struct {
+		opts  ai.Options
+		model string
+	}{
+		ai.GeminiBackend: {s.GeminiOptions(), "gemini-test"},
+		ai.OpenAIBackend: {s.Options(), ai.DefaultOpenAIModel},
+		ai.OllamaBackend: {ollama, ai.DefaultOllamaModel},
+	}
+}
+
+func newDescriber(t *testing.T, opts ai.Options) ai.Describer {
+	t.Helper()
+	describer, err := ai.NewDescriber(opts)
+	if err != nil {
+		t.Fatalf("NewDescriber() failed: %v", err)
+	}
+	return describer
+}
+
+func TestDescribe(t *testing.T) {
+	s := aitest.NewServer(aitest.StaticReply("  A post about testing.\n"))
+	defer s.Close()
+
+	for name, backend := range backends(s) {
+		t.Run(name, func(t *testing.T) {
+			before := len(s.Requests())
+			describer := newDescriber(t, backend.opts)
+
+			description, err := describer.Describe(context.Background(), "Post content")
+			if err != nil {
+				t.Fatalf("Describe() failed: %v", err)
+			}
+			if want := "A post about testing."; description != want {
+				t.Errorf("Describe() = %q, want %q", description, want)
+			}
+
+			requests := s.Requests()[before:]
+			if len(requests) != 1 {
+				t.Fatalf("got %d requests, want 1", len(requests))
+			}
+			req := requests[0]
+			if req.Model != backend.model {
+				t.Errorf("model = %q, want %q", req.Model, backend.model)
+			}
+			if req.ResponseFormat != nil {
+				t.Errorf("response format = %v, want none", req.ResponseFormat)
+			}
+			content := req.Messages[0].Content
+			if !strings.HasPrefix(content, ai.DefaultPrompt) ||
+				!strings.Contains(content, "Post content") {
+				t.Errorf("query = %q, want the prompt and the content", content)
+			}
+		})
+	}
+}
+
+func TestDescribeErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		// setup makes the server fail the requests.
+		setup func(s *aitest.Server)
+		reply aitest.ReplyFunc
+	}{
+		{
+			name: "error status",
+			reply: func(*ai.ChatCompletionRequest) (string, int) {
+				return "invalid request", http.StatusBadRequest
+			},
+		},
+		{
+			name:  "malformed JSON",
+			setup: (*aitest.Server).ReplyMalformed,
+			reply: aitest.StaticReply("A post."),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := aitest.NewServer(tt.reply)
+			defer s.Close()
+			if tt.setup != nil {
+				tt.setup(s)
+			}
+
+			for name, backend := range backends(s) {
+				t.Run(name, func(t *testing.T) {
+					describer := newDescriber(t, backend.opts)
+					description, err := describer.Describe(context.Background(), "Post content")
+					if err == nil {
+						t.Errorf("Describe() = %q, want error", description)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestSuggestTags(t *testing.T) {
+	vocabulary := []string{"Go", "Web", "CLI", "Docs"}
+	tests := []struct {
+		name    string
+		reply   string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:  "matches vocabulary",
+			reply: `{"tags": ["go", "web ", "Unknown", "docs"]}`,
+			want:  []string{"Go", "Web", "Docs"},
+		},
+		{
+			name:  "code block",
+			reply: "```json\n{\"tags\": [\"CLI\", \"Go\", \"Docs\"]}\n```",
+			want:  []string{"CLI", "Go", "Docs"},
+		},
+		{
+			name:    "malformed JSON",
+			reply:   `{"tags": ["Go", "Web"`,
+			wantErr: true,
+		},
+		{
+			name:    "too few tags",
+			reply:   `{"tags": ["Go", "Unknown"]}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := aitest.NewServer(aitest.StaticReply(tt.reply))
+			defer s.Close()
+
+			for name, backend := range backends(s) {
+				t.Run(name, func(t *testing.T) {
+					before := len(s.Requests())
+					tagger := newDescriber(t, backend.opts).(ai.Tagger)
+
+					tags, err := tagger.SuggestTags(context.Background(), "Post content", vocabulary)
+					if tt.wantErr {
+						if err == nil {
+							t.Errorf("SuggestTags() = %v, want error", tags)
+						}
+						return
+					}
+					if err != nil {
+						t.Fatalf("SuggestTags() failed: %v", err)
+					}
+					if !slices.Equal(tags, tt.want) {
+						t.Errorf("SuggestTags() = %v, want %v", tags, tt.want)
+					}
+
+					req := s.Requests()[before]
+					if req.ResponseFormat == nil || req.ResponseFormat.Type != "json_object" {
+						t.Errorf("response format = %v, want a JSON object", req.ResponseFormat)
+					}
+					if !strings.Contains(req.Messages[0].Content, `["Go","Web","CLI","Docs"]`) {
+						t.Errorf("query = %q, want the vocabulary", req.Messages[0].Content)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestDescribeImage(t *testing.T) {
+	s := aitest.NewServer(aitest.StaticReply(`"A cat on a keyboard."`))
+	defer s.Close()
+
+	for name, backend := range backends(s) {
+		t.Run(name, func(t *testing.T) {
+			before := len(s.Requests())
+			describer := newDescriber(t, backend.opts).(ai.ImageDescriber)
+
+			text, err := describer.DescribeImage(context.Background(), "image/png", []byte("png"))
+			if err != nil {
+				t.Fatalf("DescribeImage() failed: %v", err)
+			}
+			if want := "A cat on a keyboard."; text != want {
+				t.Errorf("DescribeImage() = %q, want %q", text, want)
+			}
+
+			parts := s.Requests()[before].Messages[0].Parts
+			if len(parts) != 2 || parts[0].Text != ai.DefaultAltTextPrompt ||
+				parts[1].ImageUrl == nil ||
+				parts[1].ImageUrl.Url != "data:image/png;base64,cG5n" {
+				t.Errorf("parts = %+v, want the prompt and the image", parts)
+			}
+
+			if _, err := describer.DescribeImage(
+				context.Background(), "image/svg+xml", []byte("<svg/>")); err == nil {
+				t.Errorf("DescribeImage() of SVG succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestCachingBackend(t *testing.T) {
+	s := aitest.NewServer(aitest.StaticReply(`{"tags": ["Go", "Web", "CLI"]}`))
+	defer s.Close()
+
+	opts := s.Options()
+	opts.AiCacheDir = filepath.Join(t.TempDir(), "ai-cache")
+	describer := newDescriber(t, opts)
+	ctx := context.Background()
+
+	for range 2 {
+		if _, err := describer.Describe(ctx, "Post   content"); err != nil {
+			t.Fatalf("Describe() failed: %v", err)
+		}
+	}
+	// Whitespace changes don't invalidate the output.
+	if _, err := describer.Describe(ctx, "Post content\n"); err != nil {
+		t.Fatalf("Describe() failed: %v", err)
+	}
+	if got := len(s.Requests()); got != 1 {
+		t.Errorf("got %d requests for the same content, want 1", got)
+	}
+
+	if _, err := describer.Describe(ctx, "Other content"); err != nil {
+		t.Fatalf("Describe() failed: %v", err)
+	}
+	if got := len(s.Requests()); got != 2 {
+		t.Errorf("got %d requests for different content, want 2", got)
+	}
+
+	vocabulary := []string{"Go", "Web", "CLI"}
+	for range 2 {
+		tags, err := describer.(ai.Tagger).SuggestTags(ctx, "Post content", vocabulary)
+		if err != nil {
+			t.Fatalf("SuggestTags() failed: %v", err)
+		}
+		if !slices.Equal(tags, vocabulary) {
+			t.Errorf("SuggestTags() = %v, want %v", tags, vocabulary)
+		}
+	}
+	if got := len(s.Requests()); got != 3 {
+		t.Errorf("got %d requests after suggesting tags, want 3", got)
+	}
+
+	// Another backend reusing the cache, e.g. on the next run.
+	if _, err := newDescriber(t, opts).Describe(ctx, "Post content"); err != nil {
+		t.Fatalf("Describe() failed: %v", err)
+	}
+	if got := len(s.Requests()); got != 3 {
+		t.Errorf("got %d requests on the next run, want 3", got)
+	}
+
+	// Content may be summarized or truncated with another budget.
+	opts.AiMaxInputTokens = 1000
+	if _, err := newDescriber(t, opts).Describe(ctx, "Post content"); err != nil {
+		t.Fatalf("Describe() failed: %v", err)
+	}
+	if got := len(s.Requests()); got != 4 {
+		t.Errorf("got %d requests with another input budget, want 4", got)
+	}
+}
+
+func TestCachingBackendErrors(t *testing.T) {
+	status := http.StatusBadRequest
+	s := aitest.NewServer(func(*ai.ChatCompletionRequest) (string, int) {
+		return "A post.", status
+	})
+	defer s.Close()
+
+	opts := s.Options()
+	opts.AiCacheDir = t.TempDir()
+	describer := newDescriber(t, opts)
+	ctx := context.Background()
+
+	if _, err := describer.Describe(ctx, "Post content"); err == nil {
+		t.Fatalf("Describe() succeeded, want error")
+	}
+	// Failures are not cached.
+	status = http.StatusOK
+	description, err := describer.Describe(ctx, "Post content")
+	if err != nil {
+		t.Fatalf("Describe() failed: %v", err)
+	}
+	if description != "A post." {
+		t.Errorf("Describe() = %q, want %q", description, "A post.")
+	}
+	if got := len(s.Requests()); got != 2 {
+		t.Errorf("got %d requests, want 2", got)
+	}
+}
+
+func TestReadOnlyCache(t *testing.T) {
+	s := aitest.NewServer(aitest.StaticReply("A post."))
+	defer s.Close()
+
+	opts := s.Options()
+	opts.AiCacheDir = filepath.Join(t.TempDir(), "ai-cache")
+	opts.ReadOnlyCache = true
+	describer := newDescriber(t, opts)
+
+	for range 2 {
+		if _, err := describer.Describe(context.Background(), "Post content"); err != nil {
+			t.Fatalf("Describe() failed: %v", err)
+		}
+	}
+	if got := len(s.Requests()); got != 2 {
+		t.Errorf("got %d requests, want 2", got)
+	}
+	if _, err := os.Stat(opts.AiCacheDir); !os.IsNotExist(err) {
+		t.Errorf("cache directory exists, want it not created: %v", err)
+	}
+}
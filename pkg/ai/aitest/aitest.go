@@ -0,0 +1,223 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package aitest provides a stub of an OpenAI-compatible chat completions API
+// and of the Gemini API, so that the AI features can be exercised without a
+// model.
+package aitest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/google/docblog/pkg/ai"
+)
+
+// ReplyFunc returns the reply to the request, or an HTTP status code other
+// than 200 to fail it.
+type ReplyFunc func(req *ai.ChatCompletionRequest) (string, int)
+
+// Server is a stub of an OpenAI-compatible API and of the Gemini API. It
+// records the received requests, the Gemini ones are converted to chat
+// completion requests.
+type Server struct {
+	*httptest.Server
+
+	reply     ReplyFunc
+	mu        sync.Mutex
+	requests  []*ai.ChatCompletionRequest
+	malformed bool
+}
+
+// NewServer starts a server replying with the provided function. It has to be
+// closed once no longer needed.
+func NewServer(reply ReplyFunc) *Server {
+	s := &Server{reply: reply}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/chat/completions", s.handleChatCompletions)
+	mux.HandleFunc("POST /v1beta/models/{method}", s.handleGenerateContent)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// StaticReply returns a reply function always replying with the same message.
+func StaticReply(message string) ReplyFunc {
+	return func(*ai.ChatCompletionRequest) (string, int) {
+		return message, http.StatusOK
+	}
+}
+
+// BaseUrl returns the URL to be used as OpenAIOptions.OpenAIBaseUrl.
+func (s *Server) BaseUrl() string {
+	return s.URL + "/v1"
+}
+
+// Options returns the options selecting the server as the AI backend.
+func (s *Server) Options() ai.Options {
+	return ai.Options{
+		AiBackend:     ai.OpenAIBackend,
+		OpenAIOptions: ai.OpenAIOptions{OpenAIBaseUrl: s.BaseUrl()},
+	}
+}
+
+// GeminiOptions returns the options selecting the server as the Gemini
+// backend.
+func (s *Server) GeminiOptions() ai.Options {
+	return ai.Options{
+		AiBackend: ai.GeminiBackend,
+		GeminiOptions: ai.GeminiOptions{
+			GeminiApiKey:  "test",
+			GeminiModel:   "gemini-test",
+			GeminiBaseUrl: s.URL,
+		},
+	}
+}
+
+// ReplyMalformed makes the server reply with invalid JSON from now on, as if
+// the response was truncated.
+func (s *Server) ReplyMalformed() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.malformed = true
+}
+
+// Requests returns the requests received so far.
+func (s *Server) Requests() []*ai.ChatCompletionRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*ai.ChatCompletionRequest(nil), s.requests...)
+}
+
+// handle records the request and returns the reply, or writes the response
+// if it's not a successful reply.
+func (s *Server) handle(w http.ResponseWriter, req *ai.ChatCompletionRequest) (string, bool) {
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	malformed := s.malformed
+	s.mu.Unlock()
+
+	message, status := s.reply(req)
+	if status != http.StatusOK {
+		http.Error(w, message, status)
+		return "", false
+	}
+	if malformed {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices": [{"message": `))
+		return "", false
+	}
+	return message, true
+}
+
+func (s *Server) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
+	var req ai.ChatCompletionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	message, ok := s.handle(w, &req)
+	if !ok {
+		return
+	}
+
+	resp := ai.ChatCompletionResponse{Choices: []ai.ChatChoice{{
+		Message: ai.ChatMessage{Role: "assistant", Content: message},
+	}}}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// geminiRequest is a request of the Gemini generateContent method, limited to
+// the fields used by docblog.
+type geminiRequest struct {
+	Contents []struct {
+		Role  string       `json:"role"`
+		Parts []geminiPart `json:"parts"`
+	} `json:"contents"`
+	GenerationConfig struct {
+		ResponseMimeType string `json:"responseMimeType"`
+	} `json:"generationConfig"`
+}
+
+type geminiPart struct {
+	Text       string `json:"text,omitempty"`
+	InlineData *struct {
+		MimeType string `json:"mimeType"`
+		Data     string `json:"data"`
+	} `json:"inlineData,omitempty"`
+}
+
+// handleGenerateContent serves the generateContent method of the model, e.g.
+// "gemini-test:generateContent". The last message of the chat is converted to
+// a chat completion request, the images become data URLs.
+func (s *Server) handleGenerateContent(w http.ResponseWriter, r *http.Request) {
+	model, method, _ := strings.Cut(r.PathValue("method"), ":")
+	if method != "generateContent" {
+		http.NotFound(w, r)
+		return
+	}
+
+	var greq geminiRequest
+	if err := json.NewDecoder(r.Body).Decode(&greq); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(greq.Contents) == 0 {
+		http.Error(w, "no contents", http.StatusBadRequest)
+		return
+	}
+
+	msg := ai.ChatMessage{Role: "user"}
+	for _, part := range greq.Contents[len(greq.Contents)-1].Parts {
+		if part.InlineData != nil {
+			msg.Parts = append(msg.Parts, ai.ContentPart{
+				Type: "image_url",
+				ImageUrl: &ai.ImageUrl{
+					Url: "data:" + part.InlineData.MimeType + ";base64," + part.InlineData.Data,
+				},
+			})
+		} else {
+			msg.Parts = append(msg.Parts, ai.ContentPart{Type: "text", Text: part.Text})
+		}
+	}
+	// Plain text messages are recorded like the OpenAI-compatible ones.
+	if len(msg.Parts) == 1 && msg.Parts[0].Type == "text" {
+		msg = ai.ChatMessage{Role: "user", Content: msg.Parts[0].Text}
+	}
+	req := &ai.ChatCompletionRequest{Model: model, Messages: []ai.ChatMessage{msg}}
+	if greq.GenerationConfig.ResponseMimeType == "application/json" {
+		req.ResponseFormat = &ai.ResponseFormat{Type: "json_object"}
+	}
+
+	message, ok := s.handle(w, req)
+	if !ok {
+		return
+	}
+
+	resp := map[string]any{"candidates": []any{map[string]any{
+		"content": map[string]any{
+			"role":  "model",
+			"parts": []any{map[string]any{"text": message}},
+		},
+		"finishReason": "STOP",
+	}}}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
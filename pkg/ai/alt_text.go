@@ -0,0 +1,49 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ai
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const DefaultAltTextPrompt = "Write alt text for the image attached below, " +
+	"which is a part of a blog post. Describe what the image shows in a " +
+	"single sentence of up to 125 characters. Use only plain text in " +
+	"response. Skip \"image of\" or \"picture of\" at the beginning."
+
+// altTextMimeTypes are the image formats accepted by the multimodal models.
+var altTextMimeTypes = []string{"image/gif", "image/jpeg", "image/png", "image/webp"}
+
+// ImageDescriber generates alt text of the images.
+type ImageDescriber interface {
+	// DescribeImage returns a plain text description of the image.
+	DescribeImage(ctx context.Context, mimeType string, content []byte) (string, error)
+}
+
+// checkAltTextMimeType returns an error if the image can't be described.
+func checkAltTextMimeType(mimeType string) error {
+	if !slices.Contains(altTextMimeTypes, mimeType) {
+		return fmt.Errorf("unsupported image type for alt text: %s", mimeType)
+	}
+	return nil
+}
+
+// cleanAltText removes the quotes that models tend to add around the reply.
+func cleanAltText(reply string) string {
+	return strings.TrimSpace(strings.Trim(reply, "\"'`"))
+}
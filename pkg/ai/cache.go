@@ -0,0 +1,205 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ai
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Cache stores the outputs of the AI backend on disk, keyed by a hash of the
+// input, the model, the prompt and the input budget. Each output is a separate file, written
+// atomically, so that documents processed in parallel, or even concurrent
+// runs, can share the cache.
+type Cache struct {
+	dir string
+	// maxAge is how long the outputs are kept, zero keeps them forever.
+	maxAge time.Duration
+	// readOnly prevents any changes to the directory.
+	readOnly bool
+}
+
+// NewCache opens the cache in the provided directory, creating it if needed,
+// and evicts the expired outputs.
+func NewCache(dir string, maxAge time.Duration) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	c := &Cache{dir: dir, maxAge: maxAge}
+	return c, c.evict()
+}
+
+// NewReadOnlyCache opens the cache in the provided directory without changing
+// it, e.g. on dry runs. The directory may not exist, then nothing is cached.
+// The outputs are not stored and the expired ones are not evicted.
+func NewReadOnlyCache(dir string, maxAge time.Duration) *Cache {
+	return &Cache{dir: dir, maxAge: maxAge, readOnly: true}
+}
+
+// Key returns the cache key of the output generated from the parts of the
+// input. Whitespace in the parts is normalized, so that formatting changes
+// don't invalidate the outputs.
+func Key(parts ...string) string {
+	h := sha256.New()
+	for _, part := range parts {
+		h.Write([]byte(strings.Join(strings.Fields(part), " ")))
+		// Separates the parts, so that they can't be shifted.
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Get returns the cached output, if any and not expired.
+func (c *Cache) Get(key string) (string, bool) {
+	path := c.path(key)
+	info, err := os.Stat(path)
+	if err != nil || c.isExpired(info) {
+		return "", false
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", false
+	}
+	return string(content), true
+}
+
+// Put stores the output in the cache, unless it's read-only.
+func (c *Cache) Put(key string, value string) error {
+	if c.readOnly {
+		return nil
+	}
+	f, err := os.CreateTemp(c.dir, key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(value)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), c.path(key))
+}
+
+// evict removes the expired outputs.
+func (c *Cache) evict() error {
+	if c.maxAge <= 0 {
+		return nil
+	}
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !c.isExpired(info) {
+			continue
+		}
+		err = os.Remove(filepath.Join(c.dir, entry.Name()))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Cache) isExpired(info os.FileInfo) bool {
+	return c.maxAge > 0 && time.Since(info.ModTime()) > c.maxAge
+}
+
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.dir, key)
+}
+
+// cachingBackend serves the outputs of the backend from the cache when
+// possible. Failing to use the cache is never fatal, the output is generated
+// instead.
+type cachingBackend struct {
+	backend
+	cache *Cache
+}
+
+func (b *cachingBackend) Describe(ctx context.Context, content string) (string, error) {
+	key := Key("description", b.modelId(), b.options().descriptionQuery(""),
+		b.options().inputBudget(), content)
+	return b.cached(key, func() (string, error) {
+		return b.backend.Describe(ctx, content)
+	})
+}
+
+func (b *cachingBackend) SuggestTags(
+	ctx context.Context,
+	content string,
+	vocabulary []string,
+) ([]string, error) {
+	key := Key("tags", b.modelId(), b.options().tagsQuery("", vocabulary),
+		b.options().inputBudget(), content)
+	reply, err := b.cached(key, func() (string, error) {
+		tags, err := b.backend.SuggestTags(ctx, content, vocabulary)
+		if err != nil {
+			return "", err
+		}
+		reply, err := json.Marshal(tags)
+		return string(reply), err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var tags []string
+	if err := json.Unmarshal([]byte(reply), &tags); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+func (b *cachingBackend) DescribeImage(
+	ctx context.Context,
+	mimeType string,
+	content []byte,
+) (string, error) {
+	// Images are hashed first, so that the binary content isn't normalized.
+	sum := sha256.Sum256(content)
+	key := Key("alt text", b.modelId(), DefaultAltTextPrompt, hex.EncodeToString(sum[:]))
+	return b.cached(key, func() (string, error) {
+		return b.backend.DescribeImage(ctx, mimeType, content)
+	})
+}
+
+// cached returns the cached output, or generates and caches it.
+func (b *cachingBackend) cached(key string, generate func() (string, error)) (string, error) {
+	if value, ok := b.cache.Get(key); ok {
+		return value, nil
+	}
+	value, err := generate()
+	if err != nil {
+		return "", err
+	}
+	// A failure only means that the output will be generated again.
+	if err := b.cache.Put(key, value); err != nil {
+		log.Printf("Failed to cache AI output: %v\n", err)
+	}
+	return value, nil
+}
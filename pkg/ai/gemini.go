@@ -0,0 +1,122 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ai
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/option"
+)
+
+type GeminiOptions struct {
+	GeminiApiKey            string `arg:"--gemini-api-key,env:GEMINI_API_KEY" help:"API key for Gemini"`
+	GeminiModel             string `arg:"--gemini-model,env:GEMINI_MODEL" default:"gemini-1.5-pro" help:"Gemini model to use for generating post description"`
+	GeminiBaseUrl           string `arg:"--gemini-base-url,env:GEMINI_BASE_URL" help:"base URL of the Gemini API, e.g. of a proxy, defaults to the one of Google"`
+	GeminiDescriptionPrompt string `arg:"env:GEMINI_DESCRIPTION_PROMPT" help:"prompt message to be used to generate HTML description, deprecated in favor of --description-prompt"`
+}
+
+// geminiDescriber generates descriptions using the Gemini API.
+type geminiDescriber struct {
+	opts Options
+}
+
+func (d *geminiDescriber) modelId() string {
+	return GeminiBackend + "/" + d.opts.GeminiModel
+}
+
+func (d *geminiDescriber) options() Options {
+	return d.opts
+}
+
+func (d *geminiDescriber) Describe(ctx context.Context, content string) (string, error) {
+	return d.opts.summarize(content, func(query string) (string, error) {
+		return d.generate(ctx, false, genai.Text(query))
+	})
+}
+
+func (d *geminiDescriber) SuggestTags(
+	ctx context.Context,
+	content string,
+	vocabulary []string,
+) ([]string, error) {
+	reply, err := d.generate(ctx, true, genai.Text(d.opts.tagsQuery(content, vocabulary)))
+	if err != nil {
+		return nil, err
+	}
+	return parseTags(reply, vocabulary)
+}
+
+func (d *geminiDescriber) DescribeImage(
+	ctx context.Context,
+	mimeType string,
+	content []byte,
+) (string, error) {
+	if err := checkAltTextMimeType(mimeType); err != nil {
+		return "", err
+	}
+	reply, err := d.generate(ctx, false,
+		genai.Text(DefaultAltTextPrompt),
+		genai.Blob{MIMEType: mimeType, Data: content})
+	if err != nil {
+		return "", err
+	}
+	return cleanAltText(reply), nil
+}
+
+// generate sends the parts of the query to Gemini and returns the reply,
+// formatted as JSON if requested.
+func (d *geminiDescriber) generate(
+	ctx context.Context,
+	jsonReply bool,
+	parts ...genai.Part,
+) (string, error) {
+	opts := []option.ClientOption{option.WithAPIKey(d.opts.GeminiApiKey)}
+	if d.opts.GeminiBaseUrl != "" {
+		opts = append(opts, option.WithEndpoint(d.opts.GeminiBaseUrl))
+	}
+	client, err := genai.NewClient(ctx, opts...)
+	if err != nil {
+		return "", fmt.Errorf("failed to create Gemini client: %v", err)
+	}
+	defer client.Close()
+
+	model := client.GenerativeModel(d.opts.GeminiModel)
+	if jsonReply {
+		model.ResponseMIMEType = "application/json"
+	}
+	var resp *genai.GenerateContentResponse
+	// Each query stands on its own, there is no chat history to keep.
+	err = d.opts.call(ctx, func() (err error) {
+		resp, err = model.GenerateContent(ctx, parts...)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	for _, candidate := range resp.Candidates {
+		if candidate.Content != nil {
+			for _, part := range candidate.Content.Parts {
+				sb.WriteString(fmt.Sprintf("%v", part))
+			}
+		}
+	}
+
+	return strings.TrimSpace(sb.String()), nil
+}
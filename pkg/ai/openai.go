@@ -0,0 +1,264 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	DefaultOpenAIBaseUrl = "https://api.openai.com/v1"
+	DefaultOpenAIModel   = "gpt-4o-mini"
+	DefaultOllamaBaseUrl = "http://localhost:11434/v1"
+	DefaultOllamaModel   = "llama3.1"
+)
+
+// openAITimeout limits the time of a single request, so that a stuck server
+// doesn't stall the run. It's generous, as local models may be slow.
+const openAITimeout = 5 * time.Minute
+
+// OpenAIOptions configure backends compatible with the OpenAI chat completions
+// API, e.g. OpenAI, Ollama, llama.cpp server or vLLM.
+type OpenAIOptions struct {
+	OpenAIBaseUrl string `arg:"--openai-base-url,env:OPENAI_BASE_URL" help:"base URL of the OpenAI-compatible API, defaults to the one of OpenAI or of a local Ollama server"`
+	OpenAIApiKey  string `arg:"--openai-api-key,env:OPENAI_API_KEY" help:"API key for the OpenAI-compatible API, if required"`
+	OpenAIModel   string `arg:"--openai-model,env:OPENAI_MODEL" help:"model to use for generating post description, defaults to gpt-4o-mini for OpenAI and llama3.1 for Ollama"`
+}
+
+// ChatMessage is a message of the chat completions API.
+type ChatMessage struct {
+	Role    string
+	Content string
+	// Parts replace the content in multimodal messages, e.g. with images.
+	Parts []ContentPart
+}
+
+// ContentPart is a part of a multimodal message, either text or an image.
+type ContentPart struct {
+	Type     string    `json:"type"`
+	Text     string    `json:"text,omitempty"`
+	ImageUrl *ImageUrl `json:"image_url,omitempty"`
+}
+
+// ImageUrl references the image of a content part, possibly as a data URL.
+type ImageUrl struct {
+	Url string `json:"url"`
+}
+
+// chatMessageJson is the JSON representation of ChatMessage, the content is
+// either a string or a list of parts.
+type chatMessageJson struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+func (m ChatMessage) MarshalJSON() ([]byte, error) {
+	var content any = m.Content
+	if len(m.Parts) > 0 {
+		content = m.Parts
+	}
+	raw, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(chatMessageJson{Role: m.Role, Content: raw})
+}
+
+func (m *ChatMessage) UnmarshalJSON(data []byte) error {
+	var msg chatMessageJson
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return err
+	}
+	*m = ChatMessage{Role: msg.Role}
+	if bytes.HasPrefix(bytes.TrimSpace(msg.Content), []byte("[")) {
+		return json.Unmarshal(msg.Content, &m.Parts)
+	}
+	if len(msg.Content) == 0 || string(msg.Content) == "null" {
+		return nil
+	}
+	return json.Unmarshal(msg.Content, &m.Content)
+}
+
+// ChatCompletionRequest is a request of the chat completions API.
+type ChatCompletionRequest struct {
+	Model          string          `json:"model"`
+	Messages       []ChatMessage   `json:"messages"`
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+}
+
+// ResponseFormat constrains the format of the reply, e.g. to a JSON object.
+type ResponseFormat struct {
+	Type string `json:"type"`
+}
+
+// ChatCompletionResponse is a response of the chat completions API, limited to
+// the fields used by docblog.
+type ChatCompletionResponse struct {
+	Choices []ChatChoice `json:"choices"`
+}
+
+// ChatChoice is one of the replies in the chat completions response.
+type ChatChoice struct {
+	Message ChatMessage `json:"message"`
+}
+
+// openAIDescriber generates descriptions using an OpenAI-compatible API.
+type openAIDescriber struct {
+	opts    Options
+	baseUrl string
+	model   string
+	client  *http.Client
+}
+
+func newOpenAIDescriber(opts Options) *openAIDescriber {
+	d := &openAIDescriber{
+		opts:    opts,
+		baseUrl: opts.OpenAIBaseUrl,
+		model:   opts.OpenAIModel,
+		client:  &http.Client{Timeout: openAITimeout},
+	}
+	if d.baseUrl == "" {
+		d.baseUrl = DefaultOpenAIBaseUrl
+		if opts.AiBackend == OllamaBackend {
+			d.baseUrl = DefaultOllamaBaseUrl
+		}
+	}
+	if d.model == "" {
+		d.model = DefaultOpenAIModel
+		if opts.AiBackend == OllamaBackend {
+			d.model = DefaultOllamaModel
+		}
+	}
+	return d
+}
+
+func (d *openAIDescriber) modelId() string {
+	return d.baseUrl + "/" + d.model
+}
+
+func (d *openAIDescriber) options() Options {
+	return d.opts
+}
+
+func (d *openAIDescriber) Describe(ctx context.Context, content string) (string, error) {
+	return d.opts.summarize(content, func(query string) (string, error) {
+		return d.complete(ctx, textMessage(query), false)
+	})
+}
+
+func (d *openAIDescriber) SuggestTags(
+	ctx context.Context,
+	content string,
+	vocabulary []string,
+) ([]string, error) {
+	reply, err := d.complete(ctx, textMessage(d.opts.tagsQuery(content, vocabulary)), true)
+	if err != nil {
+		return nil, err
+	}
+	return parseTags(reply, vocabulary)
+}
+
+func (d *openAIDescriber) DescribeImage(
+	ctx context.Context,
+	mimeType string,
+	content []byte,
+) (string, error) {
+	if err := checkAltTextMimeType(mimeType); err != nil {
+		return "", err
+	}
+	reply, err := d.complete(ctx, ChatMessage{
+		Role: "user",
+		Parts: []ContentPart{
+			{Type: "text", Text: DefaultAltTextPrompt},
+			{Type: "image_url", ImageUrl: &ImageUrl{
+				Url: "data:" + mimeType + ";base64," +
+					base64.StdEncoding.EncodeToString(content),
+			}},
+		},
+	}, false)
+	if err != nil {
+		return "", err
+	}
+	return cleanAltText(reply), nil
+}
+
+func textMessage(content string) ChatMessage {
+	return ChatMessage{Role: "user", Content: content}
+}
+
+// complete sends the message to the chat completions API and returns the
+// content of the reply, formatted as a JSON object if requested.
+func (d *openAIDescriber) complete(
+	ctx context.Context,
+	message ChatMessage,
+	jsonReply bool,
+) (string, error) {
+	request := ChatCompletionRequest{
+		Model:    d.model,
+		Messages: []ChatMessage{message},
+	}
+	if jsonReply {
+		request.ResponseFormat = &ResponseFormat{Type: "json_object"}
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+
+	var completion ChatCompletionResponse
+	err = d.opts.call(ctx, func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+			strings.TrimSuffix(d.baseUrl, "/")+"/chat/completions",
+			bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if d.opts.OpenAIApiKey != "" {
+			req.Header.Set("Authorization", "Bearer "+d.opts.OpenAIApiKey)
+		}
+
+		resp, err := d.client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		// The error carries the status code and the headers, so that it's
+		// retried like the errors of the Google APIs.
+		if err := googleapi.CheckResponse(resp); err != nil {
+			return err
+		}
+		return json.NewDecoder(resp.Body).Decode(&completion)
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to call %s: %v", d.baseUrl, err)
+	}
+
+	if len(completion.Choices) == 0 {
+		return "", fmt.Errorf("empty response from %s", d.baseUrl)
+	}
+	return strings.TrimSpace(completion.Choices[0].Message.Content), nil
+}
@@ -0,0 +1,89 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Number of the tags suggested for a post.
+const (
+	MinSuggestedTags = 3
+	MaxSuggestedTags = 7
+)
+
+const DefaultTagsPrompt = "Suggest between %d and %d tags for the blog " +
+	"post attached below. Use only the tags from the following JSON list: %s. " +
+	"Respond with a JSON object with a single \"tags\" field, a list of the " +
+	"suggested tags ordered from the most relevant."
+
+// Tagger suggests tags of the blog posts.
+type Tagger interface {
+	// SuggestTags returns the tags of the text content, chosen from the
+	// provided vocabulary.
+	SuggestTags(ctx context.Context, content string, vocabulary []string) ([]string, error)
+}
+
+// tagsReply is the JSON reply expected from the model.
+type tagsReply struct {
+	Tags []string `json:"tags"`
+}
+
+// tagsQuery returns the message asking for the tags of the content. Content
+// exceeding the token budget is truncated, its beginning should be enough to
+// pick the tags.
+func (opts Options) tagsQuery(content string, vocabulary []string) string {
+	list, _ := json.Marshal(vocabulary)
+	return fmt.Sprintf(DefaultTagsPrompt+"\n\n```%s\n```",
+		MinSuggestedTags, MaxSuggestedTags, list,
+		truncateText(content, opts.maxInputChars()))
+}
+
+// parseTags parses the reply of the model and validates the tags against the
+// vocabulary. Tags are matched ignoring case and returned as spelled in the
+// vocabulary, the ones that don't match are dropped.
+func parseTags(reply string, vocabulary []string) ([]string, error) {
+	// Models tend to wrap JSON in a code block, even when asked not to.
+	reply = strings.TrimSpace(reply)
+	reply = strings.TrimPrefix(reply, "```json")
+	reply = strings.Trim(reply, "`\n ")
+
+	var parsed tagsReply
+	if err := json.Unmarshal([]byte(reply), &parsed); err != nil {
+		return nil, fmt.Errorf("invalid tags reply %q: %v", reply, err)
+	}
+
+	var tags []string
+	for _, tag := range parsed.Tags {
+		i := slices.IndexFunc(vocabulary, func(known string) bool {
+			return strings.EqualFold(known, strings.TrimSpace(tag))
+		})
+		if i >= 0 && !slices.Contains(tags, vocabulary[i]) {
+			tags = append(tags, vocabulary[i])
+		}
+	}
+
+	if len(tags) < min(MinSuggestedTags, len(vocabulary)) {
+		return nil, fmt.Errorf("too few valid tags in reply %q", reply)
+	}
+	if len(tags) > MaxSuggestedTags {
+		tags = tags[:MaxSuggestedTags]
+	}
+	return tags, nil
+}
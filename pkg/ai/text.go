@@ -0,0 +1,108 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ai
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const ChunkPrompt = "Summarize the part of a blog post attached below. " +
+	"Use only plain text in response. Keep the key points, facts and names, " +
+	"they will be used to describe the whole post."
+
+const (
+	// charsPerToken is a rough estimate of the number of characters of a
+	// token, the exact number depends on the model and the language.
+	charsPerToken = 4
+	// maxSummaryRounds limits how many times the summaries of the chunks are
+	// summarized again, if they don't fit in the budget. The content is
+	// truncated afterwards.
+	maxSummaryRounds = 3
+)
+
+// maxInputChars returns the number of characters of the content that fit in
+// the token budget, zero if unlimited.
+func (opts Options) maxInputChars() int {
+	return max(0, opts.AiMaxInputTokens*charsPerToken)
+}
+
+// inputBudget identifies the token budget in the cache keys, as the outputs
+// generated from content that was summarized or truncated differ.
+func (opts Options) inputBudget() string {
+	return fmt.Sprintf("max input tokens: %d", max(0, opts.AiMaxInputTokens))
+}
+
+// summarize returns the description of the content. Content exceeding the
+// token budget is split into chunks, which are summarized separately, and the
+// description is generated from the summaries.
+func (opts Options) summarize(
+	content string,
+	complete func(query string) (string, error),
+) (string, error) {
+	chunks := splitText(content, opts.maxInputChars())
+	for round := 0; len(chunks) > 1 && round < maxSummaryRounds; round++ {
+		summaries := make([]string, len(chunks))
+		for i, chunk := range chunks {
+			summary, err := complete(fmt.Sprintf("%s\n\n```%s\n```", ChunkPrompt, chunk))
+			if err != nil {
+				return "", fmt.Errorf("failed to summarize part %d of %d: %v",
+					i+1, len(chunks), err)
+			}
+			summaries[i] = summary
+		}
+		chunks = splitText(strings.Join(summaries, "\n"), opts.maxInputChars())
+	}
+	return complete(opts.descriptionQuery(chunks[0]))
+}
+
+// truncateText returns the beginning of the text that fits in the budget.
+func truncateText(text string, maxChars int) string {
+	return splitText(text, maxChars)[0]
+}
+
+// splitText splits the text into chunks of up to maxChars characters. Chunks
+// end at line breaks where possible, then at spaces. Zero maxChars results in
+// a single chunk.
+func splitText(text string, maxChars int) []string {
+	if maxChars <= 0 || len(text) <= maxChars {
+		return []string{text}
+	}
+
+	var chunks []string
+	for len(text) > maxChars {
+		end := strings.LastIndex(text[:maxChars], "\n")
+		if end <= 0 {
+			end = strings.LastIndex(text[:maxChars], " ")
+		}
+		if end <= 0 {
+			end = maxChars
+			// Don't split multi-byte characters.
+			for end > 0 && !utf8.RuneStart(text[end]) {
+				end--
+			}
+			if end == 0 {
+				_, end = utf8.DecodeRuneInString(text)
+			}
+		}
+		chunks = append(chunks, strings.TrimSpace(text[:end]))
+		text = strings.TrimSpace(text[end:])
+	}
+	if text != "" {
+		chunks = append(chunks, text)
+	}
+	return chunks
+}
@@ -0,0 +1,206 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ai
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplitText(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		maxChars int
+		want     []string
+	}{
+		{"no limit", "one two three", 0, []string{"one two three"}},
+		{"negative limit", "one two three", -1, []string{"one two three"}},
+		{"empty", "", 4, []string{""}},
+		{"fits exactly", "12345678", 8, []string{"12345678"}},
+		{"one over", "123456789", 8, []string{"12345678", "9"}},
+		{"line breaks", "aaaa\nbb cc\ndddd", 11, []string{"aaaa\nbb cc", "dddd"}},
+		{"line break first", "aa bb\ncc dd ee", 8, []string{"aa bb", "cc dd ee"}},
+		{"spaces", "aaa bbb ccc ddd", 8, []string{"aaa bbb", "ccc ddd"}},
+		{"no break", "abcdefghij", 4, []string{"abcd", "efgh", "ij"}},
+		// "é" takes two bytes, the split point falls in the middle of one.
+		{"multi-byte runes", "ééééé", 3, []string{"é", "é", "é", "é", "é"}},
+		{"multi-byte runes at the limit", "aébc", 3, []string{"aé", "bc"}},
+		// Runes longer than the limit are kept whole.
+		{"rune over the limit", "🚀🚀", 2, []string{"🚀", "🚀"}},
+		{"spaces around chunks", "aaaa    \n\n  bbbb  ", 6, []string{"aaaa", "bbbb"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitText(tt.text, tt.maxChars)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("splitText(%q, %d) = %q, want %q", tt.text, tt.maxChars, got, tt.want)
+			}
+			for _, chunk := range got {
+				if !utf8.ValidString(chunk) {
+					t.Errorf("chunk %q is not valid UTF-8", chunk)
+				}
+			}
+		})
+	}
+}
+
+func TestMaxInputChars(t *testing.T) {
+	tests := []struct {
+		tokens int
+		text   string
+		want   int
+	}{
+		{0, strings.Repeat("a", 100), 1},
+		{-5, strings.Repeat("a", 100), 1},
+		// The budget is the number of tokens times charsPerToken.
+		{2, strings.Repeat("a", 2*charsPerToken), 1},
+		{2, strings.Repeat("a", 2*charsPerToken+1), 2},
+		{2, strings.Repeat("a", 4*charsPerToken), 2},
+		{2, strings.Repeat("a", 4*charsPerToken+1), 3},
+	}
+	for _, tt := range tests {
+		opts := Options{AiMaxInputTokens: tt.tokens}
+		if got := len(splitText(tt.text, opts.maxInputChars())); got != tt.want {
+			t.Errorf("%d tokens: %d characters split into %d chunks, want %d",
+				tt.tokens, len(tt.text), got, tt.want)
+		}
+	}
+}
+
+// lines returns n lines of the provided length, separated by line breaks.
+func lines(n int, length int) string {
+	result := make([]string, n)
+	for i := range n {
+		result[i] = fmt.Sprintf("%0*d", length, i)
+	}
+	return strings.Join(result, "\n")
+}
+
+func TestSummarize(t *testing.T) {
+	// 10 tokens are 40 characters, two lines of 19 characters fit in one
+	// chunk, while lines of 39 characters take one each.
+	opts := Options{AiMaxInputTokens: 10}
+	tests := []struct {
+		name    string
+		opts    Options
+		content string
+		summary string
+		// wantSummaries is the number of chunks summarized in all the rounds.
+		wantSummaries int
+		// wantContent is the content sent along with the description prompt.
+		wantContent string
+	}{
+		{
+			name:        "fits",
+			opts:        opts,
+			content:     lines(1, 39),
+			wantContent: lines(1, 39),
+		},
+		{
+			name:        "no limit",
+			opts:        Options{},
+			content:     lines(100, 39),
+			wantContent: lines(100, 39),
+		},
+		{
+			name:          "one round",
+			opts:          opts,
+			content:       lines(4, 39),
+			summary:       "short",
+			wantSummaries: 4,
+			wantContent:   "short\nshort\nshort\nshort",
+		},
+		{
+			// The summaries take half of the chunks in each round: 8, 4 and 2
+			// chunks are summarized.
+			name:          "three rounds",
+			opts:          opts,
+			content:       lines(8, 39),
+			summary:       strings.Repeat("s", 19),
+			wantSummaries: 8 + 4 + 2,
+			wantContent:   strings.Repeat("s", 19) + "\n" + strings.Repeat("s", 19),
+		},
+		{
+			// The summaries never fit, the first one is used after the last
+			// round.
+			name:          "truncated after the last round",
+			opts:          opts,
+			content:       lines(3, 39),
+			summary:       strings.Repeat("s", 39),
+			wantSummaries: 3 * maxSummaryRounds,
+			wantContent:   strings.Repeat("s", 39),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var queries []string
+			description, err := tt.opts.summarize(tt.content, func(query string) (string, error) {
+				queries = append(queries, query)
+				if strings.HasPrefix(query, ChunkPrompt) {
+					return tt.summary, nil
+				}
+				return "A description.", nil
+			})
+			if err != nil {
+				t.Fatalf("summarize() failed: %v", err)
+			}
+			if description != "A description." {
+				t.Errorf("summarize() = %q, want the description", description)
+			}
+
+			if len(queries) != tt.wantSummaries+1 {
+				t.Fatalf("got %d queries, want %d summaries and the description",
+					len(queries), tt.wantSummaries)
+			}
+			for _, query := range queries[:tt.wantSummaries] {
+				chunk, ok := strings.CutPrefix(query, ChunkPrompt+"\n\n```")
+				if !ok {
+					t.Fatalf("query = %q, want a chunk to summarize", query)
+				}
+				chunk = strings.TrimSuffix(chunk, "\n```")
+				if len(chunk) > tt.opts.maxInputChars() {
+					t.Errorf("chunk of %d characters exceeds the budget", len(chunk))
+				}
+			}
+			if want := tt.opts.descriptionQuery(tt.wantContent); queries[len(queries)-1] != want {
+				t.Errorf("description query = %q, want %q", queries[len(queries)-1], want)
+			}
+		})
+	}
+}
+
+func TestSummarizeError(t *testing.T) {
+	opts := Options{AiMaxInputTokens: 10}
+	calls := 0
+	_, err := opts.summarize(lines(3, 39), func(query string) (string, error) {
+		calls++
+		if calls == 2 {
+			return "", errors.New("quota exceeded")
+		}
+		return "summary", nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "part 2 of 3") ||
+		!strings.Contains(err.Error(), "quota exceeded") {
+		t.Errorf("summarize() = %v, want the error of the second part", err)
+	}
+	if calls != 2 {
+		t.Errorf("got %d calls, want none after the error", calls)
+	}
+}
@@ -0,0 +1,223 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package alttext stores the alt text of the images, keyed by the hash of the
+// image content. The file is meant to be edited by the authors, the entries
+// override the generated alt text.
+package alttext
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// File maps the hashes of the images to their alt text.
+type File struct {
+	Images map[string]*Entry `yaml:"images"`
+
+	path string
+	// added are the entries set since the file was last saved. Only these are
+	// written, so that the edits of the authors are kept.
+	added map[string]*Entry
+	mu    sync.Mutex
+}
+
+// Entry is the alt text of a single image.
+type Entry struct {
+	Text string `yaml:"text"`
+	// Url is where the image was last published, it helps to find the entry
+	// of an image.
+	Url string `yaml:"url,omitempty"`
+}
+
+// Load reads the alt text from the provided path. A missing file results in
+// no entries.
+func Load(path string) (*File, error) {
+	images, err := read(path)
+	if err != nil {
+		return nil, err
+	}
+	return &File{Images: images, path: path, added: map[string]*Entry{}}, nil
+}
+
+// Reload reads the entries again, so that the edits made since the file was
+// loaded take effect. The entries added since it was saved are kept, unless
+// the file has entries of the same images.
+func (f *File) Reload() error {
+	images, err := read(f.path)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for hash, entry := range f.added {
+		if _, ok := images[hash]; !ok {
+			images[hash] = entry
+		}
+	}
+	f.Images = images
+	return nil
+}
+
+func read(path string) (map[string]*Entry, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]*Entry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var f File
+	if err := yaml.Unmarshal(content, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse alt text %s: %v", path, err)
+	}
+	if f.Images == nil {
+		f.Images = map[string]*Entry{}
+	}
+	return f.Images, nil
+}
+
+// Save adds the entries set since the last save to the file. The file is read
+// again first, the entries edited in the meantime are kept as they are, along
+// with the comments and the order of the entries.
+func (f *File) Save() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(f.added) == 0 {
+		return nil
+	}
+
+	content, err := os.ReadFile(f.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return fmt.Errorf("failed to parse alt text %s: %v", f.path, err)
+	}
+	images, err := imagesNode(&doc)
+	if err != nil {
+		return fmt.Errorf("failed to parse alt text %s: %v", f.path, err)
+	}
+
+	existing := map[string]bool{}
+	for i := 0; i+1 < len(images.Content); i += 2 {
+		existing[images.Content[i].Value] = true
+	}
+	var hashes []string
+	for hash := range f.added {
+		if !existing[hash] {
+			hashes = append(hashes, hash)
+		}
+	}
+	// Sorted like the entries written by the YAML encoder.
+	slices.Sort(hashes)
+	for _, hash := range hashes {
+		value := &yaml.Node{}
+		if err := value.Encode(f.added[hash]); err != nil {
+			return err
+		}
+		images.Content = append(images.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Value: hash}, value)
+	}
+
+	if content, err = yaml.Marshal(&doc); err != nil {
+		return err
+	}
+	if dir := filepath.Dir(f.path); dir != "." {
+		if err := os.MkdirAll(dir, 0o750); err != nil {
+			return err
+		}
+	}
+
+	tmpPath := f.path + ".tmp"
+	if err := os.WriteFile(tmpPath, content, 0o640); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, f.path); err != nil {
+		return err
+	}
+
+	var saved File
+	if err := doc.Decode(&saved); err != nil {
+		return err
+	}
+	if saved.Images != nil {
+		f.Images = saved.Images
+	}
+	f.added = map[string]*Entry{}
+	return nil
+}
+
+// imagesNode returns the mapping of the images in the document, it's added if
+// missing.
+func imagesNode(doc *yaml.Node) (*yaml.Node, error) {
+	// Empty files have no document node.
+	if doc.Kind == 0 {
+		doc.Kind = yaml.DocumentNode
+		doc.Content = []*yaml.Node{{Kind: yaml.MappingNode}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("line %d: expected a mapping", root.Line)
+	}
+
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value != "images" {
+			continue
+		}
+		images := root.Content[i+1]
+		// "images:" without entries is null.
+		if images.Kind == yaml.ScalarNode && images.ShortTag() == "!!null" {
+			*images = yaml.Node{Kind: yaml.MappingNode}
+		}
+		if images.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("line %d: expected a mapping of images", images.Line)
+		}
+		return images, nil
+	}
+
+	images := &yaml.Node{Kind: yaml.MappingNode}
+	root.Content = append(root.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Value: "images"}, images)
+	return images, nil
+}
+
+// Get returns the entry of the image with the provided hash, if any.
+func (f *File) Get(hash string) (*Entry, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	entry, ok := f.Images[hash]
+	return entry, ok
+}
+
+// Set records the entry of the image with the provided hash.
+func (f *File) Set(hash string, entry *Entry) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.Images[hash] = entry
+	f.added[hash] = entry
+}
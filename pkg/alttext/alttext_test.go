@@ -0,0 +1,148 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alttext
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadMissing(t *testing.T) {
+	f, err := Load(filepath.Join(t.TempDir(), "alt-text.yaml"))
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if len(f.Images) != 0 {
+		t.Errorf("Images = %v, want none", f.Images)
+	}
+	// Nothing was added, so nothing is written.
+	if err := f.Save(); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+	if _, err := os.Stat(f.path); !os.IsNotExist(err) {
+		t.Errorf("file exists, want it not written: %v", err)
+	}
+}
+
+func TestSaveKeepsEdits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".docblog", "alt-text.yaml")
+	f, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Set("aaa", &Entry{Text: "A generated text", Url: "/a.png"})
+	if err := f.Save(); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+
+	// The author edits the file while the entries are in memory.
+	edited := "# Reviewed by hand\n" +
+		"images:\n" +
+		"    aaa:\n" +
+		"        text: A better text # fixed the wording\n" +
+		"        url: /a.png\n" +
+		"    zzz:\n" +
+		"        text: Added by hand\n"
+	if err := os.WriteFile(path, []byte(edited), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	f.Set("bbb", &Entry{Text: "Another generated text", Url: "/b.png"})
+	// Entries also in the file are not overwritten.
+	f.Set("zzz", &Entry{Text: "Generated again"})
+	if err := f.Save(); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := edited +
+		"    bbb:\n" +
+		"        text: Another generated text\n" +
+		"        url: /b.png\n"
+	if string(content) != want {
+		t.Errorf("file =\n%s\nwant:\n%s", content, want)
+	}
+	for hash, text := range map[string]string{
+		"aaa": "A better text",
+		"bbb": "Another generated text",
+		"zzz": "Added by hand",
+	} {
+		if entry, ok := f.Get(hash); !ok || entry.Text != text {
+			t.Errorf("Get(%q) = %v, want %q", hash, entry, text)
+		}
+	}
+}
+
+func TestReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "alt-text.yaml")
+	if err := os.WriteFile(path, []byte("images:\n  aaa:\n    text: First\n"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	f, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Set("bbb", &Entry{Text: "Not saved yet"})
+
+	if err := os.WriteFile(path, []byte("images:\n  aaa:\n    text: Edited\n"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Reload(); err != nil {
+		t.Fatalf("Reload() failed: %v", err)
+	}
+	if entry, _ := f.Get("aaa"); entry == nil || entry.Text != "Edited" {
+		t.Errorf("Get(aaa) = %v, want the edited text", entry)
+	}
+	// The entries that were not saved are kept for the next save.
+	if entry, _ := f.Get("bbb"); entry == nil || entry.Text != "Not saved yet" {
+		t.Errorf("Get(bbb) = %v, want the added entry", entry)
+	}
+	if err := f.Save(); err != nil {
+		t.Fatal(err)
+	}
+	content, _ := os.ReadFile(path)
+	if !strings.Contains(string(content), "text: Edited") ||
+		!strings.Contains(string(content), "text: Not saved yet") {
+		t.Errorf("file = %s, want the edit and the added entry", content)
+	}
+}
+
+func TestSaveEmptyImages(t *testing.T) {
+	for _, content := range []string{"", "# No entries\n", "images:\n"} {
+		path := filepath.Join(t.TempDir(), "alt-text.yaml")
+		if err := os.WriteFile(path, []byte(content), 0o640); err != nil {
+			t.Fatal(err)
+		}
+		f, err := Load(path)
+		if err != nil {
+			t.Fatalf("Load(%q) failed: %v", content, err)
+		}
+		f.Set("aaa", &Entry{Text: "Text"})
+		if err := f.Save(); err != nil {
+			t.Fatalf("Save() of %q failed: %v", content, err)
+		}
+		g, err := Load(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry, _ := g.Get("aaa"); entry == nil || entry.Text != "Text" {
+			t.Errorf("saved %q gives %v, want the entry", content, g.Images)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// numberedLines returns the lines from 1 to n, with the provided lines
+// replaced.
+func numberedLines(n int, replaced map[int]string) string {
+	var sb strings.Builder
+	for i := 1; i <= n; i++ {
+		if line, ok := replaced[i]; ok {
+			sb.WriteString(line + "\n")
+		} else {
+			fmt.Fprintf(&sb, "%d\n", i)
+		}
+	}
+	return sb.String()
+}
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name    string
+		oldText string
+		newText string
+		want    string
+	}{
+		{
+			name:    "identical",
+			oldText: "a\nb\n",
+			newText: "a\nb\n",
+			want:    "",
+		},
+		{
+			name:    "both empty",
+			oldText: "",
+			newText: "",
+			want:    "",
+		},
+		{
+			name:    "empty old",
+			oldText: "",
+			newText: "a\nb\n",
+			want:    "@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name:    "empty new",
+			oldText: "a\nb\n",
+			newText: "",
+			want:    "@@ -1,2 +0,0 @@\n-a\n-b\n",
+		},
+		{
+			name:    "newline added at end of file",
+			oldText: "a\nb",
+			newText: "a\nb\n",
+			want:    "@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n",
+		},
+		{
+			name:    "newline removed at end of file",
+			oldText: "a\nb\n",
+			newText: "a\nb",
+			want:    "@@ -1,2 +1,2 @@\n a\n-b\n+b\n\\ No newline at end of file\n",
+		},
+		{
+			name:    "last line changed without newline",
+			oldText: "a\nb",
+			newText: "a\nc",
+			want: "@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n" +
+				"+c\n\\ No newline at end of file\n",
+		},
+		{
+			name:    "unchanged last line without newline",
+			oldText: "a\nb\nc",
+			newText: "x\nb\nc",
+			want:    "@@ -1,3 +1,3 @@\n-a\n+x\n b\n c\n\\ No newline at end of file\n",
+		},
+		{
+			// The shortest edit script keeps the common lines in the middle.
+			name:    "common lines",
+			oldText: "a\nb\nc\nd\ne\n",
+			newText: "x\nb\nc\nd\ny\n",
+			want:    "@@ -1,5 +1,5 @@\n-a\n+x\n b\n c\n d\n-e\n+y\n",
+		},
+		{
+			name:    "context",
+			oldText: numberedLines(10, nil),
+			newText: numberedLines(10, map[int]string{5: "five"}),
+			want:    "@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n",
+		},
+		{
+			name:    "insertion",
+			oldText: numberedLines(10, nil),
+			newText: strings.Replace(numberedLines(10, nil), "5\n", "5\nnew\n", 1),
+			want:    "@@ -3,6 +3,7 @@\n 3\n 4\n 5\n+new\n 6\n 7\n 8\n",
+		},
+		{
+			name:    "deletion at start",
+			oldText: numberedLines(10, nil),
+			newText: strings.TrimPrefix(numberedLines(10, nil), "1\n"),
+			want:    "@@ -1,4 +1,3 @@\n-1\n 2\n 3\n 4\n",
+		},
+		{
+			// Six unchanged lines are exactly the context of both changes.
+			name:    "hunks merged at the context boundary",
+			oldText: numberedLines(20, nil),
+			newText: numberedLines(20, map[int]string{3: "three", 10: "ten"}),
+			want: "@@ -1,13 +1,13 @@\n 1\n 2\n-3\n+three\n 4\n 5\n 6\n 7\n 8\n 9\n" +
+				"-10\n+ten\n 11\n 12\n 13\n",
+		},
+		{
+			name:    "hunks separated past the context boundary",
+			oldText: numberedLines(20, nil),
+			newText: numberedLines(20, map[int]string{3: "three", 11: "eleven"}),
+			want: "@@ -1,6 +1,6 @@\n 1\n 2\n-3\n+three\n 4\n 5\n 6\n" +
+				"@@ -8,7 +8,7 @@\n 8\n 9\n 10\n-11\n+eleven\n 12\n 13\n 14\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := tt.want
+			if want != "" {
+				want = "--- old\n+++ new\n" + want
+			}
+			if got := Unified("old", "new", tt.oldText, tt.newText); got != want {
+				t.Errorf("Unified() =\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
+
+// patchLine is a line of a hunk, without the trailing line break if the
+// diff marks it as missing.
+type patchLine struct {
+	kind byte
+	text string
+}
+
+// applyPatch applies the unified diff to the text.
+func applyPatch(t *testing.T, text string, patch string) string {
+	t.Helper()
+	lines := splitLines(text)
+	var out []string
+	pos := 0
+
+	patchLines := strings.SplitAfter(patch, "\n")
+	if len(patchLines) < 2 || !strings.HasPrefix(patchLines[0], "--- ") ||
+		!strings.HasPrefix(patchLines[1], "+++ ") {
+		t.Fatalf("missing diff header in:\n%s", patch)
+	}
+	patchLines = patchLines[2:]
+
+	for i := 0; i < len(patchLines) && patchLines[i] != ""; {
+		header := strings.TrimSuffix(patchLines[i], "\n")
+		var oldRange, newRange string
+		if _, err := fmt.Sscanf(header, "@@ -%s +%s @@", &oldRange, &newRange); err != nil {
+			t.Fatalf("invalid hunk header %q: %v", header, err)
+		}
+		start, count := parseRange(t, oldRange)
+		// Empty ranges refer to the line before them.
+		if count == 0 {
+			start++
+		}
+		if start-1 < pos || start-1 > len(lines) {
+			t.Fatalf("hunk %q out of order", header)
+		}
+		out = append(out, lines[pos:start-1]...)
+		pos = start - 1
+
+		var hunk []patchLine
+		for i++; i < len(patchLines) && patchLines[i] != "" &&
+			!strings.HasPrefix(patchLines[i], "@@"); i++ {
+			line := patchLines[i]
+			if strings.HasPrefix(line, `\`) {
+				last := &hunk[len(hunk)-1]
+				last.text = strings.TrimSuffix(last.text, "\n")
+				continue
+			}
+			hunk = append(hunk, patchLine{line[0], line[1:]})
+		}
+
+		for _, line := range hunk {
+			if line.kind != '+' {
+				if pos >= len(lines) || lines[pos] != line.text {
+					t.Fatalf("hunk %q doesn't match line %d", header, pos+1)
+				}
+				pos++
+			}
+			if line.kind != '-' {
+				out = append(out, line.text)
+			}
+		}
+	}
+	out = append(out, lines[pos:]...)
+	return strings.Join(out, "")
+}
+
+func parseRange(t *testing.T, r string) (int, int) {
+	t.Helper()
+	start, count, ok := strings.Cut(r, ",")
+	if !ok {
+		count = "1"
+	}
+	s, err := strconv.Atoi(start)
+	if err != nil {
+		t.Fatalf("invalid range %q", r)
+	}
+	c, err := strconv.Atoi(count)
+	if err != nil {
+		t.Fatalf("invalid range %q", r)
+	}
+	return s, c
+}
+
+// randomText returns lines drawn from a small set, so that the texts share
+// many lines.
+func randomText(r *rand.Rand) string {
+	var sb strings.Builder
+	for range r.IntN(30) {
+		fmt.Fprintf(&sb, "line %d\n", r.IntN(6))
+	}
+	text := sb.String()
+	if text != "" && r.IntN(4) == 0 {
+		text = strings.TrimSuffix(text, "\n")
+	}
+	return text
+}
+
+func TestUnifiedApplies(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	for range 500 {
+		oldText, newText := randomText(r), randomText(r)
+		patch := Unified("old", "new", oldText, newText)
+		if oldText == newText {
+			if patch != "" {
+				t.Errorf("Unified() of identical texts = %q, want empty", patch)
+			}
+			continue
+		}
+		if got := applyPatch(t, oldText, patch); got != newText {
+			t.Fatalf("applying the diff of %q and %q gives %q:\n%s",
+				oldText, newText, got, patch)
+		}
+	}
+}
+
+func TestUnifiedMaxEdits(t *testing.T) {
+	// Texts differing more than maxEdits lines are shown as replaced.
+	var oldLines, newLines strings.Builder
+	for i := range maxEdits {
+		fmt.Fprintf(&oldLines, "old %d\n", i)
+		fmt.Fprintf(&newLines, "new %d\n", i)
+	}
+	oldText := "common\n" + oldLines.String()
+	newText := "common\n" + newLines.String()
+	patch := Unified("old", "new", oldText, newText)
+	if got := applyPatch(t, oldText, patch); got != newText {
+		t.Fatalf("applying the diff gives a different text")
+	}
+	if got := strings.Count(patch, "@@ -"); got != 1 {
+		t.Errorf("got %d hunks, want 1", got)
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"slices"
+	"sync"
+	"time"
+
+	"google.golang.org/api/drive/v3"
+)
+
+const GoogleChangeFields = "nextPageToken, newStartPageToken, " +
+	"changes(fileId, removed, file(id, mimeType, parents, trashed))"
+
+// Changes are the changes to the files of the blog directory since a cursor.
+type Changes struct {
+	// DocIds are the IDs of the changed documents, including the ones that
+	// were added, removed or moved out of the blog directory.
+	DocIds []string
+	// Other is set if other files of the blog directory changed, e.g. the
+	// "index" sheet or a subdirectory, which may affect any document.
+	Other bool
+	// PageToken is the cursor of the changes made afterwards.
+	PageToken string
+}
+
+// fileTree contains the files listed by the last ListGoogleDocs call, so that
+// the changes outside of the blog directory can be ignored.
+type fileTree struct {
+	mu sync.Mutex
+	// mimeTypes are the types of the listed files by their ID, including the
+	// blog directory and its subdirectories.
+	mimeTypes map[string]string
+}
+
+func (t *fileTree) reset(rootId string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.mimeTypes = map[string]string{rootId: GoogleFolderMimeType}
+}
+
+func (t *fileTree) add(fileId string, mimeType string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.mimeTypes[fileId] = mimeType
+}
+
+// mimeType returns the type of the file if it belongs to the tree, either
+// because it was listed or because it's in one of the listed directories.
+func (t *fileTree) mimeType(change *drive.Change) (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if mimeType, ok := t.mimeTypes[change.FileId]; ok {
+		return mimeType, true
+	}
+	if change.File == nil {
+		return "", false
+	}
+	inTree := slices.ContainsFunc(change.File.Parents, func(parentId string) bool {
+		return t.mimeTypes[parentId] == GoogleFolderMimeType
+	})
+	return change.File.MimeType, inTree
+}
+
+// GetStartPageToken returns the cursor of the changes made from now on.
+func (ds *DriveService) GetStartPageToken() (string, error) {
+	var token string
+	err := ds.callDrive(func() (err error) {
+		token, err = ds.files.GetStartPageToken(ds.ctx)
+		return err
+	})
+	return token, err
+}
+
+// ListChanges returns the changes to the files of the blog directory since the
+// cursor. The directory is the one listed by the last ListGoogleDocs call,
+// nothing is reported before the first one.
+func (ds *DriveService) ListChanges(pageToken string) (*Changes, error) {
+	changes := &Changes{}
+	for {
+		var changeList *drive.ChangeList
+		err := ds.callDrive(func() (err error) {
+			changeList, err = ds.files.ListChanges(ds.ctx, pageToken, GoogleChangeFields)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, change := range changeList.Changes {
+			mimeType, ok := ds.tree.mimeType(change)
+			if !ok {
+				continue
+			}
+			if mimeType != GoogleDocMimeType {
+				changes.Other = true
+			} else if !slices.Contains(changes.DocIds, change.FileId) {
+				changes.DocIds = append(changes.DocIds, change.FileId)
+			}
+		}
+
+		if changeList.NewStartPageToken != "" {
+			changes.PageToken = changeList.NewStartPageToken
+			return changes, nil
+		}
+		pageToken = changeList.NextPageToken
+	}
+}
+
+// WatchChanges opens a channel delivering the notifications of the changes
+// made since the cursor to the HTTPS address. The notifications carry the
+// token, so that forged ones can be told apart. The channel expires after the
+// TTL, Google Drive may shorten it though.
+func (ds *DriveService) WatchChanges(
+	pageToken string,
+	address string,
+	token string,
+	ttl time.Duration,
+) (*drive.Channel, error) {
+	channelId, err := RandomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	// Opening the channel is not retried, a channel opened by a request that
+	// seemingly failed would be left behind.
+	if err := ds.driveLimiter.Wait(ds.ctx); err != nil {
+		return nil, err
+	}
+	return ds.files.WatchChanges(ds.ctx, pageToken, &drive.Channel{
+		Id:         channelId,
+		Type:       "web_hook",
+		Address:    address,
+		Token:      token,
+		Expiration: time.Now().Add(ttl).UnixMilli(),
+	})
+}
+
+// StopChannel stops the notifications of the channel.
+func (ds *DriveService) StopChannel(channel *drive.Channel) error {
+	return ds.callDrive(func() error {
+		return ds.files.StopChannel(ds.ctx, &drive.Channel{
+			Id:         channel.Id,
+			ResourceId: channel.ResourceId,
+		})
+	})
+}
+
+// RandomToken returns a random hex-encoded string, e.g. to be used as the ID
+// or the token of a channel.
+func RandomToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
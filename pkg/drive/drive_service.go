@@ -21,18 +21,27 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"path"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/google/docblog/pkg/retry"
+	"golang.org/x/time/rate"
 	"google.golang.org/api/drive/v3"
 	"google.golang.org/api/option"
 	"google.golang.org/api/sheets/v4"
 )
 
 const (
-	GoogleDocListFields = "nextPageToken, files(id, createdTime, modifiedTime, name)"
+	GoogleDocListFields = "nextPageToken, files(id, createdTime, modifiedTime, name, mimeType)"
 	GoogleDocListQuery  = "'%s' in parents and trashed=false and " +
 		"mimeType='application/vnd.google-apps.document'"
+	GoogleDocTreeListQuery = "'%s' in parents and trashed=false and (" +
+		"mimeType='application/vnd.google-apps.document' or " +
+		"mimeType='application/vnd.google-apps.folder')"
+	GoogleDocMimeType    = "application/vnd.google-apps.document"
+	GoogleFolderMimeType = "application/vnd.google-apps.folder"
 
 	GoogleSheetDayFormat      = "02/01/2006"
 	GoogleSheetIndexListQuery = "'%s' in parents and trashed=false and " +
@@ -42,6 +51,28 @@ const (
 	JekyllPostDateFormat = "2006-01-02"
 )
 
+// Publication statuses of the documents, selected in the "index" sheet.
+const (
+	StatusDraft     = "Draft"
+	StatusPublished = "Published"
+	StatusUnlisted  = "Unlisted"
+)
+
+// Indices of the columns in the "index" sheet.
+const (
+	idColumn = iota
+	nameColumn
+	dateColumn
+	lastModifiedColumn
+	descriptionColumn
+	statusColumn
+	tagsColumn
+	categoriesColumn
+	slugColumn
+	redirectFromColumn
+	suggestedTagsColumn
+)
+
 // GoogleSheetIndexColumnMetadata defines the metadata
 // for the columns in the "index" sheet.
 var GoogleSheetIndexColumnMetadata = [...]configColumnMetadata{
@@ -50,6 +81,12 @@ var GoogleSheetIndexColumnMetadata = [...]configColumnMetadata{
 	{"Date", 100},
 	{"Last modified", 100},
 	{"Description", 800},
+	{"Status", 100},
+	{"Tags", 300},
+	{"Categories", 300},
+	{"Slug", 300},
+	{"Redirect from", 300},
+	{"Suggested tags", 300},
 }
 
 var (
@@ -62,28 +99,81 @@ var (
 			Type:    "DATE",
 		},
 	}
+	StatusValidation = sheets.DataValidationRule{
+		Condition: &sheets.BooleanCondition{
+			Type: "ONE_OF_LIST",
+			Values: []*sheets.ConditionValue{
+				{UserEnteredValue: StatusDraft},
+				{UserEnteredValue: StatusPublished},
+				{UserEnteredValue: StatusUnlisted},
+			},
+		},
+		ShowCustomUi: true,
+		Strict:       true,
+	}
 )
 
 // DriveService provides methods to interact with Google Drive
 // and Google Sheets.
 type DriveService struct {
-	driveSrv *drive.Service
-	sheetSrv *sheets.Service
+	ctx    context.Context
+	files  FileStore
+	sheets SheetStore
+
+	// Limiters are shared by all the requests, which may be sent
+	// concurrently, to stay within the API quotas.
+	driveLimiter *rate.Limiter
+	sheetLimiter *rate.Limiter
+	// retry controls how the failed requests are retried.
+	retry retry.Policy
+	// tree contains the files of the blog directory, see ListChanges.
+	tree fileTree
+}
+
+// LimitOptions control the rate of requests sent to Google Drive and Google
+// Sheets.
+type LimitOptions struct {
+	DriveQps  float64 `arg:"--drive-qps,env:DOCBLOG_DRIVE_QPS" default:"10" help:"maximum number of Google Drive requests per second"`
+	SheetsQps float64 `arg:"--sheets-qps,env:DOCBLOG_SHEETS_QPS" default:"1" help:"maximum number of Google Sheets requests per second"`
+}
+
+// ListOptions control which Google Documents are listed.
+type ListOptions struct {
+	Recursive      bool     `arg:"--recursive,env:DOCBLOG_RECURSIVE" help:"list documents in subdirectories too"`
+	ExcludeFolders []string `arg:"--exclude-folder,separate,env:DOCBLOG_EXCLUDE_FOLDERS" help:"subdirectory to skip, either a name (drafts) or a path (travel/drafts)"`
 }
 
 // GoogleDocMetadata represents the metadata of a Google Document.
 type GoogleDocMetadata struct {
 	ModifiedTime time.Time `json:"-" yaml:"-"`
 
+	// Folder is the path of the directory containing the document, relative
+	// to the blog directory, e.g. "travel/japan".
+	Folder string `json:"folder,omitempty" yaml:"folder,omitempty"`
+
 	CreatedTime time.Time `json:"date" yaml:"date"`
 	Description string    `json:"excerpt" yaml:"excerpt"`
 	Id          string    `json:"google_doc_id" yaml:"google_doc_id"`
 	Name        string    `json:"title" yaml:"title"`
+	Status      string    `json:"status,omitempty" yaml:"status,omitempty"`
+	Tags        []string  `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Categories  []string  `json:"categories,omitempty" yaml:"categories,omitempty"`
+
+	// Slug is the normalized name used in the post file name and URL. It's
+	// derived from the title on the first sync and stays the same afterwards,
+	// unless modified in the "index" sheet.
+	Slug string `json:"slug,omitempty" yaml:"slug,omitempty"`
+	// RedirectFrom contains the previous slugs of the document.
+	RedirectFrom []string `json:"redirect_from,omitempty" yaml:"redirect_from,omitempty"`
+
+	// SuggestedTags are generated for the editors to review, they don't affect
+	// the post until copied to the tags.
+	SuggestedTags []string `json:"-" yaml:"-"`
 }
 
 // Google Documents can be exported to a zipped HTML file with all the assets
-// included. unzippedFile represents a file extracted from such archive.
-type unzippedFile struct {
+// included. UnzippedFile represents a file extracted from such archive.
+type UnzippedFile struct {
 	Name    string
 	Content []byte
 }
@@ -97,6 +187,8 @@ type configColumnMetadata struct {
 func NewDriveService(
 	ctx context.Context,
 	opts []option.ClientOption,
+	limits LimitOptions,
+	policy retry.Policy,
 ) (*DriveService, error) {
 	driveSrv, err := drive.NewService(ctx, opts...)
 	if err != nil {
@@ -106,30 +198,82 @@ func NewDriveService(
 	if err != nil {
 		return nil, err
 	}
-	return &DriveService{driveSrv: driveSrv, sheetSrv: sheetSrv}, nil
+	return NewDriveServiceWithStores(ctx,
+		googleFileStore{driveSrv}, googleSheetStore{sheetSrv}, limits, policy), nil
+}
+
+// NewDriveServiceWithStores returns a DriveService sending the requests to the
+// provided stores, e.g. in-memory fakes.
+func NewDriveServiceWithStores(
+	ctx context.Context,
+	files FileStore,
+	sheetStore SheetStore,
+	limits LimitOptions,
+	policy retry.Policy,
+) *DriveService {
+	return &DriveService{
+		ctx:          ctx,
+		files:        files,
+		sheets:       sheetStore,
+		driveLimiter: NewLimiter(limits.DriveQps),
+		sheetLimiter: NewLimiter(limits.SheetsQps),
+		retry:        policy,
+	}
+}
+
+// NewLimiter returns a token bucket limiter allowing the provided number of
+// requests per second, with bursts of up to a second worth of requests. Zero
+// or negative rates disable the limit.
+func NewLimiter(qps float64) *rate.Limiter {
+	if qps <= 0 {
+		return rate.NewLimiter(rate.Inf, 0)
+	}
+	return rate.NewLimiter(rate.Limit(qps), max(1, int(qps)))
 }
 
+// ListGoogleDocs lists the Google Documents in the provided Google Drive
+// directory. Subdirectories are visited only if requested in the options.
 func (ds *DriveService) ListGoogleDocs(
 	driveDirId string,
+	opts ListOptions,
 ) ([]*GoogleDocMetadata, error) {
-	fileList, err := ds.listGoogleDocs(driveDirId, "")
-	if err != nil {
-		return nil, err
+	ds.tree.reset(driveDirId)
+	return ds.listGoogleDocs(driveDirId, "", opts)
+}
+
+func (ds *DriveService) listGoogleDocs(
+	driveDirId string,
+	folder string,
+	opts ListOptions,
+) ([]*GoogleDocMetadata, error) {
+	query := GoogleDocListQuery
+	if opts.Recursive {
+		query = GoogleDocTreeListQuery
 	}
 
-	files := fileList.Files
-	pageToken := fileList.NextPageToken
-	for pageToken != "" {
-		fileList, err = ds.listGoogleDocs(driveDirId, pageToken)
-		if err != nil {
-			return nil, err
-		}
-		files = append(files, fileList.Files...)
-		pageToken = fileList.NextPageToken
+	files, err := ds.listFiles(fmt.Sprintf(query, driveDirId))
+	if err != nil {
+		return nil, err
 	}
 
 	driveFiles := []*GoogleDocMetadata{}
 	for _, file := range files {
+		if file.MimeType == GoogleFolderMimeType {
+			subfolder := path.Join(folder, file.Name)
+			if opts.isExcluded(subfolder) {
+				log.Printf("Skipping excluded directory: %s\n", subfolder)
+				continue
+			}
+			ds.tree.add(file.Id, file.MimeType)
+
+			subfolderFiles, err := ds.listGoogleDocs(file.Id, subfolder, opts)
+			if err != nil {
+				return driveFiles, err
+			}
+			driveFiles = append(driveFiles, subfolderFiles...)
+			continue
+		}
+
 		createdDate, err := time.Parse(time.RFC3339, file.CreatedTime)
 		if err != nil {
 			return driveFiles, err
@@ -140,11 +284,15 @@ func (ds *DriveService) ListGoogleDocs(
 			return driveFiles, err
 		}
 
+		ds.tree.add(file.Id, file.MimeType)
 		driveFiles = append(driveFiles, &GoogleDocMetadata{
 			CreatedTime:  createdDate,
 			ModifiedTime: modifiedDate,
+			Folder:       folder,
 			Id:           file.Id,
 			Name:         file.Name,
+			Slug:         DefaultSlug(file.Name),
+			Status:       StatusPublished,
 		})
 	}
 
@@ -161,7 +309,25 @@ func (ds *DriveService) GetIndexSheet(
 	if err != nil {
 		return nil, fmt.Errorf("error getting or creating index sheet: %w", err)
 	}
+	return parseIndexSheet(sheet), nil
+}
+
+// FindIndexSheet retrieves the "index" sheet grid data like GetIndexSheet, but
+// never creates the sheet. A missing sheet results in no metadata.
+func (ds *DriveService) FindIndexSheet(
+	driveDirId string,
+) (map[string]GoogleDocMetadata, error) {
+	sheet, err := ds.findIndexSheet(driveDirId)
+	if err != nil {
+		return nil, fmt.Errorf("error getting index sheet: %w", err)
+	}
+	if sheet == nil {
+		return map[string]GoogleDocMetadata{}, nil
+	}
+	return parseIndexSheet(sheet), nil
+}
 
+func parseIndexSheet(sheet *sheets.Spreadsheet) map[string]GoogleDocMetadata {
 	output := map[string]GoogleDocMetadata{}
 	rows := sheet.
 		Sheets[0].
@@ -176,7 +342,7 @@ func (ds *DriveService) GetIndexSheet(
 		}
 		output[metadata.Id] = metadata
 	}
-	return output, nil
+	return output
 }
 
 // UpdateIndexMetadata updates the "index" sheet grid data with the provided
@@ -190,7 +356,9 @@ func (ds *DriveService) UpdateIndexMetadata(
 		return fmt.Errorf("error getting or creating index sheet: %w", err)
 	}
 
-	var rows []*sheets.RowData
+	// The headers are written as well, so that columns added in newer versions
+	// of docblog show up in existing sheets.
+	rows := []*sheets.RowData{{Values: ds.getHeaders()}}
 	for _, fileMetadata := range metadata {
 		rows = append(rows, fileMetadata.ToRowData())
 	}
@@ -201,7 +369,7 @@ func (ds *DriveService) UpdateIndexMetadata(
 			Properties: &sheets.SheetProperties{
 				GridProperties: &sheets.GridProperties{
 					ColumnCount: int64(len(GoogleSheetIndexColumnMetadata)),
-					RowCount:    1 + int64(len(rows)),
+					RowCount:    int64(len(rows)),
 				},
 				SheetId: sheet.Sheets[0].Properties.SheetId,
 				Title:   GoogleSheetIndexTitle,
@@ -209,24 +377,24 @@ func (ds *DriveService) UpdateIndexMetadata(
 		},
 	}}
 
-	if rows != nil {
-		requests = append(requests, &sheets.Request{
-			UpdateCells: &sheets.UpdateCellsRequest{
-				Fields: "*",
-				Rows:   rows,
-				Start: &sheets.GridCoordinate{
-					SheetId:     sheet.Sheets[0].Properties.SheetId,
-					RowIndex:    1,
-					ColumnIndex: 0,
-				},
+	requests = append(requests, &sheets.Request{
+		UpdateCells: &sheets.UpdateCellsRequest{
+			Fields: "*",
+			Rows:   rows,
+			Start: &sheets.GridCoordinate{
+				SheetId:     sheet.Sheets[0].Properties.SheetId,
+				RowIndex:    0,
+				ColumnIndex: 0,
 			},
-		})
-	}
-
-	_, err = ds.sheetSrv.Spreadsheets.BatchUpdate(
-		sheet.SpreadsheetId, &sheets.BatchUpdateSpreadsheetRequest{
-			Requests: requests,
-		}).Do()
+		},
+	})
+
+	err = ds.callSheets(func() error {
+		return ds.sheets.BatchUpdate(ds.ctx,
+			sheet.SpreadsheetId, &sheets.BatchUpdateSpreadsheetRequest{
+				Requests: requests,
+			})
+	})
 	if err != nil {
 		return fmt.Errorf("error updating index metadata: %v", err)
 	}
@@ -235,29 +403,39 @@ func (ds *DriveService) UpdateIndexMetadata(
 
 func (ds *DriveService) ExportGoogleDocToZippedHtml(
 	file *GoogleDocMetadata,
-) ([]*unzippedFile, error) {
-	resp, err := ds.driveSrv.Files.Export(file.Id, "application/zip").Download()
+) ([]*UnzippedFile, error) {
+	body, err := ds.ExportGoogleDocToZip(file)
 	if err != nil {
 		return nil, err
 	}
+	return Unzip(body)
+}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
+// ExportGoogleDocToZip exports the Google Document to a zipped HTML file with
+// all the assets included.
+func (ds *DriveService) ExportGoogleDocToZip(file *GoogleDocMetadata) ([]byte, error) {
+	var body []byte
+	err := ds.callDrive(func() (err error) {
+		body, err = ds.files.ExportFile(ds.ctx, file.Id, "application/zip")
+		return err
+	})
+	return body, err
+}
 
+// Unzip extracts the files from the exported Google Document.
+func Unzip(body []byte) ([]*UnzippedFile, error) {
 	zipReader, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
 	if err != nil {
 		return nil, err
 	}
 
-	var unzippedFiles []*unzippedFile
+	var unzippedFiles []*UnzippedFile
 	for _, zipFile := range zipReader.File {
 		content, err := readZipFile(zipFile)
 		if err != nil {
 			return unzippedFiles, err
 		}
-		unzippedFiles = append(unzippedFiles, &unzippedFile{
+		unzippedFiles = append(unzippedFiles, &UnzippedFile{
 			Name:    zipFile.Name,
 			Content: content,
 		})
@@ -267,17 +445,42 @@ func (ds *DriveService) ExportGoogleDocToZippedHtml(
 }
 
 func (m1 *GoogleDocMetadata) UpdateWith(m2 GoogleDocMetadata) {
-	if !m2.CreatedTime.IsZero() {
+	// The sheet only keeps the day, the time of the document is kept unless
+	// the day was changed. Otherwise posts would be dated at midnight, and
+	// rewritten, on the run after the one that added them.
+	if !m2.CreatedTime.IsZero() && !sameDay(m1.CreatedTime, m2.CreatedTime) {
 		m1.CreatedTime = m2.CreatedTime
 	}
 	if m2.Description != "" {
 		m1.Description = m2.Description
 	}
+	if m2.Status != "" {
+		m1.Status = m2.Status
+	}
+	if len(m2.Tags) > 0 {
+		m1.Tags = m2.Tags
+	}
+	if len(m2.Categories) > 0 {
+		m1.Categories = m2.Categories
+	}
+	if m2.Slug != "" {
+		m1.Slug = m2.Slug
+	}
+	if len(m2.RedirectFrom) > 0 {
+		m1.RedirectFrom = m2.RedirectFrom
+	}
+	if len(m2.SuggestedTags) > 0 {
+		m1.SuggestedTags = m2.SuggestedTags
+	}
 }
 
 func (m *GoogleDocMetadata) ToRowData() *sheets.RowData {
 	docUrl := fmt.Sprintf("https://docs.google.com/document/d/%s", m.Id)
 	hyperlink := fmt.Sprintf("=HYPERLINK(\"%s\", \"%s\")", docUrl, m.Id)
+	tags := strings.Join(m.Tags, ", ")
+	categories := strings.Join(m.Categories, ", ")
+	redirectFrom := strings.Join(m.RedirectFrom, ", ")
+	suggestedTags := strings.Join(m.SuggestedTags, ", ")
 	createdDate := float64(
 		m.CreatedTime.Sub(GoogleSheetEpoch0).Hours() / 24)
 	modifiedDate := float64(
@@ -311,6 +514,15 @@ func (m *GoogleDocMetadata) ToRowData() *sheets.RowData {
 					WrapStrategy: "WRAP",
 				},
 			},
+			{
+				UserEnteredValue: &sheets.ExtendedValue{StringValue: &m.Status},
+				DataValidation:   &StatusValidation,
+			},
+			{UserEnteredValue: &sheets.ExtendedValue{StringValue: &tags}},
+			{UserEnteredValue: &sheets.ExtendedValue{StringValue: &categories}},
+			{UserEnteredValue: &sheets.ExtendedValue{StringValue: &m.Slug}},
+			{UserEnteredValue: &sheets.ExtendedValue{StringValue: &redirectFrom}},
+			{UserEnteredValue: &sheets.ExtendedValue{StringValue: &suggestedTags}},
 		},
 	}
 }
@@ -318,61 +530,215 @@ func (m *GoogleDocMetadata) ToRowData() *sheets.RowData {
 func (m *GoogleDocMetadata) ParseRowData(row *sheets.RowData) []error {
 	errors := []error{}
 
-	createdDate, err := time.Parse(GoogleSheetDayFormat, row.Values[2].FormattedValue)
+	createdDate, err := time.Parse(GoogleSheetDayFormat, cellValue(row, dateColumn))
 	if err != nil {
 		createdDate = time.Time{}
 		errors = append(errors, fmt.Errorf("error parsing created date: %w", err))
 	}
 
-	modifiedDate, err := time.Parse(GoogleSheetDayFormat, row.Values[3].FormattedValue)
+	modifiedDate, err := time.Parse(GoogleSheetDayFormat, cellValue(row, lastModifiedColumn))
 	if err != nil {
 		modifiedDate = time.Time{}
 		errors = append(errors, fmt.Errorf("error parsing modified date: %w", err))
 	}
 
-	m.Id = row.Values[0].FormattedValue
-	m.Name = row.Values[1].FormattedValue
+	m.Id = cellValue(row, idColumn)
+	m.Name = cellValue(row, nameColumn)
 	m.CreatedTime = createdDate
 	m.ModifiedTime = modifiedDate
 
-	if len(row.Values) >= len(GoogleSheetIndexColumnMetadata) {
-		m.Description = row.Values[4].FormattedValue
+	if len(row.Values) > descriptionColumn {
+		m.Description = cellValue(row, descriptionColumn)
 	} else {
 		errors = append(errors, fmt.Errorf("missing description value"))
 	}
 
+	// Columns added in later versions may be missing from older sheets, they
+	// will be added with the next update.
+	switch status := cellValue(row, statusColumn); status {
+	case "", StatusDraft, StatusPublished, StatusUnlisted:
+		m.Status = status
+	default:
+		errors = append(errors, fmt.Errorf("unknown status: %s", status))
+	}
+
+	m.Tags = splitList(cellValue(row, tagsColumn))
+	m.Categories = splitList(cellValue(row, categoriesColumn))
+	m.Slug = strings.TrimSpace(cellValue(row, slugColumn))
+	m.RedirectFrom = splitList(cellValue(row, redirectFromColumn))
+	m.SuggestedTags = splitList(cellValue(row, suggestedTagsColumn))
+
 	return errors
 }
 
-// FileName returns a normalized file name for the Google Document that is
-// compliant with Jekyll naming convention.
-func (m *GoogleDocMetadata) FileName() string {
+// ChangedColumns returns the names of the "index" sheet columns that differ
+// between the row of the document and the provided one, read from the sheet.
+func (m *GoogleDocMetadata) ChangedColumns(row *GoogleDocMetadata) []string {
+	values, rowValues := m.rowValues(), row.rowValues()
+
+	var columns []string
+	for i, column := range GoogleSheetIndexColumnMetadata {
+		if values[i] != rowValues[i] {
+			columns = append(columns, column.name)
+		}
+	}
+	return columns
+}
+
+// rowValues returns the values of the "index" sheet cells of the document, as
+// they are formatted in the sheet.
+func (m *GoogleDocMetadata) rowValues() []string {
+	day := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format(GoogleSheetDayFormat)
+	}
+
+	return []string{
+		idColumn:            m.Id,
+		nameColumn:          m.Name,
+		dateColumn:          day(m.CreatedTime),
+		lastModifiedColumn:  day(m.ModifiedTime),
+		descriptionColumn:   m.Description,
+		statusColumn:        m.Status,
+		tagsColumn:          strings.Join(m.Tags, ", "),
+		categoriesColumn:    strings.Join(m.Categories, ", "),
+		slugColumn:          m.Slug,
+		redirectFromColumn:  strings.Join(m.RedirectFrom, ", "),
+		suggestedTagsColumn: strings.Join(m.SuggestedTags, ", "),
+	}
+}
+
+// sameDay reports whether the times fall on the same day, as shown in the
+// "index" sheet.
+func sameDay(t1 time.Time, t2 time.Time) bool {
+	return t1.Format(GoogleSheetDayFormat) == t2.Format(GoogleSheetDayFormat)
+}
+
+// cellValue returns the formatted value of the cell in the provided column,
+// or an empty string if the row is too short.
+func cellValue(row *sheets.RowData, column int) string {
+	if column >= len(row.Values) {
+		return ""
+	}
+	return row.Values[column].FormattedValue
+}
+
+// FileName returns a normalized file name for the Google Document, without
+// the extension. The date prefix follows the Jekyll naming convention.
+func (m *GoogleDocMetadata) FileName(datePrefix bool) string {
 	var sb strings.Builder
 
-	if !m.CreatedTime.IsZero() {
+	if datePrefix && !m.CreatedTime.IsZero() {
 		sb.WriteString(m.CreatedTime.Format(JekyllPostDateFormat))
 		sb.WriteByte('-')
 	}
 
-	sb.WriteString(strings.ReplaceAll(m.Name, " ", "-"))
-	sb.WriteString(".html")
+	if m.Slug != "" {
+		sb.WriteString(m.Slug)
+	} else {
+		sb.WriteString(DefaultSlug(m.Name))
+	}
 
 	return sb.String()
 }
 
-func (ds *DriveService) listGoogleDocs(
-	driveDirId string,
-	pageToken string,
-) (*drive.FileList, error) {
-	call := ds.driveSrv.Files.List().
-		Fields(GoogleDocListFields).
-		Q(fmt.Sprintf(GoogleDocListQuery, driveDirId))
+// DefaultSlug returns the slug derived from the document title.
+func DefaultSlug(name string) string {
+	return strings.ReplaceAll(name, " ", "-")
+}
+
+// AddRedirectFrom keeps the previous slug of the document, so that its old URL
+// can be redirected.
+func (m *GoogleDocMetadata) AddRedirectFrom(slug string) {
+	if slug != m.Slug && !slices.Contains(m.RedirectFrom, slug) {
+		m.RedirectFrom = append(m.RedirectFrom, slug)
+	}
+}
+
+// listFiles returns all the files matching the query, across all pages.
+func (ds *DriveService) listFiles(query string) ([]*drive.File, error) {
+	var files []*drive.File
+
+	pageToken := ""
+	for {
+		var fileList *drive.FileList
+		err := ds.callDrive(func() (err error) {
+			fileList, err = ds.files.ListFiles(
+				ds.ctx, query, GoogleDocListFields, pageToken)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
 
-	if pageToken != "" {
-		call.PageToken(pageToken)
+		files = append(files, fileList.Files...)
+		if pageToken = fileList.NextPageToken; pageToken == "" {
+			return files, nil
+		}
+	}
+}
+
+// isExcluded reports whether the directory with the provided path should be
+// skipped. Exclusions without a slash match directories with that name at
+// any depth, the other ones match the path relative to the blog directory.
+func (opts ListOptions) isExcluded(folder string) bool {
+	for _, exclude := range opts.ExcludeFolders {
+		exclude = strings.Trim(exclude, "/")
+		if exclude == folder ||
+			(!strings.Contains(exclude, "/") && exclude == path.Base(folder)) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllCategories returns the categories of the document: the ones derived from
+// the path of its directory followed by the ones set in the "index" sheet.
+func (m *GoogleDocMetadata) AllCategories() []string {
+	var categories []string
+	if m.Folder != "" {
+		categories = strings.Split(m.Folder, "/")
+	}
+
+	for _, category := range m.Categories {
+		if !slices.Contains(categories, category) {
+			categories = append(categories, category)
+		}
+	}
+	return categories
+}
+
+// IsListed reports whether the post is published and may be linked, i.e. it's
+// neither a draft nor unlisted.
+func (m *GoogleDocMetadata) IsListed() bool {
+	return m.Status != StatusDraft && m.Status != StatusUnlisted
+}
+
+// AllTags returns the sorted tags used by any of the documents.
+func AllTags(metadata []*GoogleDocMetadata) []string {
+	var tags []string
+	for _, m := range metadata {
+		for _, tag := range m.Tags {
+			if !slices.Contains(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
 	}
+	slices.Sort(tags)
+	return tags
+}
 
-	return call.Do()
+// splitList splits comma-separated values of a cell, skipping empty ones.
+func splitList(value string) []string {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
 }
 
 func readZipFile(zf *zip.File) ([]byte, error) {
@@ -384,13 +750,17 @@ func readZipFile(zf *zip.File) ([]byte, error) {
 	return io.ReadAll(f)
 }
 
-func (ds *DriveService) getOrCreateIndexSheet(
+// findIndexSheet returns the "index" sheet of the directory, or nil if there
+// is none.
+func (ds *DriveService) findIndexSheet(
 	driveDirId string,
 ) (*sheets.Spreadsheet, error) {
-	fileList, err := ds.driveSrv.Files.List().
-		Fields("files(id)").
-		Q(fmt.Sprintf(GoogleSheetIndexListQuery, driveDirId)).
-		Do()
+	var fileList *drive.FileList
+	err := ds.callDrive(func() (err error) {
+		fileList, err = ds.files.ListFiles(ds.ctx,
+			fmt.Sprintf(GoogleSheetIndexListQuery, driveDirId), "files(id)", "")
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -400,45 +770,87 @@ func (ds *DriveService) getOrCreateIndexSheet(
 		return nil, fmt.Errorf("multiple index sheets found")
 	}
 	if len(files) == 0 {
-		sheet, err := ds.sheetSrv.Spreadsheets.Create(&sheets.Spreadsheet{
-			Properties: &sheets.SpreadsheetProperties{
-				Title: "index",
-			},
-			Sheets: []*sheets.Sheet{{
-				Data: []*sheets.GridData{{
-					ColumnMetadata: ds.getColumnMetadata(),
-					RowData: []*sheets.RowData{
-						{Values: ds.getHeaders()},
-					},
-				}},
-				Properties: &sheets.SheetProperties{
-					GridProperties: &sheets.GridProperties{
-						ColumnCount: int64(len(GoogleSheetIndexColumnMetadata)),
-						RowCount:    1,
-					},
-					Title: GoogleSheetIndexTitle,
+		return nil, nil
+	}
+	return ds.getSheet(files[0].Id)
+}
+
+func (ds *DriveService) getOrCreateIndexSheet(
+	driveDirId string,
+) (*sheets.Spreadsheet, error) {
+	sheet, err := ds.findIndexSheet(driveDirId)
+	if err != nil || sheet != nil {
+		return sheet, err
+	}
+
+	// Creating the sheet is not retried, as it's not idempotent. A sheet
+	// created by a request that seemingly failed would be duplicated.
+	if err := ds.sheetLimiter.Wait(ds.ctx); err != nil {
+		return nil, err
+	}
+	sheet, err = ds.sheets.CreateSpreadsheet(ds.ctx, &sheets.Spreadsheet{
+		Properties: &sheets.SpreadsheetProperties{
+			Title: "index",
+		},
+		Sheets: []*sheets.Sheet{{
+			Data: []*sheets.GridData{{
+				ColumnMetadata: ds.getColumnMetadata(),
+				RowData: []*sheets.RowData{
+					{Values: ds.getHeaders()},
 				},
 			}},
-		}).Do()
-		if err != nil {
-			return sheet, err
-		}
-
-		_, err = ds.driveSrv.Files.
-			Update(sheet.SpreadsheetId, nil).
-			AddParents(driveDirId).
-			Do()
-		if err != nil {
-			return sheet, err
-		}
+			Properties: &sheets.SheetProperties{
+				GridProperties: &sheets.GridProperties{
+					ColumnCount: int64(len(GoogleSheetIndexColumnMetadata)),
+					RowCount:    1,
+				},
+				Title: GoogleSheetIndexTitle,
+			},
+		}},
+	})
+	if err != nil {
+		return sheet, err
+	}
 
-		return ds.sheetSrv.Spreadsheets.
-			Get(sheet.SpreadsheetId).
-			IncludeGridData(true).
-			Do()
+	err = ds.callDrive(func() error {
+		return ds.files.AddParent(ds.ctx, sheet.SpreadsheetId, driveDirId)
+	})
+	if err != nil {
+		return sheet, err
 	}
 
-	return ds.sheetSrv.Spreadsheets.Get(files[0].Id).IncludeGridData(true).Do()
+	return ds.getSheet(sheet.SpreadsheetId)
+}
+
+func (ds *DriveService) getSheet(spreadsheetId string) (*sheets.Spreadsheet, error) {
+	var sheet *sheets.Spreadsheet
+	err := ds.callSheets(func() (err error) {
+		sheet, err = ds.sheets.GetSpreadsheet(ds.ctx, spreadsheetId)
+		return err
+	})
+	return sheet, err
+}
+
+// callDrive sends a Google Drive request within the rate limit, retrying it
+// on transient errors.
+func (ds *DriveService) callDrive(call func() error) error {
+	return ds.retry.Do(ds.ctx, func() error {
+		if err := ds.driveLimiter.Wait(ds.ctx); err != nil {
+			return err
+		}
+		return call()
+	})
+}
+
+// callSheets sends a Google Sheets request within the rate limit, retrying it
+// on transient errors.
+func (ds *DriveService) callSheets(call func() error) error {
+	return ds.retry.Do(ds.ctx, func() error {
+		if err := ds.sheetLimiter.Wait(ds.ctx); err != nil {
+			return err
+		}
+		return call()
+	})
 }
 
 func (ds *DriveService) getColumnMetadata() []*sheets.DimensionProperties {
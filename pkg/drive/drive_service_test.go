@@ -0,0 +1,175 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// The tests use the fake of the drivetest package, which depends on this one.
+package drive_test
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/docblog/pkg/drive"
+	"github.com/google/docblog/pkg/drive/drivetest"
+)
+
+func TestUpdateWithDate(t *testing.T) {
+	created := time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		sheetDate time.Time
+		want      time.Time
+	}{
+		{"same day", time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), created},
+		{"changed day", time.Date(2024, 4, 30, 0, 0, 0, 0, time.UTC),
+			time.Date(2024, 4, 30, 0, 0, 0, 0, time.UTC)},
+		{"empty cell", time.Time{}, created},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata := drive.GoogleDocMetadata{Id: "doc1", CreatedTime: created}
+			metadata.UpdateWith(drive.GoogleDocMetadata{Id: "doc1", CreatedTime: tt.sheetDate})
+			if !metadata.CreatedTime.Equal(tt.want) {
+				t.Errorf("CreatedTime = %v, want %v", metadata.CreatedTime, tt.want)
+			}
+		})
+	}
+}
+
+func TestListGoogleDocs(t *testing.T) {
+	// blog/
+	//   Top
+	//   travel/
+	//     Trip
+	//     japan/
+	//       Tokyo
+	//     drafts/
+	//       Unfinished trip
+	//   drafts/
+	//     Unfinished
+	//   empty/
+	fake := drivetest.NewFake()
+	created := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	blogId := fake.AddFolder("", "blog")
+	fake.AddDoc(blogId, "Top", created, nil)
+	travelId := fake.AddFolder(blogId, "travel")
+	fake.AddDoc(travelId, "Trip", created, nil)
+	japanId := fake.AddFolder(travelId, "japan")
+	fake.AddDoc(japanId, "Tokyo", created, nil)
+	travelDraftsId := fake.AddFolder(travelId, "drafts")
+	fake.AddDoc(travelDraftsId, "Unfinished trip", created, nil)
+	draftsId := fake.AddFolder(blogId, "drafts")
+	fake.AddDoc(draftsId, "Unfinished", created, nil)
+	fake.AddFolder(blogId, "empty")
+	// Only documents are listed.
+	fake.AddFile(&drivetest.File{
+		Name:     "notes.txt",
+		MimeType: "text/plain",
+		Parents:  []string{travelId},
+	})
+	trashedId := fake.AddDoc(japanId, "Trashed", created, nil)
+	fake.TrashFile(trashedId)
+
+	tests := []struct {
+		name string
+		opts drive.ListOptions
+		// want are the paths of the documents, relative to the blog.
+		want []string
+	}{
+		{
+			name: "top level only",
+			want: []string{"Top"},
+		},
+		{
+			name: "recursive",
+			opts: drive.ListOptions{Recursive: true},
+			want: []string{"Top", "drafts/Unfinished", "travel/Trip",
+				"travel/drafts/Unfinished trip", "travel/japan/Tokyo"},
+		},
+		{
+			// Names match the directories at any depth.
+			name: "excluded by name",
+			opts: drive.ListOptions{Recursive: true, ExcludeFolders: []string{"drafts"}},
+			want: []string{"Top", "travel/Trip", "travel/japan/Tokyo"},
+		},
+		{
+			name: "excluded by path",
+			opts: drive.ListOptions{Recursive: true, ExcludeFolders: []string{"travel/drafts"}},
+			want: []string{"Top", "drafts/Unfinished", "travel/Trip", "travel/japan/Tokyo"},
+		},
+		{
+			// Leading and trailing slashes are ignored.
+			name: "excluded subtree",
+			opts: drive.ListOptions{Recursive: true, ExcludeFolders: []string{"/travel/"}},
+			want: []string{"Top", "drafts/Unfinished"},
+		},
+		{
+			name: "nested name",
+			opts: drive.ListOptions{Recursive: true, ExcludeFolders: []string{"japan"}},
+			want: []string{"Top", "drafts/Unfinished", "travel/Trip",
+				"travel/drafts/Unfinished trip"},
+		},
+		{
+			// Paths only match from the blog directory.
+			name: "partial path",
+			opts: drive.ListOptions{Recursive: true, ExcludeFolders: []string{"japan/tokyo", "avel"}},
+			want: []string{"Top", "drafts/Unfinished", "travel/Trip",
+				"travel/drafts/Unfinished trip", "travel/japan/Tokyo"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docs, err := drivetest.NewService(fake).ListGoogleDocs(blogId, tt.opts)
+			if err != nil {
+				t.Fatalf("ListGoogleDocs() failed: %v", err)
+			}
+
+			var got []string
+			for _, doc := range docs {
+				if doc.Folder == "" {
+					got = append(got, doc.Name)
+				} else {
+					got = append(got, doc.Folder+"/"+doc.Name)
+				}
+				if doc.Status != drive.StatusPublished || !doc.CreatedTime.Equal(created) {
+					t.Errorf("metadata = %+v, want a published document", doc)
+				}
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("listed documents = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllCategories(t *testing.T) {
+	tests := []struct {
+		folder     string
+		categories []string
+		want       []string
+	}{
+		{"", nil, nil},
+		{"travel", nil, []string{"travel"}},
+		{"travel/japan", []string{"food", "japan"}, []string{"travel", "japan", "food"}},
+		{"", []string{"food"}, []string{"food"}},
+	}
+	for _, tt := range tests {
+		m := drive.GoogleDocMetadata{Folder: tt.folder, Categories: tt.categories}
+		if got := m.AllCategories(); !slices.Equal(got, tt.want) {
+			t.Errorf("AllCategories() of %q and %q = %q, want %q",
+				tt.folder, tt.categories, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,565 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package drivetest provides an in-memory fake of Google Drive and Google
+// Sheets, so that docblog can be exercised without network access.
+package drivetest
+
+import (
+	"archive/zip"
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	docdrive "github.com/google/docblog/pkg/drive"
+	"github.com/google/docblog/pkg/retry"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/sheets/v4"
+)
+
+const (
+	DocumentMimeType    = docdrive.GoogleDocMimeType
+	FolderMimeType      = docdrive.GoogleFolderMimeType
+	SpreadsheetMimeType = "application/vnd.google-apps.spreadsheet"
+)
+
+// File is a file stored in the fake.
+type File struct {
+	Id           string
+	Name         string
+	MimeType     string
+	Parents      []string
+	CreatedTime  time.Time
+	ModifiedTime time.Time
+	Trashed      bool
+	// Export is the content of the document exported to a zipped HTML file,
+	// see Zip.
+	Export []byte
+}
+
+// Fake is an in-memory implementation of drive.FileStore and drive.SheetStore.
+// It's safe for concurrent use.
+type Fake struct {
+	// PageSize is the maximum number of files listed at once, so that the
+	// pagination is exercised as well.
+	PageSize int
+
+	mu           sync.Mutex
+	files        map[string]*File
+	spreadsheets map[string]*sheets.Spreadsheet
+	nextId       int
+	// changes are the IDs of the modified files, in order. The page tokens
+	// of the changes are the indices in the list.
+	changes []string
+	// channels are the open notification channels by their ID.
+	channels map[string]*drive.Channel
+}
+
+var (
+	_ docdrive.FileStore  = (*Fake)(nil)
+	_ docdrive.SheetStore = (*Fake)(nil)
+)
+
+// NewFake returns an empty fake.
+func NewFake() *Fake {
+	return &Fake{
+		PageSize:     100,
+		files:        map[string]*File{},
+		spreadsheets: map[string]*sheets.Spreadsheet{},
+		channels:     map[string]*drive.Channel{},
+	}
+}
+
+// NewService returns a DriveService backed by the fake, with no rate limits
+// and no retries.
+func NewService(f *Fake) *docdrive.DriveService {
+	return docdrive.NewDriveServiceWithStores(
+		context.Background(), f, f, docdrive.LimitOptions{}, retry.Policy{})
+}
+
+// AddFolder adds a directory to the parent directory, which may be empty for
+// the root. It returns the ID of the directory.
+func (f *Fake) AddFolder(parentId string, name string) string {
+	return f.AddFile(&File{
+		Name:     name,
+		MimeType: FolderMimeType,
+		Parents:  parents(parentId),
+	})
+}
+
+// AddDoc adds a Google Document to the directory. The document is exported to
+// the provided files, e.g. "doc.html" and "images/image1.png". It returns the
+// ID of the document.
+func (f *Fake) AddDoc(
+	parentId string,
+	name string,
+	created time.Time,
+	export map[string][]byte,
+) string {
+	return f.AddFile(&File{
+		Name:         name,
+		MimeType:     DocumentMimeType,
+		Parents:      parents(parentId),
+		CreatedTime:  created,
+		ModifiedTime: created,
+		Export:       Zip(export),
+	})
+}
+
+// AddFile adds the file, assigning an ID unless it's set. It returns the ID of
+// the file.
+func (f *Fake) AddFile(file *File) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if file.Id == "" {
+		file.Id = f.newId()
+	}
+	if file.CreatedTime.IsZero() {
+		file.CreatedTime = time.Now().UTC()
+	}
+	if file.ModifiedTime.IsZero() {
+		file.ModifiedTime = file.CreatedTime
+	}
+	f.files[file.Id] = file
+	f.changes = append(f.changes, file.Id)
+	return file.Id
+}
+
+// UpdateDoc replaces the export of the document and bumps its modification
+// time.
+func (f *Fake) UpdateDoc(fileId string, modified time.Time, export map[string][]byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if file, ok := f.files[fileId]; ok {
+		file.ModifiedTime = modified
+		file.Export = Zip(export)
+		f.changes = append(f.changes, fileId)
+	}
+}
+
+// TrashFile moves the file to the trash.
+func (f *Fake) TrashFile(fileId string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if file, ok := f.files[fileId]; ok {
+		file.Trashed = true
+		f.changes = append(f.changes, fileId)
+	}
+}
+
+// File returns the file with the provided ID, if any.
+func (f *Fake) File(fileId string) (*File, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, ok := f.files[fileId]
+	return file, ok
+}
+
+// Spreadsheet returns the spreadsheet with the provided ID, if any.
+func (f *Fake) Spreadsheet(spreadsheetId string) (*sheets.Spreadsheet, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	spreadsheet, ok := f.spreadsheets[spreadsheetId]
+	return spreadsheet, ok
+}
+
+func (f *Fake) ListFiles(
+	ctx context.Context,
+	query string,
+	fields string,
+	pageToken string,
+) (*drive.FileList, error) {
+	q, err := parseQuery(query)
+	if err != nil {
+		return nil, badRequest(err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var matching []*File
+	for _, file := range f.files {
+		if q.matches(file) {
+			matching = append(matching, file)
+		}
+	}
+	slices.SortFunc(matching, func(a, b *File) int {
+		return a.CreatedTime.Compare(b.CreatedTime)
+	})
+
+	offset := 0
+	if pageToken != "" {
+		if offset, err = strconv.Atoi(pageToken); err != nil {
+			return nil, badRequest(fmt.Errorf("invalid page token: %s", pageToken))
+		}
+	}
+
+	fileList := &drive.FileList{}
+	end := min(len(matching), offset+max(1, f.PageSize))
+	for _, file := range matching[min(offset, end):end] {
+		fileList.Files = append(fileList.Files, &drive.File{
+			Id:           file.Id,
+			Name:         file.Name,
+			MimeType:     file.MimeType,
+			Parents:      file.Parents,
+			CreatedTime:  file.CreatedTime.Format(time.RFC3339),
+			ModifiedTime: file.ModifiedTime.Format(time.RFC3339),
+		})
+	}
+	if end < len(matching) {
+		fileList.NextPageToken = strconv.Itoa(end)
+	}
+	return fileList, nil
+}
+
+func (f *Fake) ExportFile(
+	ctx context.Context,
+	fileId string,
+	mimeType string,
+) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, ok := f.files[fileId]
+	if !ok {
+		return nil, notFound(fileId)
+	}
+	if mimeType != "application/zip" || file.MimeType != DocumentMimeType {
+		return nil, badRequest(
+			fmt.Errorf("can't export %s to %s", file.MimeType, mimeType))
+	}
+	return file.Export, nil
+}
+
+func (f *Fake) AddParent(ctx context.Context, fileId string, parentId string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, ok := f.files[fileId]
+	if !ok {
+		return notFound(fileId)
+	}
+	if !slices.Contains(file.Parents, parentId) {
+		file.Parents = append(file.Parents, parentId)
+		f.changes = append(f.changes, fileId)
+	}
+	return nil
+}
+
+func (f *Fake) GetStartPageToken(ctx context.Context) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return strconv.Itoa(len(f.changes)), nil
+}
+
+// ListChanges lists the changes since the page token. A file modified several
+// times is reported for each modification, with its current state.
+func (f *Fake) ListChanges(
+	ctx context.Context,
+	pageToken string,
+	fields string,
+) (*drive.ChangeList, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	offset, err := strconv.Atoi(pageToken)
+	if err != nil || offset < 0 || offset > len(f.changes) {
+		return nil, badRequest(fmt.Errorf("invalid page token: %s", pageToken))
+	}
+
+	changeList := &drive.ChangeList{}
+	end := min(len(f.changes), offset+max(1, f.PageSize))
+	for _, fileId := range f.changes[offset:end] {
+		change := &drive.Change{FileId: fileId}
+		if file, ok := f.files[fileId]; ok {
+			change.File = &drive.File{
+				Id:       file.Id,
+				MimeType: file.MimeType,
+				Parents:  file.Parents,
+				Trashed:  file.Trashed,
+			}
+		} else {
+			change.Removed = true
+		}
+		changeList.Changes = append(changeList.Changes, change)
+	}
+	if end < len(f.changes) {
+		changeList.NextPageToken = strconv.Itoa(end)
+	} else {
+		changeList.NewStartPageToken = strconv.Itoa(end)
+	}
+	return changeList, nil
+}
+
+// WatchChanges opens the channel. No notifications are sent, tests can send
+// them to the address of the channel, see Channels.
+func (f *Fake) WatchChanges(
+	ctx context.Context,
+	pageToken string,
+	channel *drive.Channel,
+) (*drive.Channel, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, err := strconv.Atoi(pageToken); err != nil {
+		return nil, badRequest(fmt.Errorf("invalid page token: %s", pageToken))
+	}
+	if _, ok := f.channels[channel.Id]; ok {
+		return nil, badRequest(fmt.Errorf("channel already exists: %s", channel.Id))
+	}
+
+	opened := *channel
+	opened.ResourceId = "changes"
+	if opened.Expiration == 0 {
+		opened.Expiration = time.Now().Add(time.Hour).UnixMilli()
+	}
+	f.channels[opened.Id] = &opened
+	return &opened, nil
+}
+
+func (f *Fake) StopChannel(ctx context.Context, channel *drive.Channel) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.channels[channel.Id]; !ok {
+		return notFound(channel.Id)
+	}
+	delete(f.channels, channel.Id)
+	return nil
+}
+
+// Channels returns the open notification channels.
+func (f *Fake) Channels() []*drive.Channel {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	channels := make([]*drive.Channel, 0, len(f.channels))
+	for _, channel := range f.channels {
+		channels = append(channels, channel)
+	}
+	slices.SortFunc(channels, func(a, b *drive.Channel) int {
+		return cmp.Compare(a.Expiration, b.Expiration)
+	})
+	return channels
+}
+
+func (f *Fake) GetSpreadsheet(
+	ctx context.Context,
+	spreadsheetId string,
+) (*sheets.Spreadsheet, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	spreadsheet, ok := f.spreadsheets[spreadsheetId]
+	if !ok {
+		return nil, notFound(spreadsheetId)
+	}
+	return spreadsheet, nil
+}
+
+// CreateSpreadsheet stores the spreadsheet, along with a file in the root
+// directory named after its title.
+func (f *Fake) CreateSpreadsheet(
+	ctx context.Context,
+	spreadsheet *sheets.Spreadsheet,
+) (*sheets.Spreadsheet, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	spreadsheet.SpreadsheetId = f.newId()
+	for i, sheet := range spreadsheet.Sheets {
+		sheet.Properties.SheetId = int64(i)
+		for _, data := range sheet.Data {
+			for _, row := range data.RowData {
+				formatRow(row)
+			}
+		}
+	}
+
+	f.spreadsheets[spreadsheet.SpreadsheetId] = spreadsheet
+	f.changes = append(f.changes, spreadsheet.SpreadsheetId)
+	now := time.Now().UTC()
+	f.files[spreadsheet.SpreadsheetId] = &File{
+		Id:           spreadsheet.SpreadsheetId,
+		Name:         spreadsheet.Properties.Title,
+		MimeType:     SpreadsheetMimeType,
+		CreatedTime:  now,
+		ModifiedTime: now,
+	}
+	return spreadsheet, nil
+}
+
+// BatchUpdate applies the requests modifying the sheet properties and the
+// cells, other requests are not supported.
+func (f *Fake) BatchUpdate(
+	ctx context.Context,
+	spreadsheetId string,
+	request *sheets.BatchUpdateSpreadsheetRequest,
+) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	spreadsheet, ok := f.spreadsheets[spreadsheetId]
+	if !ok {
+		return notFound(spreadsheetId)
+	}
+
+	for _, r := range request.Requests {
+		switch {
+		case r.UpdateSheetProperties != nil:
+			props := r.UpdateSheetProperties.Properties
+			sheet, err := findSheet(spreadsheet, props.SheetId)
+			if err != nil {
+				return err
+			}
+			sheet.Properties.Title = props.Title
+			sheet.Properties.GridProperties = props.GridProperties
+			if len(sheet.Data) > 0 && props.GridProperties != nil {
+				data := sheet.Data[0]
+				rowCount := int(props.GridProperties.RowCount)
+				if len(data.RowData) > rowCount {
+					data.RowData = data.RowData[:rowCount]
+				}
+			}
+		case r.UpdateCells != nil:
+			start := r.UpdateCells.Start
+			sheet, err := findSheet(spreadsheet, start.SheetId)
+			if err != nil {
+				return err
+			}
+			if len(sheet.Data) == 0 {
+				sheet.Data = []*sheets.GridData{{}}
+			}
+			data := sheet.Data[0]
+			for i, row := range r.UpdateCells.Rows {
+				formatRow(row)
+				rowIndex := int(start.RowIndex) + i
+				for len(data.RowData) <= rowIndex {
+					data.RowData = append(data.RowData, &sheets.RowData{})
+				}
+				data.RowData[rowIndex] = row
+			}
+		default:
+			return badRequest(fmt.Errorf("unsupported request"))
+		}
+	}
+	f.changes = append(f.changes, spreadsheetId)
+	return nil
+}
+
+func (f *Fake) newId() string {
+	f.nextId++
+	return fmt.Sprintf("fake-%d", f.nextId)
+}
+
+// Zip returns a zip archive with the provided files, such as the ones Google
+// Drive exports documents to.
+func Zip(files map[string][]byte) []byte {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var b bytes.Buffer
+	w := zip.NewWriter(&b)
+	for _, name := range names {
+		fw, err := w.Create(name)
+		if err != nil {
+			panic(err)
+		}
+		if _, err := fw.Write(files[name]); err != nil {
+			panic(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		panic(err)
+	}
+	return b.Bytes()
+}
+
+func findSheet(spreadsheet *sheets.Spreadsheet, sheetId int64) (*sheets.Sheet, error) {
+	for _, sheet := range spreadsheet.Sheets {
+		if sheet.Properties.SheetId == sheetId {
+			return sheet, nil
+		}
+	}
+	return nil, badRequest(fmt.Errorf("unknown sheet: %d", sheetId))
+}
+
+var hyperlinkRegex = regexp.MustCompile(`^=HYPERLINK\(".*", "(.*)"\)$`)
+
+// formatRow sets the formatted values of the cells, as Google Sheets would.
+func formatRow(row *sheets.RowData) {
+	for _, cell := range row.Values {
+		value := cell.UserEnteredValue
+		switch {
+		case value == nil:
+			cell.FormattedValue = ""
+		case value.StringValue != nil:
+			cell.FormattedValue = *value.StringValue
+		case value.FormulaValue != nil:
+			if match := hyperlinkRegex.FindStringSubmatch(*value.FormulaValue); match != nil {
+				cell.FormattedValue = match[1]
+			} else {
+				cell.FormattedValue = *value.FormulaValue
+			}
+		case value.NumberValue != nil:
+			format := cell.UserEnteredFormat
+			if format != nil && format.NumberFormat != nil &&
+				format.NumberFormat.Type == "DATE" {
+				days := time.Duration(*value.NumberValue * 24 * float64(time.Hour))
+				cell.FormattedValue = docdrive.GoogleSheetEpoch0.
+					Add(days).
+					Format(docdrive.GoogleSheetDayFormat)
+			} else {
+				cell.FormattedValue = strconv.FormatFloat(*value.NumberValue, 'f', -1, 64)
+			}
+		case value.BoolValue != nil:
+			cell.FormattedValue = strconv.FormatBool(*value.BoolValue)
+		}
+	}
+}
+
+func parents(parentId string) []string {
+	if parentId == "" {
+		return nil
+	}
+	return []string{parentId}
+}
+
+func notFound(id string) error {
+	return &googleapi.Error{
+		Code:    http.StatusNotFound,
+		Message: fmt.Sprintf("File not found: %s", id),
+	}
+}
+
+func badRequest(err error) error {
+	return &googleapi.Error{Code: http.StatusBadRequest, Message: err.Error()}
+}
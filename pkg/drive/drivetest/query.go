@@ -0,0 +1,223 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drivetest
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// query is a parsed Google Drive search query. Only the subset used by docblog
+// is supported: "and" and "or" of "'<id>' in parents" and comparisons of name,
+// mimeType and trashed, with parentheses.
+type query interface {
+	matches(file *File) bool
+}
+
+type andQuery []query
+
+func (q andQuery) matches(file *File) bool {
+	for _, term := range q {
+		if !term.matches(file) {
+			return false
+		}
+	}
+	return true
+}
+
+type orQuery []query
+
+func (q orQuery) matches(file *File) bool {
+	for _, term := range q {
+		if term.matches(file) {
+			return true
+		}
+	}
+	return false
+}
+
+type inParentsQuery string
+
+func (q inParentsQuery) matches(file *File) bool {
+	return slices.Contains(file.Parents, string(q))
+}
+
+type fieldQuery struct {
+	field string
+	value string
+}
+
+func (q fieldQuery) matches(file *File) bool {
+	switch q.field {
+	case "name":
+		return file.Name == q.value
+	case "mimeType":
+		return file.MimeType == q.value
+	case "trashed":
+		return fmt.Sprint(file.Trashed) == q.value
+	}
+	return false
+}
+
+// parseQuery parses the query, see
+// https://developers.google.com/drive/api/guides/ref-search-terms.
+func parseQuery(s string) (query, error) {
+	p := &queryParser{tokens: tokenize(s)}
+	q, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected token in query: %s", p.tokens[p.pos])
+	}
+	return q, nil
+}
+
+type queryParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *queryParser) next() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	p.pos++
+	return p.tokens[p.pos-1]
+}
+
+func (p *queryParser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *queryParser) parseOr() (query, error) {
+	var terms orQuery
+	for {
+		term, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, term)
+		if p.peek() != "or" {
+			break
+		}
+		p.next()
+	}
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return terms, nil
+}
+
+func (p *queryParser) parseAnd() (query, error) {
+	var terms andQuery
+	for {
+		term, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, term)
+		if p.peek() != "and" {
+			break
+		}
+		p.next()
+	}
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return terms, nil
+}
+
+func (p *queryParser) parseTerm() (query, error) {
+	token := p.next()
+	if token == "(" {
+		q, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing closing parenthesis in query")
+		}
+		return q, nil
+	}
+
+	if value, ok := unquote(token); ok {
+		if p.next() != "in" || p.next() != "parents" {
+			return nil, fmt.Errorf("unsupported query term: %s", token)
+		}
+		return inParentsQuery(value), nil
+	}
+
+	switch token {
+	case "name", "mimeType", "trashed":
+		if p.next() != "=" {
+			return nil, fmt.Errorf("unsupported operator for %s", token)
+		}
+		value := p.next()
+		if unquoted, ok := unquote(value); ok {
+			value = unquoted
+		}
+		return fieldQuery{token, value}, nil
+	}
+	return nil, fmt.Errorf("unsupported query term: %s", token)
+}
+
+// tokenize splits the query into quoted strings, parentheses, operators and
+// words.
+func tokenize(s string) []string {
+	var tokens []string
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(' || c == ')' || c == '=':
+			tokens = append(tokens, string(c))
+			i++
+		case c == '\'':
+			end := i + 1
+			for end < len(s) && s[end] != '\'' {
+				if s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			tokens = append(tokens, s[i:min(end+1, len(s))])
+			i = end + 1
+		default:
+			end := i
+			for end < len(s) && !strings.ContainsRune(" \t\n()='", rune(s[end])) {
+				end++
+			}
+			tokens = append(tokens, s[i:end])
+			i = end
+		}
+	}
+	return tokens
+}
+
+func unquote(token string) (string, bool) {
+	if len(token) < 2 || token[0] != '\'' || token[len(token)-1] != '\'' {
+		return "", false
+	}
+	value := token[1 : len(token)-1]
+	value = strings.ReplaceAll(value, `\'`, `'`)
+	return strings.ReplaceAll(value, `\\`, `\`), true
+}
@@ -0,0 +1,119 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drivetest
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	docdrive "github.com/google/docblog/pkg/drive"
+)
+
+func TestParseQuery(t *testing.T) {
+	files := []*File{
+		{Id: "doc", Name: "Hello", MimeType: DocumentMimeType, Parents: []string{"blog"}},
+		{Id: "folder", Name: "travel", MimeType: FolderMimeType, Parents: []string{"blog"}},
+		{Id: "index", Name: "index", MimeType: SpreadsheetMimeType, Parents: []string{"blog"}},
+		{Id: "trashed", Name: "Old", MimeType: DocumentMimeType, Parents: []string{"blog"}, Trashed: true},
+		{Id: "nested", Name: "It's me", MimeType: DocumentMimeType, Parents: []string{"folder"}},
+		{Id: "shared", Name: `C:\Docs`, MimeType: DocumentMimeType, Parents: []string{"blog", "folder"}},
+	}
+	tests := []struct {
+		query   string
+		want    []string
+		wantErr bool
+	}{
+		{query: "'blog' in parents", want: []string{"doc", "folder", "index", "trashed", "shared"}},
+		{query: "'folder' in parents", want: []string{"nested", "shared"}},
+		{query: "'missing' in parents"},
+		{query: "trashed=true", want: []string{"trashed"}},
+		{query: "trashed = false and name = 'Hello'", want: []string{"doc"}},
+		{query: `name='It\'s me'`, want: []string{"nested"}},
+		{query: `name='C:\\Docs'`, want: []string{"shared"}},
+		{query: "name = 'index' or name = 'travel'", want: []string{"folder", "index"}},
+		// "and" binds tighter than "or".
+		{
+			query: "'folder' in parents and name = 'It\\'s me' or mimeType = '" + FolderMimeType + "'",
+			want:  []string{"folder", "nested"},
+		},
+		{
+			query: "'folder' in parents and (name = 'Hello' or mimeType = '" + FolderMimeType + "')",
+		},
+		{
+			query: fmt.Sprintf(docdrive.GoogleDocListQuery, "blog"),
+			want:  []string{"doc", "shared"},
+		},
+		{
+			query: fmt.Sprintf(docdrive.GoogleDocTreeListQuery, "blog"),
+			want:  []string{"doc", "folder", "shared"},
+		},
+		{
+			query: fmt.Sprintf(docdrive.GoogleSheetIndexListQuery, "blog"),
+			want:  []string{"index"},
+		},
+		{query: "", wantErr: true},
+		{query: "name contains 'Hello'", wantErr: true},
+		{query: "modifiedTime > '2024-05-01'", wantErr: true},
+		{query: "'blog' in owners", wantErr: true},
+		{query: "('blog' in parents", wantErr: true},
+		{query: "'blog' in parents)", wantErr: true},
+		{query: "'blog' in parents and", wantErr: true},
+		{query: "name = 'Hello' name = 'Old'", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := parseQuery(tt.query)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseQuery() = %v, want error", q)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseQuery() failed: %v", err)
+			}
+
+			var got []string
+			for _, file := range files {
+				if q.matches(file) {
+					got = append(got, file.Id)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("matching files = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"'a' in parents", []string{"'a'", "in", "parents"}},
+		{"trashed=false", []string{"trashed", "=", "false"}},
+		{"(name='x')or(name='y')", []string{"(", "name", "=", "'x'", ")", "or", "(", "name", "=", "'y'", ")"}},
+		{`name = 'a\'b c'`, []string{"name", "=", `'a\'b c'`}},
+		{"name = 'unterminated", []string{"name", "=", "'unterminated"}},
+		{" \t\n", nil},
+	}
+	for _, tt := range tests {
+		if got := tokenize(tt.query); !slices.Equal(got, tt.want) {
+			t.Errorf("tokenize(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,351 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	YamlFrontmatter = "yaml"
+	TomlFrontmatter = "toml"
+)
+
+// Frontmatter is an ordered list of frontmatter fields. Values may be strings,
+// booleans, times, string lists or nested Frontmatter tables.
+type Frontmatter []FrontmatterField
+
+// FrontmatterField is a single key-value pair of the frontmatter.
+type FrontmatterField struct {
+	Key   string
+	Value any
+}
+
+// Get returns the value of the field with the provided key, if any.
+func (fm Frontmatter) Get(key string) (any, bool) {
+	for _, field := range fm {
+		if field.Key == key {
+			return field.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Marshal serializes the frontmatter in the provided format, including the
+// delimiters.
+func (fm Frontmatter) Marshal(format string) ([]byte, error) {
+	var content []byte
+	var err error
+	switch format {
+	case YamlFrontmatter:
+		content, err = fm.marshalYaml()
+	case TomlFrontmatter:
+		content, err = fm.marshalToml()
+	default:
+		return nil, fmt.Errorf("unsupported frontmatter format: %s", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	delimiter := frontmatterDelimiters[format]
+	return append(append([]byte(delimiter), content...), delimiter...), nil
+}
+
+// frontmatterDelimiters are the lines enclosing the frontmatter by its format.
+var frontmatterDelimiters = map[string]string{
+	YamlFrontmatter: "---\n",
+	TomlFrontmatter: "+++\n",
+}
+
+// UnmarshalFrontmatter splits the content into the frontmatter and the rest.
+// Both YAML and TOML frontmatter is recognized by its delimiters, content
+// without frontmatter is returned as is.
+func UnmarshalFrontmatter(content []byte) (Frontmatter, []byte, error) {
+	for _, format := range []string{YamlFrontmatter, TomlFrontmatter} {
+		delimiter := frontmatterDelimiters[format]
+		rest, ok := bytes.CutPrefix(content, []byte(delimiter))
+		if !ok {
+			continue
+		}
+		var header []byte
+		if header, rest, ok = bytes.Cut(rest, []byte(delimiter)); !ok {
+			return nil, nil, fmt.Errorf("unterminated %s frontmatter", format)
+		}
+		// The closing delimiter is preceded by a line break, unless empty.
+		if len(header) > 0 && !bytes.HasSuffix(header, []byte("\n")) {
+			return nil, nil, fmt.Errorf("unterminated %s frontmatter", format)
+		}
+
+		var fm Frontmatter
+		var err error
+		if format == YamlFrontmatter {
+			fm, err = unmarshalYaml(header)
+		} else {
+			fm, err = unmarshalToml(header)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse %s frontmatter: %v",
+				format, err)
+		}
+		return fm, rest, nil
+	}
+	return nil, content, nil
+}
+
+func (fm Frontmatter) marshalYaml() ([]byte, error) {
+	node, err := fm.yamlNode()
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	encoder := yaml.NewEncoder(&b)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(node); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (fm Frontmatter) yamlNode() (*yaml.Node, error) {
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	for _, field := range fm {
+		key := &yaml.Node{Kind: yaml.ScalarNode, Value: field.Key}
+
+		var value *yaml.Node
+		if table, ok := field.Value.(Frontmatter); ok {
+			var err error
+			if value, err = table.yamlNode(); err != nil {
+				return nil, err
+			}
+		} else {
+			value = &yaml.Node{}
+			if err := value.Encode(field.Value); err != nil {
+				return nil, fmt.Errorf("failed to encode %s: %v", field.Key, err)
+			}
+		}
+
+		node.Content = append(node.Content, key, value)
+	}
+	return node, nil
+}
+
+func unmarshalYaml(content []byte) (Frontmatter, error) {
+	var node yaml.Node
+	if err := yaml.Unmarshal(content, &node); err != nil {
+		return nil, err
+	}
+	// Empty frontmatter has no document node.
+	if len(node.Content) == 0 {
+		return nil, nil
+	}
+	return yamlFrontmatter(node.Content[0])
+}
+
+func yamlFrontmatter(node *yaml.Node) (Frontmatter, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("line %d: expected a mapping", node.Line)
+	}
+
+	var fm Frontmatter
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		field := FrontmatterField{Key: key.Value}
+		switch value.Kind {
+		case yaml.MappingNode:
+			table, err := yamlFrontmatter(value)
+			if err != nil {
+				return nil, err
+			}
+			field.Value = table
+		case yaml.SequenceNode:
+			values := []string{}
+			if err := value.Decode(&values); err != nil {
+				return nil, fmt.Errorf("failed to decode %s: %v", key.Value, err)
+			}
+			field.Value = values
+		default:
+			// Timestamps are only decoded as such into time.Time.
+			var err error
+			switch value.ShortTag() {
+			case "!!timestamp":
+				var t time.Time
+				err = value.Decode(&t)
+				field.Value = t
+			default:
+				err = value.Decode(&field.Value)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode %s: %v", key.Value, err)
+			}
+		}
+		fm = append(fm, field)
+	}
+	return fm, nil
+}
+
+// marshalToml serializes the frontmatter into TOML. The fields are encoded as
+// a struct, whose fields keep their order unlike the keys of a map.
+func (fm Frontmatter) marshalToml() ([]byte, error) {
+	value, err := fm.tomlStruct()
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	encoder := toml.NewEncoder(&b)
+	encoder.Indent = ""
+	if err := encoder.Encode(value.Interface()); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// tomlStruct returns a struct with a field tagged with the key of each field
+// of the frontmatter.
+func (fm Frontmatter) tomlStruct() (reflect.Value, error) {
+	fields := make([]reflect.StructField, len(fm))
+	values := make([]reflect.Value, len(fm))
+	for i, field := range fm {
+		var value reflect.Value
+		switch v := field.Value.(type) {
+		case Frontmatter:
+			var err error
+			if value, err = v.tomlStruct(); err != nil {
+				return reflect.Value{}, err
+			}
+		case time.Time:
+			// Fractions of a second are not written, like in RFC 3339.
+			value = reflect.ValueOf(v.Truncate(time.Second))
+		case nil:
+			return reflect.Value{}, fmt.Errorf("failed to encode %s: no value", field.Key)
+		default:
+			value = reflect.ValueOf(v)
+		}
+
+		fields[i] = reflect.StructField{
+			Name: fmt.Sprintf("Field%d", i),
+			Type: value.Type(),
+			Tag:  reflect.StructTag(fmt.Sprintf("toml:%q", field.Key)),
+		}
+		values[i] = value
+	}
+
+	result := reflect.New(reflect.StructOf(fields)).Elem()
+	for i, value := range values {
+		result.Field(i).Set(value)
+	}
+	return result, nil
+}
+
+// unmarshalToml parses the TOML frontmatter. The fields are added in the order
+// of their keys in the document.
+func unmarshalToml(content []byte) (Frontmatter, error) {
+	var values map[string]any
+	metadata, err := toml.Decode(string(content), &values)
+	if err != nil {
+		return nil, err
+	}
+
+	var fm Frontmatter
+	for _, key := range metadata.Keys() {
+		switch metadata.Type(key...) {
+		case "Hash":
+			// Tables without keys are kept as well.
+			if _, ok := fm.lookup(key); !ok {
+				fm = fm.withField(key, Frontmatter(nil))
+			}
+			continue
+		case "ArrayHash":
+			return nil, fmt.Errorf("%s: arrays of tables are not supported", key)
+		}
+
+		var value any = values
+		for _, k := range key {
+			value = value.(map[string]any)[k]
+		}
+		if value, err = tomlFieldValue(value); err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %v", key, err)
+		}
+		fm = fm.withField(key, value)
+	}
+	return fm, nil
+}
+
+// tomlFieldValue converts the decoded value to the types used by the
+// frontmatter, e.g. arrays become string lists.
+func tomlFieldValue(value any) (any, error) {
+	switch v := value.(type) {
+	case int64:
+		return int(v), nil
+	case []any:
+		values := make([]string, len(v))
+		for i, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("only arrays of strings are supported")
+			}
+			values[i] = s
+		}
+		return values, nil
+	default:
+		return value, nil
+	}
+}
+
+// lookup returns the value at the path of keys, if any.
+func (fm Frontmatter) lookup(keys []string) (any, bool) {
+	value, ok := fm.Get(keys[0])
+	if !ok || len(keys) == 1 {
+		return value, ok
+	}
+	table, ok := value.(Frontmatter)
+	if !ok {
+		return nil, false
+	}
+	return table.lookup(keys[1:])
+}
+
+// withField returns the frontmatter with the field at the path of keys set,
+// the missing tables are created.
+func (fm Frontmatter) withField(keys []string, value any) Frontmatter {
+	for i, field := range fm {
+		if field.Key != keys[0] {
+			continue
+		}
+		if len(keys) == 1 {
+			fm[i].Value = value
+		} else {
+			table, _ := field.Value.(Frontmatter)
+			fm[i].Value = table.withField(keys[1:], value)
+		}
+		return fm
+	}
+
+	if len(keys) > 1 {
+		value = Frontmatter(nil).withField(keys[1:], value)
+	}
+	return append(fm, FrontmatterField{keys[0], value})
+}
@@ -0,0 +1,250 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// equalFrontmatter compares the frontmatter, times are compared by the
+// instant they represent.
+func equalFrontmatter(a, b Frontmatter) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Key != b[i].Key {
+			return false
+		}
+		switch v := a[i].Value.(type) {
+		case Frontmatter:
+			w, ok := b[i].Value.(Frontmatter)
+			if !ok || !equalFrontmatter(v, w) {
+				return false
+			}
+		case time.Time:
+			w, ok := b[i].Value.(time.Time)
+			if !ok || !v.Equal(w) {
+				return false
+			}
+		default:
+			if !reflect.DeepEqual(v, b[i].Value) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestTomlRoundTrip(t *testing.T) {
+	date := time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		fm   Frontmatter
+		toml string
+		// want is the parsed frontmatter, if it differs from fm.
+		want Frontmatter
+	}{
+		{
+			name: "scalars",
+			fm: Frontmatter{
+				{"title", "Hello"},
+				{"draft", false},
+				{"weight", 3},
+				{"ratio", 1.5},
+			},
+			toml: "title = \"Hello\"\ndraft = false\nweight = 3\nratio = 1.5\n",
+		},
+		{
+			name: "quoting and escapes",
+			fm: Frontmatter{
+				{"title", `Say "hi" to C:\Users`},
+				{"summary", "Line 1\nLine 2\tTabbed\r\n"},
+				{"control", "bell\a del\x7f"},
+				{"unicode", "Zażółć gęślą jaźń 🚀"},
+				{"google.doc", "dotted key"},
+				{"a = b", "equals sign"},
+				{"empty", ""},
+			},
+			toml: `title = "Say \"hi\" to C:\\Users"` + "\n" +
+				`summary = "Line 1\nLine 2\tTabbed\r\n"` + "\n" +
+				`control = "bell\u0007 del\u007f"` + "\n" +
+				`unicode = "Zażółć gęślą jaźń 🚀"` + "\n" +
+				`"google.doc" = "dotted key"` + "\n" +
+				`"a = b" = "equals sign"` + "\n" +
+				`empty = ""` + "\n",
+		},
+		{
+			name: "arrays",
+			fm: Frontmatter{
+				{"tags", []string{"Go", "Web, CLI", `"quoted"`, "]"}},
+				{"aliases", []string{}},
+			},
+			toml: `tags = ["Go", "Web, CLI", "\"quoted\"", "]"]` + "\n" +
+				"aliases = []\n",
+		},
+		{
+			name: "dates",
+			fm: Frontmatter{
+				{"date", date},
+				{"lastmod", date.In(time.FixedZone("CEST", 2*60*60))},
+				// Fractions of a second are not written.
+				{"expiryDate", date.Add(1500 * time.Millisecond)},
+			},
+			toml: "date = 2024-05-01T10:30:00Z\n" +
+				"lastmod = 2024-05-01T12:30:00+02:00\n" +
+				"expiryDate = 2024-05-01T10:30:01Z\n",
+			want: Frontmatter{
+				{"date", date},
+				{"lastmod", date},
+				{"expiryDate", date.Add(time.Second)},
+			},
+		},
+		{
+			name: "nested tables",
+			fm: Frontmatter{
+				{"title", "Hello"},
+				{"extra", Frontmatter{
+					{"google", Frontmatter{
+						{"id", "doc1"},
+						{"modified", date},
+					}},
+					{"description", "A post"},
+					{"dotted.key", Frontmatter{
+						{"tags", []string{"Go"}},
+					}},
+				}},
+				{"draft", true},
+			},
+			// Tables follow all the keys of their parent.
+			toml: "title = \"Hello\"\n" +
+				"draft = true\n" +
+				"\n[extra]\n" +
+				"description = \"A post\"\n" +
+				"[extra.google]\n" +
+				"id = \"doc1\"\n" +
+				"modified = 2024-05-01T10:30:00Z\n" +
+				"[extra.\"dotted.key\"]\n" +
+				"tags = [\"Go\"]\n",
+			want: Frontmatter{
+				{"title", "Hello"},
+				{"draft", true},
+				{"extra", Frontmatter{
+					{"description", "A post"},
+					{"google", Frontmatter{
+						{"id", "doc1"},
+						{"modified", date},
+					}},
+					{"dotted.key", Frontmatter{
+						{"tags", []string{"Go"}},
+					}},
+				}},
+			},
+		},
+		{
+			name: "empty",
+			toml: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, err := tt.fm.Marshal(TomlFrontmatter)
+			if err != nil {
+				t.Fatalf("Marshal() failed: %v", err)
+			}
+			if want := "+++\n" + tt.toml + "+++\n"; string(content) != want {
+				t.Errorf("Marshal() =\n%s\nwant:\n%s", content, want)
+			}
+
+			fm, rest, err := UnmarshalFrontmatter(append(content, "<p>Body</p>"...))
+			if err != nil {
+				t.Fatalf("UnmarshalFrontmatter() failed: %v", err)
+			}
+			want := tt.want
+			if want == nil {
+				want = tt.fm
+			}
+			if !equalFrontmatter(fm, want) {
+				t.Errorf("UnmarshalFrontmatter() = %v, want %v", fm, want)
+			}
+			if string(rest) != "<p>Body</p>" {
+				t.Errorf("rest = %q, want the body", rest)
+			}
+		})
+	}
+}
+
+func TestUnmarshalToml(t *testing.T) {
+	content := "+++\n" +
+		"# Written by hand\n" +
+		"title = \"Hello\" # trailing comment\n" +
+		"extra.author = \"Jane\"\n" +
+		"  tags = [ \"Go\" ,\"Web\", ]\n" +
+		"\n" +
+		"[ extra . google ]\n" +
+		"id=\"doc1\"\n" +
+		"+++\n"
+	want := Frontmatter{
+		{"title", "Hello"},
+		{"extra", Frontmatter{
+			{"author", "Jane"},
+			{"google", Frontmatter{{"id", "doc1"}}},
+		}},
+		{"tags", []string{"Go", "Web"}},
+	}
+	fm, _, err := UnmarshalFrontmatter([]byte(content))
+	if err != nil {
+		t.Fatalf("UnmarshalFrontmatter() failed: %v", err)
+	}
+	if !equalFrontmatter(fm, want) {
+		t.Errorf("UnmarshalFrontmatter() = %v, want %v", fm, want)
+	}
+}
+
+func TestUnmarshalTomlErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"unterminated frontmatter", "+++\ntitle = \"Hello\"\n"},
+		{"missing line break", "+++\ntitle = \"Hello\"+++\n"},
+		{"unterminated string", "+++\ntitle = \"Hello\n+++\n"},
+		{"invalid escape", "+++\ntitle = \"\\q\"\n+++\n"},
+		{"unterminated array", "+++\ntags = [\"Go\" \"Web\"]\n+++\n"},
+		{"array of numbers", "+++\nweights = [1, 2]\n+++\n"},
+		{"invalid table header", "+++\n[extra\n+++\n"},
+		{"empty key", "+++\nextra..id = 1\n+++\n"},
+		{"missing value", "+++\ntitle\n+++\n"},
+		{"array of tables", "+++\n[[extra]]\nid = 1\n+++\n"},
+		{"duplicate key", "+++\ntitle = \"Hello\"\ntitle = \"World\"\n+++\n"},
+		{"trailing garbage", "+++\ntitle = \"Hello\" \"World\"\n+++\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if fm, _, err := UnmarshalFrontmatter([]byte(tt.content)); err == nil {
+				t.Errorf("UnmarshalFrontmatter() = %v, want error", fm)
+			}
+		})
+	}
+}
+
+func TestMarshalTomlUnsupported(t *testing.T) {
+	fm := Frontmatter{{"done", make(chan bool)}}
+	if content, err := fm.Marshal(TomlFrontmatter); err == nil {
+		t.Errorf("Marshal() = %q, want error", content)
+	}
+}
@@ -17,13 +17,12 @@ package drive
 import (
 	"bytes"
 	"fmt"
+	"log"
 	"net/url"
 	"regexp"
 	"strings"
-	"sync"
 
 	"golang.org/x/net/html"
-	"gopkg.in/yaml.v3"
 )
 
 const (
@@ -36,11 +35,31 @@ type HtmlDoc struct {
 	Content []byte
 }
 
+// Asset is an image exported along with the document.
+type Asset struct {
+	// Source is the path of the asset in the exported archive, as referenced
+	// by the HTML document.
+	Source string
+	// Url is the URL under which the post references the asset.
+	Url string
+	// Width and Height are the dimensions of the image, zero if unknown.
+	Width  int
+	Height int
+	// Srcset lists the resized variants of the image, if any, in the format of
+	// the srcset attribute.
+	Srcset string
+	// WebpSrcset lists the WebP variants of the image, if any.
+	WebpSrcset string
+	// Alt is the alt text of the image, used if the document has none.
+	Alt string
+}
+
 const googleUrlPrefix = "https://www.google.com/url"
 
 var (
 	colorRegex = regexp.MustCompile(`color:[^;]+;`)
 	fontRegex  = regexp.MustCompile(`font-\w+:[^;]+;`)
+	widthRegex = regexp.MustCompile(`(?:^|;)\s*width:\s*([\d.]+)px`)
 )
 
 func NewHtmlDoc(metadata *GoogleDocMetadata, content []byte) (HtmlDoc, error) {
@@ -50,22 +69,18 @@ func NewHtmlDoc(metadata *GoogleDocMetadata, content []byte) (HtmlDoc, error) {
 	}, nil
 }
 
-// withFrontmatter adds frontmatter to the HTML content that contains Google Doc
-// metadata along with content description.
-func (doc HtmlDoc) WithFrontmatter() (HtmlDoc, error) {
-	content := []byte("---\n")
-	content = append(content, "layout: post\n"...)
-
-	yamlBytes, err := yaml.Marshal(doc.GoogleDocMetadata)
+// WithFrontmatter adds frontmatter to the HTML content that contains Google Doc
+// metadata along with content description. The syntax and the field names
+// depend on the generator profile.
+func (doc HtmlDoc) WithFrontmatter(profile *GeneratorProfile) (HtmlDoc, error) {
+	content, err := profile.
+		Frontmatter(&doc.GoogleDocMetadata).
+		Marshal(profile.FrontmatterFormat)
 	if err != nil {
 		return doc, err
 	}
 
-	content = append(content, yamlBytes...)
-	content = append(content, "---\n"...)
-	content = append(content, doc.Content...)
-
-	doc.Content = content
+	doc.Content = append(content, doc.Content...)
 	return doc, nil
 }
 
@@ -75,15 +90,16 @@ func (doc HtmlDoc) WithFrontmatter() (HtmlDoc, error) {
 //   - Removed Google redirect from URL links
 //   - Removed body styling
 //   - Increases header levels by 1 (by default there may be many h1 tags)
-//   - Fixes asset paths
+//   - Fixes asset paths, assets are looked up by their path in the exported
+//     archive
 //   - Removes title and subtitle, this should be taken from the frontmatter
-func (doc HtmlDoc) WithFixedContent(assetPathPrefix string) (HtmlDoc, error) {
+func (doc HtmlDoc) WithFixedContent(assets map[string]*Asset) (HtmlDoc, error) {
 	rootNode, err := html.Parse(bytes.NewReader(doc.Content))
 	if err != nil {
 		return doc, err
 	}
 
-	doc.modifyContent(rootNode, assetPathPrefix)
+	doc.modifyContent(rootNode, assets)
 
 	var b bytes.Buffer
 	if err := html.Render(&b, rootNode); err != nil {
@@ -94,7 +110,7 @@ func (doc HtmlDoc) WithFixedContent(assetPathPrefix string) (HtmlDoc, error) {
 	return doc, nil
 }
 
-func (doc HtmlDoc) modifyContent(node *html.Node, assetPathPrefix string) {
+func (doc HtmlDoc) modifyContent(node *html.Node, assets map[string]*Asset) {
 	if node.Type == html.ElementNode {
 		// Drop font family
 		for i, attr := range node.Attr {
@@ -133,8 +149,18 @@ func (doc HtmlDoc) modifyContent(node *html.Node, assetPathPrefix string) {
 			// Fix image paths
 			for i, attr := range node.Attr {
 				if attr.Key == "src" {
-					node.Attr[i].Val = "/" +
-						NormalizedAssetPath(assetPathPrefix, doc.Id, attr.Val)
+					asset, ok := assets[attr.Val]
+					if !ok {
+						log.Printf("Warning: missing asset %s in %s\n", attr.Val, doc.Name)
+						continue
+					}
+					node.Attr[i].Val = asset.Url
+					withImageAttrs(node, asset)
+					if asset.WebpSrcset != "" {
+						toPicture(node, asset)
+						return
+					}
+					break
 				}
 			}
 		case "p":
@@ -163,13 +189,194 @@ func (doc HtmlDoc) modifyContent(node *html.Node, assetPathPrefix string) {
 		}
 	}
 
-	var wg sync.WaitGroup
-	for child := node.FirstChild; child != nil; child = child.NextSibling {
-		wg.Add(1)
-		go func(n *html.Node) {
-			doc.modifyContent(n, assetPathPrefix)
-			wg.Done()
-		}(child)
+	// The next sibling is taken first, as the child may remove itself.
+	for child := node.FirstChild; child != nil; {
+		next := child.NextSibling
+		doc.modifyContent(child, assets)
+		child = next
+	}
+}
+
+// withImageAttrs adds the dimensions and the resized variants of the image to
+// the img element, so that browsers can reserve space for it and pick the
+// smallest sufficient variant. The alt text of the asset is added too, unless
+// the image already has one.
+func withImageAttrs(node *html.Node, asset *Asset) {
+	if asset.Alt != "" && !hasAltText(node) {
+		setAttr(node, "alt", asset.Alt)
+	}
+	if asset.Width > 0 && asset.Height > 0 {
+		setAttr(node, "width", fmt.Sprint(asset.Width))
+		setAttr(node, "height", fmt.Sprint(asset.Height))
+	}
+	if asset.Srcset != "" {
+		setAttr(node, "srcset", asset.Srcset)
+		if sizes := imageSizes(node); sizes != "" {
+			setAttr(node, "sizes", sizes)
+		}
+	}
+	setAttr(node, "loading", "lazy")
+}
+
+// toPicture turns the img element into a picture element with a WebP source
+// and the original image as the fallback. The node is modified in place, so
+// that the traversal of its siblings is not affected.
+func toPicture(node *html.Node, asset *Asset) {
+	img := &html.Node{
+		Type: html.ElementNode,
+		Data: "img",
+		Attr: append([]html.Attribute(nil), node.Attr...),
+	}
+
+	source := &html.Node{
+		Type: html.ElementNode,
+		Data: "source",
+		Attr: []html.Attribute{
+			{Key: "type", Val: "image/webp"},
+			{Key: "srcset", Val: asset.WebpSrcset},
+		},
+	}
+	if sizes := imageSizes(node); sizes != "" {
+		source.Attr = append(source.Attr, html.Attribute{Key: "sizes", Val: sizes})
+	}
+
+	node.Data = "picture"
+	node.Attr = nil
+	node.AppendChild(source)
+	node.AppendChild(img)
+}
+
+// imageSizes returns the sizes attribute of the image based on the width it
+// is displayed with in the document.
+func imageSizes(node *html.Node) string {
+	for _, attr := range node.Attr {
+		if attr.Key == "style" {
+			if match := widthRegex.FindStringSubmatch(attr.Val); match != nil {
+				width := strings.Split(match[1], ".")[0]
+				return fmt.Sprintf("(max-width: %spx) 100vw, %spx", width, width)
+			}
+		}
+	}
+	return ""
+}
+
+// ImagesWithoutAltText returns the sources of the images in the HTML content
+// that have no alt text, as referenced by the document.
+func ImagesWithoutAltText(content []byte) ([]string, error) {
+	rootNode, err := html.Parse(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+
+	var sources []string
+	var visit func(node *html.Node)
+	visit = func(node *html.Node) {
+		if node.Type == html.ElementNode && node.Data == "img" && !hasAltText(node) {
+			for _, attr := range node.Attr {
+				if attr.Key == "src" {
+					sources = append(sources, attr.Val)
+				}
+			}
+		}
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			visit(child)
+		}
+	}
+	visit(rootNode)
+	return sources, nil
+}
+
+// hasAltText reports whether the alt text of the image was set in the
+// document. Google Docs exports the images without one as alt="".
+func hasAltText(node *html.Node) bool {
+	for _, attr := range node.Attr {
+		if attr.Key == "alt" {
+			return strings.TrimSpace(attr.Val) != ""
+		}
+	}
+	return false
+}
+
+// BodyContent returns the inner HTML of the body of the post, e.g. to embed it
+// in a feed. URLs relative to the post are resolved against its URL, as
+// readers don't know it, and the hidden elements are removed, as readers
+// mostly drop the styling.
+func BodyContent(content []byte, postUrl string) (string, error) {
+	base, err := url.Parse(postUrl)
+	if err != nil {
+		return "", err
+	}
+	rootNode, err := html.Parse(bytes.NewReader(content))
+	if err != nil {
+		return "", err
+	}
+
+	var body *html.Node
+	var visit func(node *html.Node)
+	visit = func(node *html.Node) {
+		if node.Type == html.ElementNode {
+			if node.Data == "body" && body == nil {
+				body = node
+			}
+			for i, attr := range node.Attr {
+				switch attr.Key {
+				case "href", "src":
+					node.Attr[i].Val = resolveUrl(base, attr.Val)
+				case "srcset":
+					node.Attr[i].Val = resolveSrcset(base, attr.Val)
+				}
+			}
+		}
+		for child := node.FirstChild; child != nil; {
+			next := child.NextSibling
+			if isHidden(child) {
+				node.RemoveChild(child)
+			} else {
+				visit(child)
+			}
+			child = next
+		}
+	}
+	visit(rootNode)
+
+	var b bytes.Buffer
+	if body != nil {
+		for child := body.FirstChild; child != nil; child = child.NextSibling {
+			if err := html.Render(&b, child); err != nil {
+				return "", err
+			}
+		}
+	}
+	return b.String(), nil
+}
+
+func resolveUrl(base *url.URL, ref string) string {
+	u, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return ref
+	}
+	return base.ResolveReference(u).String()
+}
+
+// resolveSrcset resolves the URLs of the candidates, e.g. "a.png 480w".
+func resolveSrcset(base *url.URL, srcset string) string {
+	candidates := strings.Split(srcset, ",")
+	for i, candidate := range candidates {
+		fields := strings.Fields(candidate)
+		if len(fields) > 0 {
+			fields[0] = resolveUrl(base, fields[0])
+		}
+		candidates[i] = strings.Join(fields, " ")
+	}
+	return strings.Join(candidates, ", ")
+}
+
+func setAttr(node *html.Node, key string, val string) {
+	for i, attr := range node.Attr {
+		if attr.Key == key {
+			node.Attr[i].Val = val
+			return
+		}
 	}
-	wg.Wait()
+	node.Attr = append(node.Attr, html.Attribute{Key: key, Val: val})
 }
@@ -0,0 +1,198 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Names of the metadata file of a local source, in the order of precedence.
+var LocalMetadataFileNames = []string{
+	"metadata.json",
+	"metadata.yaml",
+	"metadata.yml",
+}
+
+// LocalSource reads documents exported earlier from a local directory. The
+// directory contains "<docId>.zip" archives along with a metadata file, a
+// JSON or YAML list of the documents.
+type LocalSource struct {
+	dir      string
+	metadata []*GoogleDocMetadata
+}
+
+// localDocMetadata is an entry of the metadata file. Unlike in the frontmatter,
+// the modification time has to be stored as well.
+type localDocMetadata struct {
+	GoogleDocMetadata `yaml:",inline"`
+
+	ModifiedTime time.Time `json:"modified_time,omitempty" yaml:"modified_time,omitempty"`
+}
+
+// NewLocalSource reads the metadata file of the local directory.
+func NewLocalSource(dir string) (*LocalSource, error) {
+	for _, name := range LocalMetadataFileNames {
+		content, err := os.ReadFile(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var entries []*localDocMetadata
+		if filepath.Ext(name) == ".json" {
+			err = json.Unmarshal(content, &entries)
+		} else {
+			err = yaml.Unmarshal(content, &entries)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", name, err)
+		}
+
+		source := &LocalSource{dir: dir}
+		for _, entry := range entries {
+			metadata, err := source.docMetadata(entry)
+			if err != nil {
+				return nil, err
+			}
+			source.metadata = append(source.metadata, metadata)
+		}
+		return source, nil
+	}
+
+	return nil, fmt.Errorf("missing metadata file in %s", dir)
+}
+
+func (ls *LocalSource) docMetadata(entry *localDocMetadata) (*GoogleDocMetadata, error) {
+	metadata := entry.GoogleDocMetadata
+	if metadata.Id == "" {
+		return nil, fmt.Errorf("missing document ID of %s", metadata.Name)
+	}
+	if metadata.Status == "" {
+		metadata.Status = StatusPublished
+	}
+	if metadata.Slug == "" {
+		metadata.Slug = DefaultSlug(metadata.Name)
+	}
+
+	metadata.ModifiedTime = entry.ModifiedTime
+	if metadata.ModifiedTime.IsZero() {
+		// The modification time of the archive is the best approximation.
+		info, err := os.Stat(ls.zipPath(metadata.Id))
+		if err != nil {
+			return nil, err
+		}
+		metadata.ModifiedTime = info.ModTime().UTC()
+	}
+	return &metadata, nil
+}
+
+// ListGoogleDocs lists the documents from the metadata file. The directory
+// ID is ignored, the folders of the documents are matched against the
+// options though.
+func (ls *LocalSource) ListGoogleDocs(
+	driveDirId string,
+	opts ListOptions,
+) ([]*GoogleDocMetadata, error) {
+	var files []*GoogleDocMetadata
+	for _, metadata := range ls.metadata {
+		if metadata.Folder != "" && !opts.Recursive {
+			continue
+		}
+		if ls.isExcluded(metadata.Folder, opts) {
+			log.Printf("Skipping document in excluded directory: %s\n", metadata.Name)
+			continue
+		}
+
+		file := *metadata
+		files = append(files, &file)
+	}
+	return files, nil
+}
+
+func (ls *LocalSource) isExcluded(folder string, opts ListOptions) bool {
+	for ; folder != "." && folder != ""; folder = path.Dir(folder) {
+		if opts.isExcluded(folder) {
+			return true
+		}
+	}
+	return false
+}
+
+func (ls *LocalSource) ExportGoogleDocToZip(file *GoogleDocMetadata) ([]byte, error) {
+	return os.ReadFile(ls.zipPath(file.Id))
+}
+
+// GetIndexSheet returns no metadata, it was already read from the metadata
+// file.
+func (ls *LocalSource) GetIndexSheet(
+	driveDirId string,
+) (map[string]GoogleDocMetadata, error) {
+	return map[string]GoogleDocMetadata{}, nil
+}
+
+// FindIndexSheet returns no metadata, like GetIndexSheet.
+func (ls *LocalSource) FindIndexSheet(
+	driveDirId string,
+) (map[string]GoogleDocMetadata, error) {
+	return ls.GetIndexSheet(driveDirId)
+}
+
+// UpdateIndexMetadata does nothing, the metadata file is never modified so that
+// the builds can be reproduced.
+func (ls *LocalSource) UpdateIndexMetadata(
+	driveDirId string,
+	metadata []*GoogleDocMetadata,
+) error {
+	return nil
+}
+
+func (ls *LocalSource) zipPath(docId string) string {
+	return LocalArchivePath(ls.dir, docId)
+}
+
+// LocalArchivePath returns the path of the exported document in the directory
+// of a local source.
+func LocalArchivePath(dir string, docId string) string {
+	return filepath.Join(dir, docId+".zip")
+}
+
+// WriteLocalMetadata writes the metadata file of a local source, which can be
+// used to build the blog from the archived exports later.
+func WriteLocalMetadata(dir string, metadata []*GoogleDocMetadata) error {
+	entries := make([]*localDocMetadata, len(metadata))
+	for i, m := range metadata {
+		entries[i] = &localDocMetadata{
+			GoogleDocMetadata: *m,
+			ModifiedTime:      m.ModifiedTime,
+		}
+	}
+
+	content, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return WriteFile(
+		filepath.Join(dir, LocalMetadataFileNames[0]), append(content, '\n'))
+}
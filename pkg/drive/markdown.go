@@ -0,0 +1,691 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	HtmlFormat     = "html"
+	MarkdownFormat = "markdown"
+)
+
+var (
+	classRuleRegex  = regexp.MustCompile(`(?:^|})\s*\.([\w-]+)\s*\{([^}]*)`)
+	listLevelRegex  = regexp.MustCompile(`lst-kix_\S+-(\d+)`)
+	listClassRegex  = regexp.MustCompile(`lst-kix_\S+`)
+	monospaceRegex  = regexp.MustCompile(`(?i)font-family:[^;]*(courier|consolas|mono|code)`)
+	whitespaceRegex = regexp.MustCompile(`[ \t\r\n\x{00a0}]+`)
+	blockStartRegex = regexp.MustCompile(`^(#|>|[-+] |\d+[.)] )`)
+)
+
+// Extension returns the file extension of posts written in the provided
+// output format.
+func Extension(format string) string {
+	if format == MarkdownFormat {
+		return ".md"
+	}
+	return ".html"
+}
+
+// WithMarkdownContent fixes the HTML content the same way WithFixedContent
+// does and converts the result into Markdown. Styling that Google Docs
+// expresses with CSS (bold, italics, strikethrough and monospace fonts) is
+// converted into the corresponding Markdown syntax.
+func (doc HtmlDoc) WithMarkdownContent(
+	assets map[string]*Asset,
+) (HtmlDoc, error) {
+	rootNode, err := html.Parse(bytes.NewReader(doc.Content))
+	if err != nil {
+		return doc, err
+	}
+
+	// Styles have to be interpreted before they get stripped.
+	markSemanticStyles(rootNode, parseClassStyles(rootNode))
+	doc.modifyContent(rootNode, assets)
+
+	body := findElement(rootNode, "body")
+	if body == nil {
+		return doc, fmt.Errorf("missing <body> element")
+	}
+
+	r := markdownRenderer{listCounters: map[string]int{}}
+	doc.Content = []byte(r.renderBlocks(body, "") + "\n")
+	return doc, nil
+}
+
+// parseClassStyles returns the declarations of the simple class selectors
+// defined in <style> elements. Google Docs applies most of the text styling
+// through classes like ".c1{font-weight:700}".
+func parseClassStyles(node *html.Node) map[string]string {
+	styles := map[string]string{}
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "style" {
+			for _, match := range classRuleRegex.FindAllStringSubmatch(textContent(n), -1) {
+				styles[match[1]] += match[2] + ";"
+			}
+			return
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(node)
+
+	return styles
+}
+
+// markSemanticStyles replaces <span> elements styled with CSS with their
+// semantic equivalents, e.g. <strong> for bold text.
+func markSemanticStyles(node *html.Node, classStyles map[string]string) {
+	if node.Type == html.ElementNode && node.Data == "span" &&
+		!isInside(node, "h1", "h2", "h3", "h4", "h5", "h6") {
+		style := getAttr(node, "style")
+		for _, class := range strings.Fields(getAttr(node, "class")) {
+			style += ";" + classStyles[class]
+		}
+		style = strings.ReplaceAll(style, " ", "")
+
+		var tags []string
+		if strings.Contains(style, "font-weight:700") ||
+			strings.Contains(style, "font-weight:bold") {
+			tags = append(tags, "strong")
+		}
+		if strings.Contains(style, "font-style:italic") {
+			tags = append(tags, "em")
+		}
+		if strings.Contains(style, "line-through") {
+			tags = append(tags, "del")
+		}
+		if monospaceRegex.MatchString(style) {
+			tags = append(tags, "code")
+		}
+
+		// Images are wrapped in spans with inline styling that is required
+		// to display them, those are left as they are.
+		if len(tags) > 0 && findElement(node, "img") == nil {
+			node.Data = tags[0]
+			node.Attr = nil
+			wrapChildren(node, tags[1:])
+		}
+	}
+
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		markSemanticStyles(child, classStyles)
+	}
+	mergeAdjacentInline(node)
+}
+
+// wrapChildren moves the children of the node into nested elements with the
+// provided tags.
+func wrapChildren(node *html.Node, tags []string) {
+	parent := node
+	for _, tag := range tags {
+		wrapper := &html.Node{Type: html.ElementNode, Data: tag}
+		moveChildren(parent, wrapper)
+		parent.AppendChild(wrapper)
+		parent = wrapper
+	}
+}
+
+// mergeAdjacentInline joins sibling inline elements of the same kind, so that
+// "**a****b**" becomes "**ab**". Google Docs splits text into many spans, so
+// the same styling is often repeated in adjacent elements.
+func mergeAdjacentInline(node *html.Node) {
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type != html.ElementNode || !isSemanticInline(child) {
+			continue
+		}
+
+		merged := false
+		for next := child.NextSibling; next != nil &&
+			next.Type == html.ElementNode &&
+			next.Data == child.Data; next = child.NextSibling {
+			moveChildren(next, child)
+			node.RemoveChild(next)
+			merged = true
+		}
+		if merged {
+			mergeAdjacentInline(child)
+		}
+	}
+}
+
+func moveChildren(src *html.Node, dst *html.Node) {
+	for child := src.FirstChild; child != nil; {
+		next := child.NextSibling
+		src.RemoveChild(child)
+		dst.AppendChild(child)
+		child = next
+	}
+}
+
+func isSemanticInline(node *html.Node) bool {
+	switch node.Data {
+	case "strong", "em", "del", "code":
+		return true
+	}
+	return false
+}
+
+// markdownRenderer converts a fixed HTML tree into Markdown.
+type markdownRenderer struct {
+	// listCounters keeps the numbering of ordered lists. Google Docs splits a
+	// single list into many <ol> elements whenever the nesting level changes.
+	listCounters map[string]int
+}
+
+// renderBlocks renders the block-level children of the node. Every line of
+// the output is prefixed with the indent.
+func (r *markdownRenderer) renderBlocks(node *html.Node, indent string) string {
+	var sb strings.Builder
+	var prev *html.Node
+	var code []string
+
+	flushCode := func() {
+		if code == nil {
+			return
+		}
+		r.separate(&sb, prev, nil)
+		fence := codeFence(strings.Join(code, "\n"), "```")
+		sb.WriteString(indent + fence + "\n")
+		for _, line := range code {
+			sb.WriteString(indent + line + "\n")
+		}
+		sb.WriteString(indent + fence)
+		code = nil
+	}
+
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if isHidden(child) {
+			continue
+		}
+
+		if line, ok := codeLine(child); ok {
+			if code == nil {
+				code = []string{}
+			}
+			code = append(code, line)
+			continue
+		}
+		if code != nil {
+			flushCode()
+			prev = &html.Node{Type: html.ElementNode, Data: "pre"}
+		}
+
+		block := r.renderBlock(child, indent)
+		if strings.TrimSpace(block) == "" {
+			continue
+		}
+		r.separate(&sb, prev, child)
+		sb.WriteString(block)
+		prev = child
+	}
+	flushCode()
+
+	return sb.String()
+}
+
+// separate writes the separator between two consecutive blocks. Consecutive
+// lists are not separated with an empty line, otherwise items of a single
+// Google Docs list would become "loose".
+func (r *markdownRenderer) separate(sb *strings.Builder, prev, next *html.Node) {
+	if sb.Len() == 0 {
+		return
+	}
+	if prev != nil && next != nil && isList(prev) && isList(next) {
+		sb.WriteString("\n")
+		return
+	}
+	sb.WriteString("\n\n")
+}
+
+func (r *markdownRenderer) renderBlock(node *html.Node, indent string) string {
+	if node.Type == html.TextNode {
+		return strings.TrimSpace(r.renderText(node))
+	}
+	if node.Type != html.ElementNode {
+		return ""
+	}
+
+	switch node.Data {
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		level := int(node.Data[1] - '0')
+		text := strings.TrimSpace(r.renderInline(node))
+		if text == "" {
+			return ""
+		}
+		return indent + strings.Repeat("#", level) + " " + text
+	case "p":
+		return indentLines(escapeBlockStart(strings.TrimSpace(r.renderInline(node))), indent)
+	case "ul", "ol":
+		return r.renderList(node, indent)
+	case "table":
+		return r.renderTable(node, indent)
+	case "pre":
+		text := textContent(node)
+		fence := codeFence(text, "```")
+		return indent + fence + "\n" +
+			indentLines(strings.TrimSuffix(text, "\n"), indent) + "\n" +
+			indent + fence
+	case "blockquote":
+		content := r.renderBlocks(node, "")
+		return indentLines(content, indent+"> ")
+	case "hr":
+		return indent + "---"
+	case "div", "section", "article", "tbody", "thead":
+		return r.renderBlocks(node, indent)
+	case "script", "style", "head":
+		return ""
+	default:
+		return indentLines(strings.TrimSpace(r.renderInline(node)), indent)
+	}
+}
+
+func (r *markdownRenderer) renderList(node *html.Node, indent string) string {
+	class := getAttr(node, "class")
+	level := 0
+	if match := listLevelRegex.FindStringSubmatch(class); match != nil {
+		level, _ = strconv.Atoi(match[1])
+	}
+	indent += strings.Repeat("    ", level)
+
+	key := listClassRegex.FindString(class)
+	counter := 0
+	if node.Data == "ol" {
+		if start, err := strconv.Atoi(getAttr(node, "start")); err == nil {
+			counter = start - 1
+		} else if key != "" && !hasClass(node, "start") {
+			counter = r.listCounters[key]
+		}
+	}
+
+	var lines []string
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type != html.ElementNode || child.Data != "li" {
+			continue
+		}
+
+		marker := "- "
+		if node.Data == "ol" {
+			counter++
+			marker = fmt.Sprintf("%d. ", counter)
+		}
+
+		item := r.renderListItem(child, indent+"    ")
+		lines = append(lines, indent+marker+strings.TrimLeft(item, " "))
+	}
+
+	if key != "" {
+		r.listCounters[key] = counter
+	}
+	return strings.Join(lines, "\n")
+}
+
+// renderListItem renders the content of the <li> element. Nested lists are
+// rendered in separate lines with the provided indent.
+func (r *markdownRenderer) renderListItem(node *html.Node, indent string) string {
+	var sb strings.Builder
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.ElementNode && isList(child) {
+			sb.WriteString("\n" + r.renderList(child, indent))
+			continue
+		}
+		if child.Type == html.ElementNode && child.Data == "p" {
+			if sb.Len() > 0 {
+				sb.WriteString("\n" + indent)
+			}
+			sb.WriteString(strings.TrimSpace(r.renderInline(child)))
+			continue
+		}
+		sb.WriteString(r.renderInlineNode(child))
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+func (r *markdownRenderer) renderTable(node *html.Node, indent string) string {
+	var rows [][]string
+	var collectRows func(n *html.Node)
+	collectRows = func(n *html.Node) {
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type != html.ElementNode {
+				continue
+			}
+			if child.Data != "tr" {
+				collectRows(child)
+				continue
+			}
+
+			var row []string
+			for cell := child.FirstChild; cell != nil; cell = cell.NextSibling {
+				if cell.Type == html.ElementNode &&
+					(cell.Data == "td" || cell.Data == "th") {
+					row = append(row, r.renderTableCell(cell))
+				}
+			}
+			rows = append(rows, row)
+		}
+	}
+	collectRows(node)
+
+	if len(rows) == 0 {
+		return ""
+	}
+
+	columns := 0
+	for _, row := range rows {
+		columns = max(columns, len(row))
+	}
+
+	var lines []string
+	for i, row := range rows {
+		for len(row) < columns {
+			row = append(row, "")
+		}
+		lines = append(lines, indent+"| "+strings.Join(row, " | ")+" |")
+
+		// Markdown tables always have a header, the first row is used for it.
+		if i == 0 {
+			separator := strings.Repeat(" --- |", columns)
+			lines = append(lines, indent+"|"+separator)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (r *markdownRenderer) renderTableCell(node *html.Node) string {
+	var parts []string
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		part := strings.TrimSpace(r.renderInlineNode(child))
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	cell := strings.Join(parts, "<br>")
+	cell = strings.ReplaceAll(cell, "\n", "<br>")
+	return strings.ReplaceAll(cell, "|", `\|`)
+}
+
+// renderInline renders the children of the node as inline Markdown.
+func (r *markdownRenderer) renderInline(node *html.Node) string {
+	var sb strings.Builder
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		sb.WriteString(r.renderInlineNode(child))
+	}
+	return sb.String()
+}
+
+func (r *markdownRenderer) renderInlineNode(node *html.Node) string {
+	if isHidden(node) {
+		return ""
+	}
+
+	switch node.Type {
+	case html.TextNode:
+		return escapeMarkdown(r.renderText(node))
+	case html.ElementNode:
+		return r.renderInlineElement(node)
+	}
+	return ""
+}
+
+func (r *markdownRenderer) renderInlineElement(node *html.Node) string {
+	switch node.Data {
+	case "strong", "b":
+		return wrapInline(r.renderInline(node), "**")
+	case "em", "i":
+		return wrapInline(r.renderInline(node), "*")
+	case "del", "s":
+		return wrapInline(r.renderInline(node), "~~")
+	case "code":
+		text := whitespaceRegex.ReplaceAllString(textContent(node), " ")
+		if strings.TrimSpace(text) == "" {
+			return text
+		}
+		fence := codeFence(text, "`")
+		if strings.HasPrefix(text, "`") || strings.HasSuffix(text, "`") {
+			return fence + " " + text + " " + fence
+		}
+		return fence + text + fence
+	case "a":
+		text := strings.TrimSpace(r.renderInline(node))
+		href := getAttr(node, "href")
+		if href == "" || text == "" {
+			return text
+		}
+		return fmt.Sprintf("[%s](%s)", text, escapeUrl(href))
+	case "picture":
+		return renderRawHtml(node)
+	case "img":
+		src := getAttr(node, "src")
+		if src == "" {
+			return ""
+		}
+		// Markdown images can't reference the resized variants.
+		if getAttr(node, "srcset") != "" {
+			return renderRawHtml(node)
+		}
+		alt := escapeMarkdown(getAttr(node, "alt"))
+		if title := getAttr(node, "title"); title != "" {
+			return fmt.Sprintf("![%s](%s %q)", alt, escapeUrl(src), title)
+		}
+		return fmt.Sprintf("![%s](%s)", alt, escapeUrl(src))
+	case "br":
+		return "\\\n"
+	case "ul", "ol", "table", "p", "h1", "h2", "h3", "h4", "h5", "h6":
+		// Block elements are not allowed inside inline content, but they may
+		// appear inside table cells.
+		return strings.TrimSpace(r.renderInline(node))
+	default:
+		return r.renderInline(node)
+	}
+}
+
+// renderRawHtml renders the element as HTML, which Markdown allows inline.
+func renderRawHtml(node *html.Node) string {
+	var b bytes.Buffer
+	if err := html.Render(&b, node); err != nil {
+		return ""
+	}
+	return b.String()
+}
+
+func (r *markdownRenderer) renderText(node *html.Node) string {
+	return whitespaceRegex.ReplaceAllString(node.Data, " ")
+}
+
+// codeLine returns the content of a paragraph that is entirely formatted with
+// a monospace font. Google Docs has no code blocks, so consecutive lines like
+// this are turned into one.
+func codeLine(node *html.Node) (string, bool) {
+	if node.Type != html.ElementNode || node.Data != "p" {
+		return "", false
+	}
+
+	monospace := false
+	var check func(n *html.Node) bool
+	check = func(n *html.Node) bool {
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			switch child.Type {
+			case html.TextNode:
+				if strings.TrimSpace(child.Data) != "" {
+					return false
+				}
+			case html.ElementNode:
+				if child.Data == "code" {
+					monospace = true
+					continue
+				}
+				if child.Data == "img" || !check(child) {
+					return false
+				}
+			}
+		}
+		return true
+	}
+
+	if !check(node) || !monospace {
+		return "", false
+	}
+	return strings.ReplaceAll(textContent(node), "\u00a0", " "), true
+}
+
+// codeFence returns a fence that doesn't occur in the content.
+func codeFence(content string, fence string) string {
+	for strings.Contains(content, fence) {
+		fence += fence[:1]
+	}
+	return fence
+}
+
+// wrapInline wraps the text with the emphasis marker. Markdown doesn't allow
+// whitespace right inside the markers, so it's moved outside.
+func wrapInline(text string, marker string) string {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		return text
+	}
+
+	start := strings.Index(text, trimmed)
+	return text[:start] + marker + trimmed + marker + text[start+len(trimmed):]
+}
+
+func escapeMarkdown(text string) string {
+	var sb strings.Builder
+	for _, c := range text {
+		switch c {
+		case '\\', '`', '*', '_', '[', ']', '<', '~':
+			sb.WriteRune('\\')
+		}
+		sb.WriteRune(c)
+	}
+	return sb.String()
+}
+
+// escapeBlockStart escapes text that would otherwise be interpreted as the
+// beginning of a heading, quote or list.
+func escapeBlockStart(text string) string {
+	if loc := blockStartRegex.FindStringIndex(text); loc != nil {
+		// Escaping the last character of the marker works for all of them,
+		// e.g. "1\. " or "\# ".
+		if text[0] >= '0' && text[0] <= '9' {
+			i := strings.IndexAny(text, ".)")
+			return text[:i] + "\\" + text[i:]
+		}
+		return "\\" + text
+	}
+	return text
+}
+
+func escapeUrl(url string) string {
+	return strings.NewReplacer(" ", "%20", "(", "%28", ")", "%29").Replace(url)
+}
+
+func indentLines(text string, indent string) string {
+	if indent == "" || text == "" {
+		return text
+	}
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(indent+line, " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+func textContent(node *html.Node) string {
+	if node.Type == html.TextNode {
+		return node.Data
+	}
+
+	var sb strings.Builder
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.ElementNode && child.Data == "br" {
+			sb.WriteByte('\n')
+			continue
+		}
+		sb.WriteString(textContent(child))
+	}
+	return sb.String()
+}
+
+func findElement(node *html.Node, tag string) *html.Node {
+	if node.Type == html.ElementNode && node.Data == tag {
+		return node
+	}
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if found := findElement(child, tag); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func getAttr(node *html.Node, key string) string {
+	for _, attr := range node.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+func hasClass(node *html.Node, class string) bool {
+	for _, c := range strings.Fields(getAttr(node, "class")) {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+func isInside(node *html.Node, tags ...string) bool {
+	for parent := node.Parent; parent != nil; parent = parent.Parent {
+		for _, tag := range tags {
+			if parent.Type == html.ElementNode && parent.Data == tag {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isList(node *html.Node) bool {
+	return node.Type == html.ElementNode && (node.Data == "ul" || node.Data == "ol")
+}
+
+// isHidden reports whether the element was hidden by modifyContent, or
+// was not visible in the document in the first place. The title and subtitle
+// are always skipped, they should be taken from the frontmatter.
+func isHidden(node *html.Node) bool {
+	if node.Type != html.ElementNode {
+		return false
+	}
+	if hasClass(node, "title") || hasClass(node, "subtitle") {
+		return true
+	}
+	style := strings.ReplaceAll(getAttr(node, "style"), " ", "")
+	return strings.Contains(style, HideStyle) ||
+		strings.Contains(style, "display:none")
+}
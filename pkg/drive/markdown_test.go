@@ -0,0 +1,203 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"testing"
+)
+
+// exportedDoc wraps the body the way Google Docs exports it, with the text
+// styling defined in classes.
+func exportedDoc(body string) []byte {
+	return []byte(`<html><head><meta content="text/html; charset=UTF-8">` +
+		`<style type="text/css">` +
+		`.c1{font-weight:700}.c2{font-style:italic}` +
+		`.c3{font-family:"Courier New";font-weight:400}` +
+		`.c4{text-decoration:line-through}` +
+		`</style></head>` +
+		`<body class="c5 doc-content" style="max-width:468pt">` + body +
+		`</body></html>`)
+}
+
+func TestWithMarkdownContent(t *testing.T) {
+	assets := map[string]*Asset{
+		"images/image1.png": {Source: "images/image1.png", Url: "/assets/hello/image1.png"},
+		"images/image2.png": {
+			Source: "images/image2.png",
+			Url:    "/assets/hello/image2.png",
+			Alt:    "A cat on a keyboard",
+		},
+		"images/image3.png": {
+			Source: "images/image3.png",
+			Url:    "/assets/hello/image3.png",
+			Width:  800,
+			Height: 600,
+			Srcset: "/assets/hello/image3-400.png 400w, /assets/hello/image3.png 800w",
+		},
+	}
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			name: "title and subtitle",
+			body: `<p class="title"><span>Hello</span></p>` +
+				`<p class="subtitle"><span>World</span></p>` +
+				`<p><span>Content</span></p>`,
+			want: "Content\n",
+		},
+		{
+			name: "headings",
+			body: `<h1 id="h.1"><span class="c1">Introduction</span></h1>` +
+				`<p><span>Text</span></p>` +
+				`<h2><span>Details</span></h2>` +
+				`<h3><span></span></h3>`,
+			want: "## Introduction\n\nText\n\n### Details\n",
+		},
+		{
+			name: "inline styles",
+			body: `<p><span class="c1">bold</span><span> and </span>` +
+				`<span class="c1 c2">both </span><span class="c1">merged</span>` +
+				`<span> </span><span class="c4">gone</span>` +
+				`<span> </span><span class="c3">x := 1</span></p>`,
+			// Adjacent bold spans are merged.
+			want: "**bold** and ***both* merged** ~~gone~~ `x := 1`\n",
+		},
+		{
+			name: "nested lists",
+			body: `<ul class="c6 lst-kix_abc-0 start"><li class="c7"><span>One</span></li></ul>` +
+				`<ul class="c6 lst-kix_abc-1 start"><li><span>Nested</span></li>` +
+				`<li><span>Another</span></li></ul>` +
+				`<ul class="c6 lst-kix_abc-0"><li><span>Two</span></li></ul>` +
+				`<p><span>After</span></p>`,
+			want: "- One\n    - Nested\n    - Another\n- Two\n\nAfter\n",
+		},
+		{
+			name: "continued ordered list",
+			body: `<ol class="lst-kix_num-0 start" start="1"><li><span>First</span></li></ol>` +
+				`<ol class="lst-kix_num-1 start" start="1"><li><span>Sub</span></li></ol>` +
+				`<ol class="lst-kix_num-0"><li><span>Second</span></li>` +
+				`<li><span>Third</span></li></ol>`,
+			want: "1. First\n    1. Sub\n2. Second\n3. Third\n",
+		},
+		{
+			name: "table",
+			body: `<table><tr><td><p><span>Name</span></p></td><td><p><span>Value</span></p></td></tr>` +
+				`<tr><td><p><span>a|b</span></p></td><td><p><span>1</span></p><p><span>2</span></p></td></tr>` +
+				`<tr><td><p><span class="c1">short</span></p></td></tr></table>`,
+			want: "| Name | Value |\n" +
+				"| --- | --- |\n" +
+				"| a\\|b | 1<br>2 |\n" +
+				"| **short** |  |\n",
+		},
+		{
+			name: "code block",
+			body: `<p><span>Code:</span></p>` +
+				`<p><span class="c3">func main() {</span></p>` +
+				`<p><span class="c3">&nbsp; return</span></p>` +
+				`<p><span class="c3">}</span></p>` +
+				`<p><span>Done</span></p>`,
+			want: "Code:\n\n```\nfunc main() {\n  return\n}\n```\n\nDone\n",
+		},
+		{
+			name: "code block with a fence",
+			body: "<p><span class=\"c3\">```go</span></p>" +
+				`<p><span class="c3">x := 1</span></p>`,
+			want: "````\n```go\nx := 1\n````\n",
+		},
+		{
+			name: "links",
+			body: `<p><span>See </span><span><a href="https://www.google.com/url?q=https://example.com/a&amp;sa=D&amp;ts=1">` +
+				`the docs</a></span><span> and </span>` +
+				`<a href="https://example.com/a page (1)">another</a>` +
+				`<span> or </span><a href="https://example.com/empty"></a></p>`,
+			want: "See [the docs](https://example.com/a) and " +
+				"[another](https://example.com/a%20page%20%281%29) or\n",
+		},
+		{
+			name: "images",
+			body: `<p><span style="display:inline-block;width:400px"><img alt="A dog" src="images/image1.png"></span></p>` +
+				`<p><span><img src="images/image2.png" title="Cat"></span></p>` +
+				`<p><span><img src="images/image3.png" style="width:400px"></span></p>`,
+			want: "![A dog](/assets/hello/image1.png)\n\n" +
+				"![A cat on a keyboard](/assets/hello/image2.png \"Cat\")\n\n" +
+				`<img src="/assets/hello/image3.png" style="width:400px;" width="800" height="600" ` +
+				`srcset="/assets/hello/image3-400.png 400w, /assets/hello/image3.png 800w" ` +
+				`sizes="(max-width: 400px) 100vw, 400px" loading="lazy"/>` + "\n",
+		},
+		{
+			name: "escaped metacharacters",
+			body: `<p><span>2 * 3 = 6, snake_case, [link], &lt;tag&gt;, ~tilde, ` + "`tick`" + ` and C:\path</span></p>`,
+			want: "2 \\* 3 = 6, snake\\_case, \\[link\\], \\<tag>, \\~tilde, \\`tick\\` and C:\\\\path\n",
+		},
+		{
+			name: "escaped block start",
+			body: `<p><span># Not a heading</span></p>` +
+				`<p><span>&gt; Not a quote</span></p>` +
+				`<p><span>- Not a list</span></p>` +
+				`<p><span>+ Not a list</span></p>` +
+				`<p><span>2024. Not a list</span></p>` +
+				`<p><span>1) Not a list</span></p>` +
+				`<p><span>-1 is a number</span></p>`,
+			want: "\\# Not a heading\n\n" +
+				"\\> Not a quote\n\n" +
+				"\\- Not a list\n\n" +
+				"\\+ Not a list\n\n" +
+				"2024\\. Not a list\n\n" +
+				"1\\) Not a list\n\n" +
+				"-1 is a number\n",
+		},
+		{
+			name: "escaped alt text",
+			body: `<p><img alt="[*]" src="images/image1.png"></p>`,
+			want: "![\\[\\*\\]](/assets/hello/image1.png)\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := HtmlDoc{
+				GoogleDocMetadata: GoogleDocMetadata{Name: "Hello"},
+				Content:           exportedDoc(tt.body),
+			}
+			got, err := doc.WithMarkdownContent(assets)
+			if err != nil {
+				t.Fatalf("WithMarkdownContent() failed: %v", err)
+			}
+			if string(got.Content) != tt.want {
+				t.Errorf("WithMarkdownContent() =\n%s\nwant:\n%s", got.Content, tt.want)
+			}
+		})
+	}
+}
+
+func TestCodeFence(t *testing.T) {
+	tests := []struct {
+		content string
+		fence   string
+		want    string
+	}{
+		{"x := 1", "```", "```"},
+		{"```go", "```", "````"},
+		{"a ```` b", "```", "`````"},
+		{"no ticks", "`", "`"},
+		{"a `b` c", "`", "``"},
+	}
+	for _, tt := range tests {
+		if got := codeFence(tt.content, tt.fence); got != tt.want {
+			t.Errorf("codeFence(%q, %q) = %q, want %q", tt.content, tt.fence, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"bytes"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// PlainText extracts the text of the exported HTML document, e.g. to be sent
+// to a language model. The markup and styling are dropped, except for the
+// structure: blocks are put on separate lines, headings are prefixed with "#"
+// according to their level and list items with "-".
+func PlainText(content []byte) (string, error) {
+	rootNode, err := html.Parse(bytes.NewReader(content))
+	if err != nil {
+		return "", err
+	}
+
+	var w plainTextWriter
+	w.write(rootNode)
+	w.flush()
+	return strings.Join(w.lines, "\n"), nil
+}
+
+// plainTextWriter collects the text of the blocks, one line each.
+type plainTextWriter struct {
+	lines []string
+	// line is the text of the current block, prefix is its marker.
+	line   strings.Builder
+	prefix string
+	// inCell is set within table cells, whose paragraphs stay on the line of
+	// the row.
+	inCell bool
+}
+
+func (w *plainTextWriter) write(node *html.Node) {
+	block := false
+	switch node.Type {
+	case html.TextNode:
+		w.line.WriteString(node.Data)
+		return
+	case html.ElementNode:
+		switch node.Data {
+		case "head", "script", "style":
+			return
+		case "h1", "h2", "h3", "h4", "h5", "h6":
+			w.flush()
+			w.prefix = strings.Repeat("#", int(node.Data[1]-'0')) + " "
+			block = true
+		case "li":
+			w.flush()
+			w.prefix = "- "
+			block = true
+		case "p", "div":
+			if w.inCell {
+				w.line.WriteString(" ")
+				break
+			}
+			w.flush()
+			block = true
+		case "tr", "blockquote", "pre", "table", "ul", "ol", "hr":
+			w.flush()
+			block = true
+		case "td", "th":
+			if w.line.Len() > 0 {
+				w.line.WriteString(" | ")
+			}
+			inCell := w.inCell
+			w.inCell = true
+			defer func() { w.inCell = inCell }()
+		case "br":
+			w.line.WriteString(" ")
+		}
+	}
+
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		w.write(child)
+	}
+	if block {
+		w.flush()
+	}
+}
+
+// flush ends the current block, empty blocks are skipped.
+func (w *plainTextWriter) flush() {
+	text := whitespaceRegex.ReplaceAllString(w.line.String(), " ")
+	if text = strings.TrimSpace(text); text != "" {
+		w.lines = append(w.lines, w.prefix+text)
+	}
+	w.line.Reset()
+	w.prefix = ""
+}
@@ -0,0 +1,88 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"testing"
+)
+
+func TestPlainText(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			name: "paragraphs",
+			body: `<p class="c1"><span>First</span> <span class="c2">paragraph</span></p>` +
+				`<p><span>Second</span></p>`,
+			want: "First paragraph\nSecond",
+		},
+		{
+			name: "headings",
+			body: `<h1><span>Title</span></h1><h2>Section</h2><h3>Subsection</h3>` +
+				`<h6>Smallest</h6><p>Text</p>`,
+			want: "# Title\n## Section\n### Subsection\n###### Smallest\nText",
+		},
+		{
+			name: "lists",
+			body: `<p>Intro</p><ul><li><span>One</span></li><li>Two</li></ul>` +
+				`<ol><li>First</li></ol><p>Outro</p>`,
+			want: "Intro\n- One\n- Two\n- First\nOutro",
+		},
+		{
+			name: "tables",
+			body: `<table><tr><td><p>Name</p></td><td><p>Value</p></td></tr>` +
+				`<tr><td><p>a</p><p>b</p></td><td>1</td></tr></table>`,
+			want: "Name | Value\na b | 1",
+		},
+		{
+			name: "whitespace",
+			body: "<p>  Line\n  wrapped\tby the   editor  </p><p>Break<br>here</p>",
+			want: "Line wrapped by the editor\nBreak here",
+		},
+		{
+			name: "empty blocks",
+			body: `<p></p><p> </p><p><span></span></p><hr><p>Text</p><div></div>`,
+			want: "Text",
+		},
+		{
+			name: "multi-byte runes",
+			body: `<p>Zażółć gęślą jaźń</p><p>🚀 launch</p>`,
+			want: "Zażółć gęślą jaźń\n🚀 launch",
+		},
+		{
+			name: "scripts",
+			body: `<script>var x = 1;</script><p>Text</p><style>p{}</style>`,
+			want: "Text",
+		},
+		{
+			name: "images",
+			body: `<p><img src="images/image1.png" alt="A cat"></p><p>Caption</p>`,
+			want: "Caption",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := PlainText(exportedDoc(tt.body))
+			if err != nil {
+				t.Fatalf("PlainText() failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("PlainText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
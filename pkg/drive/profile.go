@@ -0,0 +1,267 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// GeneratorProfile describes the conventions of a static site generator that
+// the posts are written for.
+type GeneratorProfile struct {
+	// FrontmatterFormat is either YamlFrontmatter or TomlFrontmatter.
+	FrontmatterFormat string
+	// Keys are the names of the frontmatter fields.
+	Keys FrontmatterKeys
+	// ExtraKey, if set, is the name of the table that holds the fields not
+	// known to the generator.
+	ExtraKey string
+	// TaxonomiesKey, if set, is the name of the table that holds the
+	// taxonomies, e.g. categories.
+	TaxonomiesKey string
+	// Layout is the default layout of the posts, empty if none.
+	Layout string
+	// DatePrefix controls whether file names start with the publication date.
+	DatePrefix bool
+	// PageBundle controls whether each post is written into its own directory
+	// (as "index.html") along with its assets.
+	PageBundle bool
+	// HtmlExtension is the extension of HTML posts. Some generators only
+	// support Markdown content files, which may contain raw HTML anyway.
+	HtmlExtension string
+	// Permalink is the pattern of the post URLs, see Permalink.
+	Permalink string
+	// Unlisted are the frontmatter fields that keep a post out of the
+	// listings of the generator while still rendering it. Empty if the
+	// generator has no such option, then unlisted posts are listed.
+	Unlisted Frontmatter
+}
+
+// FrontmatterKeys are the names of the frontmatter fields.
+type FrontmatterKeys struct {
+	Categories   string
+	Date         string
+	Description  string
+	Id           string
+	Layout       string
+	RedirectFrom string
+	Tags         string
+	Title        string
+}
+
+// GeneratorProfiles contains the supported static site generators.
+var GeneratorProfiles = map[string]*GeneratorProfile{
+	"jekyll": {
+		FrontmatterFormat: YamlFrontmatter,
+		Keys: FrontmatterKeys{
+			Categories:   "categories",
+			Date:         "date",
+			Description:  "excerpt",
+			Id:           "google_doc_id",
+			Layout:       "layout",
+			RedirectFrom: "redirect_from",
+			Tags:         "tags",
+			Title:        "title",
+		},
+		Layout:        "post",
+		DatePrefix:    true,
+		HtmlExtension: ".html",
+		Permalink:     "/:categories/:year/:month/:day/:slug.html",
+		Unlisted:      Frontmatter{{"published", false}},
+	},
+	"hugo": {
+		FrontmatterFormat: TomlFrontmatter,
+		Keys: FrontmatterKeys{
+			Categories:   "categories",
+			Date:         "date",
+			Description:  "description",
+			Id:           "google_doc_id",
+			Layout:       "layout",
+			RedirectFrom: "aliases",
+			Tags:         "tags",
+			Title:        "title",
+		},
+		PageBundle:    true,
+		HtmlExtension: ".html",
+		Permalink:     "/posts/:slug/",
+		Unlisted: Frontmatter{
+			{"build", Frontmatter{{"list", "never"}}},
+		},
+	},
+	"zola": {
+		FrontmatterFormat: TomlFrontmatter,
+		Keys: FrontmatterKeys{
+			Categories:   "categories",
+			Date:         "date",
+			Description:  "description",
+			Id:           "google_doc_id",
+			Layout:       "template",
+			RedirectFrom: "aliases",
+			Tags:         "tags",
+			Title:        "title",
+		},
+		ExtraKey:      "extra",
+		TaxonomiesKey: "taxonomies",
+		DatePrefix:    true,
+		HtmlExtension: ".md",
+		// Zola lists all the pages of a section, there is no way to keep
+		// a page out of it but to move the page to another section.
+		Permalink: "/:slug/",
+	},
+	"eleventy": {
+		FrontmatterFormat: YamlFrontmatter,
+		Keys: FrontmatterKeys{
+			Categories:   "categories",
+			Date:         "date",
+			Description:  "description",
+			Id:           "google_doc_id",
+			Layout:       "layout",
+			RedirectFrom: "redirect_from",
+			Tags:         "tags",
+			Title:        "title",
+		},
+		Layout:        "post",
+		HtmlExtension: ".html",
+		Permalink:     "/posts/:slug/",
+		Unlisted: Frontmatter{
+			{"eleventyExcludeFromCollections", true},
+		},
+	},
+}
+
+// With returns a copy of the profile with the default layout and the permalink
+// pattern overridden, unless empty.
+func (p *GeneratorProfile) With(layout string, permalink string) *GeneratorProfile {
+	profile := *p
+	if layout != "" {
+		profile.Layout = layout
+	}
+	if permalink != "" {
+		profile.Permalink = permalink
+	}
+	return &profile
+}
+
+// Frontmatter returns the frontmatter fields describing the document.
+func (p *GeneratorProfile) Frontmatter(m *GoogleDocMetadata) Frontmatter {
+	var fm, taxonomies, extra Frontmatter
+	if p.Layout != "" {
+		fm = append(fm, FrontmatterField{p.Keys.Layout, p.Layout})
+	}
+	fm = append(fm,
+		FrontmatterField{p.Keys.Date, m.CreatedTime},
+		FrontmatterField{p.Keys.Description, m.Description},
+	)
+	if p.ExtraKey == "" {
+		fm = append(fm, FrontmatterField{p.Keys.Id, m.Id})
+	} else {
+		extra = append(extra, FrontmatterField{p.Keys.Id, m.Id})
+	}
+	fm = append(fm, FrontmatterField{p.Keys.Title, m.Name})
+
+	// Unlisted posts are generated, but they shouldn't be linked anywhere.
+	if m.Status == StatusUnlisted {
+		fm = append(fm, p.Unlisted...)
+	}
+
+	// Previous URLs of the post, so that the generator can redirect them.
+	if redirects := m.RedirectPermalinks(p.Permalink); len(redirects) > 0 {
+		fm = append(fm, FrontmatterField{p.Keys.RedirectFrom, redirects})
+	}
+
+	if categories := m.AllCategories(); len(categories) > 0 {
+		taxonomies = append(taxonomies,
+			FrontmatterField{p.Keys.Categories, categories})
+	}
+	if len(m.Tags) > 0 {
+		taxonomies = append(taxonomies, FrontmatterField{p.Keys.Tags, m.Tags})
+	}
+
+	if p.TaxonomiesKey == "" {
+		fm = append(fm, taxonomies...)
+	} else if len(taxonomies) > 0 {
+		fm = append(fm, FrontmatterField{p.TaxonomiesKey, taxonomies})
+	}
+	if len(extra) > 0 {
+		fm = append(fm, FrontmatterField{p.ExtraKey, extra})
+	}
+	return fm
+}
+
+// PostPath returns the path of the post relative to the posts output
+// directory.
+func (p *GeneratorProfile) PostPath(m *GoogleDocMetadata, format string) string {
+	ext := Extension(format)
+	if format == HtmlFormat {
+		ext = p.HtmlExtension
+	}
+
+	if p.PageBundle {
+		return path.Join(m.FileName(p.DatePrefix), "index"+ext)
+	}
+	return m.FileName(p.DatePrefix) + ext
+}
+
+// AssetUrl returns the URL the post uses to reference the asset. Page bundles
+// reference co-located assets with relative URLs.
+func (p *GeneratorProfile) AssetUrl(
+	assetPathPrefix string,
+	docId string,
+	assetRelativePath string,
+) string {
+	if p.PageBundle {
+		return filepath.Base(assetRelativePath)
+	}
+	return "/" + NormalizedAssetPath(assetPathPrefix, docId, assetRelativePath)
+}
+
+// Permalink returns the URL path of the post based on the pattern, e.g.
+// "/:year/:month/:day/:slug/". Supported placeholders are :year, :month, :day,
+// :slug (also available as :title) and :categories.
+func (m *GoogleDocMetadata) Permalink(pattern string) string {
+	return m.permalink(pattern, m.FileName(false))
+}
+
+// RedirectPermalinks returns the URL paths of the post under its previous
+// slugs, see Permalink.
+func (m *GoogleDocMetadata) RedirectPermalinks(pattern string) []string {
+	var permalinks []string
+	for _, slug := range m.RedirectFrom {
+		// The slug might have been changed back to one of the previous ones.
+		if slug != m.Slug {
+			permalinks = append(permalinks, m.permalink(pattern, slug))
+		}
+	}
+	return permalinks
+}
+
+func (m *GoogleDocMetadata) permalink(pattern string, slug string) string {
+	permalink := strings.NewReplacer(
+		":year", m.CreatedTime.Format("2006"),
+		":month", m.CreatedTime.Format("01"),
+		":day", m.CreatedTime.Format("02"),
+		":slug", slug,
+		":title", slug,
+		":categories", strings.Join(m.AllCategories(), "/"),
+	).Replace(pattern)
+
+	// Placeholders may be empty, e.g. when there are no categories.
+	for strings.Contains(permalink, "//") {
+		permalink = strings.ReplaceAll(permalink, "//", "/")
+	}
+	return permalink
+}
@@ -0,0 +1,78 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFrontmatterUnlisted(t *testing.T) {
+	tests := []struct {
+		profile string
+		want    string
+		// notWant must not be in the frontmatter of an unlisted post.
+		notWant string
+	}{
+		{profile: "jekyll", want: "\npublished: false\n"},
+		{profile: "hugo", want: "\n[build]\nlist = \"never\"\n", notWant: "published"},
+		{profile: "eleventy", want: "\neleventyExcludeFromCollections: true\n", notWant: "published"},
+		{profile: "zola", notWant: "published"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.profile, func(t *testing.T) {
+			profile := GeneratorProfiles[tt.profile]
+			metadata := &GoogleDocMetadata{
+				Id:          "doc1",
+				Name:        "Title",
+				CreatedTime: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+			}
+
+			listed, err := profile.Frontmatter(metadata).Marshal(profile.FrontmatterFormat)
+			if err != nil {
+				t.Fatalf("Marshal() failed: %v", err)
+			}
+			metadata.Status = StatusUnlisted
+			unlisted, err := profile.Frontmatter(metadata).Marshal(profile.FrontmatterFormat)
+			if err != nil {
+				t.Fatalf("Marshal() failed: %v", err)
+			}
+
+			if tt.want != "" {
+				if !strings.Contains(string(unlisted), tt.want) {
+					t.Errorf("unlisted frontmatter = %q, want it to contain %q", unlisted, tt.want)
+				}
+				if strings.Contains(string(listed), tt.want) {
+					t.Errorf("listed frontmatter = %q, want it not to contain %q", listed, tt.want)
+				}
+			}
+			if tt.notWant != "" && strings.Contains(string(unlisted), tt.notWant) {
+				t.Errorf("unlisted frontmatter = %q, want it not to contain %q", unlisted, tt.notWant)
+			}
+
+			// The fields must survive the round trip, e.g. for the preview.
+			fm, _, err := UnmarshalFrontmatter(unlisted)
+			if err != nil {
+				t.Fatalf("UnmarshalFrontmatter() failed: %v", err)
+			}
+			for _, field := range profile.Unlisted {
+				if _, ok := fm.Get(field.Key); !ok {
+					t.Errorf("unmarshaled frontmatter has no %q", field.Key)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"time"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// DocLister lists the Google Documents of the blog.
+type DocLister interface {
+	// ListGoogleDocs lists the documents in the provided directory.
+	ListGoogleDocs(driveDirId string, opts ListOptions) ([]*GoogleDocMetadata, error)
+}
+
+// DocExporter exports the Google Documents.
+type DocExporter interface {
+	// ExportGoogleDocToZip returns the document exported to a zipped HTML
+	// file, see Unzip.
+	ExportGoogleDocToZip(file *GoogleDocMetadata) ([]byte, error)
+}
+
+// Source provides the Google Documents of the blog along with their exports.
+type Source interface {
+	DocLister
+	DocExporter
+}
+
+// IndexStore stores the metadata of the documents modifiable by the authors,
+// see DriveService.GetIndexSheet. FindIndexSheet never creates the store, it's
+// used when nothing may be written.
+type IndexStore interface {
+	GetIndexSheet(driveDirId string) (map[string]GoogleDocMetadata, error)
+	FindIndexSheet(driveDirId string) (map[string]GoogleDocMetadata, error)
+	UpdateIndexMetadata(driveDirId string, metadata []*GoogleDocMetadata) error
+}
+
+// ChangeSource reports the changes to the documents, so that only the changed
+// ones have to be processed.
+type ChangeSource interface {
+	GetStartPageToken() (string, error)
+	ListChanges(pageToken string) (*Changes, error)
+}
+
+// ChangeNotifier pushes the notifications of the changes to a webhook, see
+// DriveService.WatchChanges.
+type ChangeNotifier interface {
+	WatchChanges(
+		pageToken string,
+		address string,
+		token string,
+		ttl time.Duration,
+	) (*drive.Channel, error)
+	StopChannel(channel *drive.Channel) error
+}
+
+var (
+	_ Source         = (*DriveService)(nil)
+	_ IndexStore     = (*DriveService)(nil)
+	_ ChangeSource   = (*DriveService)(nil)
+	_ ChangeNotifier = (*DriveService)(nil)
+	_ Source         = (*LocalSource)(nil)
+	_ IndexStore     = (*LocalSource)(nil)
+)
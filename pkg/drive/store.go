@@ -0,0 +1,179 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"context"
+	"io"
+
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/sheets/v4"
+)
+
+// FileStore is the subset of the Google Drive API used by DriveService.
+type FileStore interface {
+	// ListFiles returns a page of the files matching the query, see
+	// https://developers.google.com/drive/api/guides/search-files.
+	ListFiles(
+		ctx context.Context,
+		query string,
+		fields string,
+		pageToken string,
+	) (*drive.FileList, error)
+	// ExportFile returns the content of the Google Workspace document
+	// converted to the provided MIME type.
+	ExportFile(ctx context.Context, fileId string, mimeType string) ([]byte, error)
+	// AddParent moves the file into the directory.
+	AddParent(ctx context.Context, fileId string, parentId string) error
+	// GetStartPageToken returns the cursor of the changes made from now on.
+	GetStartPageToken(ctx context.Context) (string, error)
+	// ListChanges returns a page of the changes made since the cursor, see
+	// https://developers.google.com/drive/api/guides/manage-changes.
+	ListChanges(
+		ctx context.Context,
+		pageToken string,
+		fields string,
+	) (*drive.ChangeList, error)
+	// WatchChanges opens a channel receiving the notifications of the changes
+	// made since the cursor, see
+	// https://developers.google.com/drive/api/guides/push.
+	WatchChanges(
+		ctx context.Context,
+		pageToken string,
+		channel *drive.Channel,
+	) (*drive.Channel, error)
+	// StopChannel stops the notifications of the channel.
+	StopChannel(ctx context.Context, channel *drive.Channel) error
+}
+
+// SheetStore is the subset of the Google Sheets API used by DriveService.
+type SheetStore interface {
+	// GetSpreadsheet returns the spreadsheet along with its grid data.
+	GetSpreadsheet(ctx context.Context, spreadsheetId string) (*sheets.Spreadsheet, error)
+	CreateSpreadsheet(
+		ctx context.Context,
+		spreadsheet *sheets.Spreadsheet,
+	) (*sheets.Spreadsheet, error)
+	BatchUpdate(
+		ctx context.Context,
+		spreadsheetId string,
+		request *sheets.BatchUpdateSpreadsheetRequest,
+	) error
+}
+
+// googleFileStore sends the requests to Google Drive.
+type googleFileStore struct {
+	srv *drive.Service
+}
+
+func (fs googleFileStore) ListFiles(
+	ctx context.Context,
+	query string,
+	fields string,
+	pageToken string,
+) (*drive.FileList, error) {
+	call := fs.srv.Files.List().Context(ctx).Fields(googleapi.Field(fields)).Q(query)
+	if pageToken != "" {
+		call.PageToken(pageToken)
+	}
+	return call.Do()
+}
+
+func (fs googleFileStore) ExportFile(
+	ctx context.Context,
+	fileId string,
+	mimeType string,
+) ([]byte, error) {
+	resp, err := fs.srv.Files.Export(fileId, mimeType).Context(ctx).Download()
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+func (fs googleFileStore) AddParent(
+	ctx context.Context,
+	fileId string,
+	parentId string,
+) error {
+	_, err := fs.srv.Files.Update(fileId, nil).Context(ctx).AddParents(parentId).Do()
+	return err
+}
+
+func (fs googleFileStore) GetStartPageToken(ctx context.Context) (string, error) {
+	token, err := fs.srv.Changes.GetStartPageToken().Context(ctx).Do()
+	if err != nil {
+		return "", err
+	}
+	return token.StartPageToken, nil
+}
+
+func (fs googleFileStore) ListChanges(
+	ctx context.Context,
+	pageToken string,
+	fields string,
+) (*drive.ChangeList, error) {
+	return fs.srv.Changes.List(pageToken).
+		Context(ctx).
+		Fields(googleapi.Field(fields)).
+		Do()
+}
+
+func (fs googleFileStore) WatchChanges(
+	ctx context.Context,
+	pageToken string,
+	channel *drive.Channel,
+) (*drive.Channel, error) {
+	return fs.srv.Changes.Watch(pageToken, channel).Context(ctx).Do()
+}
+
+func (fs googleFileStore) StopChannel(ctx context.Context, channel *drive.Channel) error {
+	return fs.srv.Channels.Stop(channel).Context(ctx).Do()
+}
+
+// googleSheetStore sends the requests to Google Sheets.
+type googleSheetStore struct {
+	srv *sheets.Service
+}
+
+func (ss googleSheetStore) GetSpreadsheet(
+	ctx context.Context,
+	spreadsheetId string,
+) (*sheets.Spreadsheet, error) {
+	return ss.srv.Spreadsheets.Get(spreadsheetId).
+		Context(ctx).
+		IncludeGridData(true).
+		Do()
+}
+
+func (ss googleSheetStore) CreateSpreadsheet(
+	ctx context.Context,
+	spreadsheet *sheets.Spreadsheet,
+) (*sheets.Spreadsheet, error) {
+	return ss.srv.Spreadsheets.Create(spreadsheet).Context(ctx).Do()
+}
+
+func (ss googleSheetStore) BatchUpdate(
+	ctx context.Context,
+	spreadsheetId string,
+	request *sheets.BatchUpdateSpreadsheetRequest,
+) error {
+	_, err := ss.srv.Spreadsheets.BatchUpdate(spreadsheetId, request).
+		Context(ctx).
+		Do()
+	return err
+}
@@ -15,13 +15,45 @@
 package drive
 
 import (
+	"bytes"
+	"fmt"
+	"html"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
 )
 
-// WriteFile writes the provided file content to the output path.
+const redirectPageTemplate = `<!DOCTYPE html>
+<html lang="en">
+<meta charset="utf-8">
+<title>Redirecting&hellip;</title>
+<link rel="canonical" href="%[1]s">
+<meta http-equiv="refresh" content="0; url=%[1]s">
+<meta name="robots" content="noindex">
+<a href="%[1]s">Click here if you are not redirected.</a>
+</html>
+`
+
+// imageExtensions maps the MIME types of supported images to file extensions.
+var imageExtensions = map[string]string{
+	"image/avif":    ".avif",
+	"image/bmp":     ".bmp",
+	"image/gif":     ".gif",
+	"image/jpeg":    ".jpg",
+	"image/png":     ".png",
+	"image/svg+xml": ".svg",
+	"image/webp":    ".webp",
+	"image/x-icon":  ".ico",
+}
+
+// WriteFile writes the provided file content to the output path. Missing parent
+// directories are created.
 func WriteFile(outputPath string, fileContent []byte) error {
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0o750); err != nil {
+		return err
+	}
+
 	f, err := os.Create(outputPath)
 	if err != nil {
 		return err
@@ -53,3 +85,38 @@ func NormalizedAssetPath(
 
 	return sb.String()
 }
+
+// RedirectPage returns a minimal HTML page that redirects to the provided URL.
+func RedirectPage(url string) []byte {
+	return []byte(fmt.Sprintf(redirectPageTemplate, html.EscapeString(url)))
+}
+
+// DetectImageType returns the MIME type of the image based on its content, or
+// an empty string if the content is not a supported image.
+func DetectImageType(content []byte) string {
+	mimeType := http.DetectContentType(content)
+	if _, ok := imageExtensions[mimeType]; ok {
+		return mimeType
+	}
+
+	// SVG images are XML documents, which are not recognized as images.
+	if strings.HasPrefix(mimeType, "text/xml") ||
+		strings.HasPrefix(mimeType, "text/plain") {
+		if bytes.Contains(content[:min(len(content), 1024)], []byte("<svg")) {
+			return "image/svg+xml"
+		}
+	}
+
+	return ""
+}
+
+// ImageFileName returns the file name with the extension matching the type of
+// the image, so `image1.png` containing a JPEG image becomes `image1.jpg`.
+func ImageFileName(name string, mimeType string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	imageExt := imageExtensions[mimeType]
+	if ext == imageExt || (ext == ".jpeg" && imageExt == ".jpg") {
+		return name
+	}
+	return strings.TrimSuffix(name, filepath.Ext(name)) + imageExt
+}
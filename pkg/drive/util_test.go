@@ -0,0 +1,74 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package drive
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDetectImageType(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"png", "\x89PNG\r\n\x1a\nimage data", "image/png"},
+		{"jpeg", "\xff\xd8\xff\xe0\x00\x10JFIF\x00", "image/jpeg"},
+		{"gif", "GIF89a\x01\x00\x01\x00", "image/gif"},
+		{"webp", "RIFF\x24\x00\x00\x00WEBPVP8 ", "image/webp"},
+		{"svg", `<svg xmlns="http://www.w3.org/2000/svg"></svg>`, "image/svg+xml"},
+		{"svg with prolog", `<?xml version="1.0"?>` + "\n" +
+			`<svg xmlns="http://www.w3.org/2000/svg"></svg>`, "image/svg+xml"},
+		// Only the beginning of the content is looked at.
+		{"svg too far", strings.Repeat(" ", 1024) + "<svg></svg>", ""},
+		{"xml", `<?xml version="1.0"?><feed></feed>`, ""},
+		{"html", "<html><body></body></html>", ""},
+		{"text", "not an image", ""},
+		{"empty", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectImageType([]byte(tt.content)); got != tt.want {
+				t.Errorf("DetectImageType(%q) = %q, want %q", tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImageFileName(t *testing.T) {
+	tests := []struct {
+		name     string
+		mimeType string
+		want     string
+	}{
+		{"image1.png", "image/png", "image1.png"},
+		{"image1.png", "image/jpeg", "image1.jpg"},
+		{"image1.jpeg", "image/jpeg", "image1.jpeg"},
+		{"image1.JPG", "image/jpeg", "image1.JPG"},
+		{"image1.jpg", "image/gif", "image1.gif"},
+		{"image1.png", "image/webp", "image1.webp"},
+		{"image1.png", "image/svg+xml", "image1.svg"},
+		{"images/image1.png", "image/gif", "images/image1.gif"},
+		// Names in the archive may have no extension.
+		{"image1", "image/png", "image1.png"},
+		{"images/image1", "image/svg+xml", "images/image1.svg"},
+	}
+	for _, tt := range tests {
+		if got := ImageFileName(tt.name, tt.mimeType); got != tt.want {
+			t.Errorf("ImageFileName(%q, %q) = %q, want %q", tt.name, tt.mimeType, got, tt.want)
+		}
+	}
+}
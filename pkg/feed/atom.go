@@ -0,0 +1,106 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package feed
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+const atomNamespace = "http://www.w3.org/2005/Atom"
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"feed"`
+	Xmlns   string      `xml:"xmlns,attr"`
+	Id      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  atomPerson  `xml:"author"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	Id         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Link       atomLink       `xml:"link"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Categories []atomCategory `xml:"category"`
+	Summary    *atomText      `xml:"summary"`
+	Content    *atomText      `xml:"content"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Text string `xml:",chardata"`
+}
+
+// Atom returns the Atom feed, to be served from the root of the site as
+// AtomFileName.
+func (f *Feed) Atom() ([]byte, error) {
+	selfUrl, err := f.feedUrl(AtomFileName)
+	if err != nil {
+		return nil, err
+	}
+
+	feed := atomFeed{
+		Xmlns: atomNamespace,
+		// The site URL doesn't change, unlike the feed URL it's not tied to
+		// the format.
+		Id:      f.SiteUrl,
+		Title:   f.Title,
+		Updated: f.updated().Format(time.RFC3339),
+		Author:  atomPerson{Name: f.Author},
+		Links: []atomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: selfUrl},
+			{Rel: "alternate", Type: "text/html", Href: f.SiteUrl},
+		},
+	}
+	for _, entry := range f.Entries {
+		atomEntry := atomEntry{
+			Id:        entry.Id,
+			Title:     entry.Title,
+			Link:      atomLink{Rel: "alternate", Type: "text/html", Href: entry.Url},
+			Published: entry.Published.Format(time.RFC3339),
+			Updated:   entry.Updated.Format(time.RFC3339),
+		}
+		for _, category := range entry.Categories {
+			atomEntry.Categories = append(atomEntry.Categories, atomCategory{category})
+		}
+		if entry.Summary != "" {
+			atomEntry.Summary = &atomText{Type: "text", Text: entry.Summary}
+		}
+		if entry.Content != "" {
+			atomEntry.Content = &atomText{Type: "html", Text: entry.Content}
+		}
+		feed.Entries = append(feed.Entries, atomEntry)
+	}
+	return marshal(feed)
+}
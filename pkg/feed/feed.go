@@ -0,0 +1,113 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package feed writes the Atom (RFC 4287) and RSS 2.0 feeds of the posts.
+package feed
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+const (
+	ExcerptContent = "excerpt"
+	FullContent    = "full"
+)
+
+const (
+	AtomFileName = "feed.xml"
+	RssFileName  = "rss.xml"
+)
+
+// FeedOptions control the feeds.
+type FeedOptions struct {
+	FeedOutputPath string `arg:"--feed-output,env:DOCBLOG_FEED_OUTPUT" help:"directory to write the Atom (feed.xml) and RSS (rss.xml) feeds to, requires --site-url"`
+	FeedLimit      int    `arg:"--feed-limit,env:DOCBLOG_FEED_LIMIT" default:"20" help:"maximum number of the latest posts in the feeds, zero for all"`
+	FeedContent    string `arg:"--feed-content,env:DOCBLOG_FEED_CONTENT" default:"excerpt" help:"content of the feed entries: excerpt (the description) or full (the whole post)"`
+	FeedTitle      string `arg:"--feed-title,env:DOCBLOG_FEED_TITLE" help:"title of the feeds, defaults to the host of the site"`
+	FeedAuthor     string `arg:"--feed-author,env:DOCBLOG_FEED_AUTHOR" help:"author of the posts, defaults to the title of the feeds"`
+}
+
+// Feed is a list of posts, the latest first.
+type Feed struct {
+	Title  string
+	Author string
+	// SiteUrl is the absolute URL of the site, the feeds are expected to be
+	// served from its root.
+	SiteUrl string
+	Entries []*Entry
+}
+
+// Entry is a single post of the feed.
+type Entry struct {
+	// Id identifies the post across changes of its URL, see TagUri.
+	Id        string
+	Title     string
+	Url       string
+	Published time.Time
+	Updated   time.Time
+	// Summary is plain text, Content is HTML. Either may be empty.
+	Summary    string
+	Content    string
+	Categories []string
+}
+
+// TagUri returns a tag URI (RFC 4151) identifying the post of the site, e.g.
+// "tag:example.com,2024-05-01:1a2b3c". Unlike the URL of the post, it stays
+// the same when the post is renamed, as long as the date is fixed too, e.g.
+// the first time the post was published.
+func TagUri(siteUrl string, published time.Time, postId string) (string, error) {
+	u, err := url.Parse(siteUrl)
+	if err != nil {
+		return "", fmt.Errorf("invalid site URL: %v", err)
+	}
+	return fmt.Sprintf("tag:%s,%s:%s",
+		u.Hostname(), published.UTC().Format(time.DateOnly), postId), nil
+}
+
+// updated returns the time of the latest update of the entries, so that the
+// feeds don't change from run to run. It's the current time without entries,
+// as the time is required.
+func (f *Feed) updated() time.Time {
+	var updated time.Time
+	for _, entry := range f.Entries {
+		if entry.Updated.After(updated) {
+			updated = entry.Updated
+		}
+	}
+	if updated.IsZero() {
+		return time.Now().UTC().Truncate(time.Second)
+	}
+	return updated
+}
+
+// feedUrl returns the URL of the feed file.
+func (f *Feed) feedUrl(fileName string) (string, error) {
+	u, err := url.Parse(f.SiteUrl)
+	if err != nil {
+		return "", fmt.Errorf("invalid site URL: %v", err)
+	}
+	return u.JoinPath(fileName).String(), nil
+}
+
+// marshal serializes the document with the XML declaration.
+func marshal(v any) ([]byte, error) {
+	content, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]byte(xml.Header), content...), '\n'), nil
+}
@@ -0,0 +1,80 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package feed
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTagUri(t *testing.T) {
+	published := time.Date(2024, 5, 1, 23, 0, 0, 0, time.FixedZone("UTC-2", -2*60*60))
+	got, err := TagUri("https://example.com:8080/blog/", published, "1a2b3c")
+	if err != nil {
+		t.Fatalf("TagUri() failed: %v", err)
+	}
+	if want := "tag:example.com,2024-05-02:1a2b3c"; got != want {
+		t.Errorf("TagUri() = %q, want %q", got, want)
+	}
+}
+
+func TestFeedUpdated(t *testing.T) {
+	published := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	f := &Feed{
+		Title:   "Blog",
+		Author:  "Author",
+		SiteUrl: "https://example.com",
+		Entries: []*Entry{
+			{Id: "tag:example.com,2024-05-01:a", Title: "A", Url: "https://example.com/a",
+				Published: published, Updated: published.Add(time.Hour)},
+			{Id: "tag:example.com,2024-05-01:b", Title: "B", Url: "https://example.com/b",
+				Published: published, Updated: published},
+		},
+	}
+	atom, err := f.Atom()
+	if err != nil {
+		t.Fatalf("Atom() failed: %v", err)
+	}
+	if want := "<updated>2024-05-01T11:00:00Z</updated>\n  <author>"; !strings.Contains(string(atom), want) {
+		t.Errorf("Atom() = %s, want the latest update of the entries", atom)
+	}
+
+	// Feeds without entries still need the time.
+	f.Entries = nil
+	before := time.Now().Add(-time.Second)
+	atom, err = f.Atom()
+	if err != nil {
+		t.Fatalf("Atom() failed: %v", err)
+	}
+	var parsed struct {
+		Updated time.Time `xml:"updated"`
+	}
+	if err := xml.Unmarshal(atom, &parsed); err != nil {
+		t.Fatalf("failed to parse Atom feed: %v", err)
+	}
+	if parsed.Updated.Before(before) {
+		t.Errorf("updated = %v, want the current time", parsed.Updated)
+	}
+
+	rss, err := f.Rss()
+	if err != nil {
+		t.Fatalf("Rss() failed: %v", err)
+	}
+	if !strings.Contains(string(rss), "<lastBuildDate>") {
+		t.Errorf("Rss() = %s, want lastBuildDate", rss)
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package feed
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+const contentNamespace = "http://purl.org/rss/1.0/modules/content/"
+
+type rssFeed struct {
+	XMLName      xml.Name   `xml:"rss"`
+	Version      string     `xml:"version,attr"`
+	XmlnsAtom    string     `xml:"xmlns:atom,attr"`
+	XmlnsContent string     `xml:"xmlns:content,attr"`
+	Channel      rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	AtomLink      atomLink  `xml:"atom:link"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title          string   `xml:"title"`
+	Link           string   `xml:"link"`
+	Guid           rssGuid  `xml:"guid"`
+	PubDate        string   `xml:"pubDate"`
+	Categories     []string `xml:"category"`
+	Description    string   `xml:"description,omitempty"`
+	ContentEncoded string   `xml:"content:encoded,omitempty"`
+}
+
+type rssGuid struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Id          string `xml:",chardata"`
+}
+
+// Rss returns the RSS 2.0 feed, to be served from the root of the site as
+// RssFileName. The whole post is in content:encoded, as the description is
+// commonly shown as the excerpt.
+func (f *Feed) Rss() ([]byte, error) {
+	selfUrl, err := f.feedUrl(RssFileName)
+	if err != nil {
+		return nil, err
+	}
+
+	channel := rssChannel{
+		Title: f.Title,
+		Link:  f.SiteUrl,
+		// The description is required.
+		Description: f.Title,
+		AtomLink: atomLink{
+			Rel: "self", Type: "application/rss+xml", Href: selfUrl},
+		LastBuildDate: f.updated().Format(time.RFC1123Z),
+	}
+	for _, entry := range f.Entries {
+		channel.Items = append(channel.Items, rssItem{
+			Title:          entry.Title,
+			Link:           entry.Url,
+			Guid:           rssGuid{Id: entry.Id},
+			PubDate:        entry.Published.Format(time.RFC1123Z),
+			Categories:     entry.Categories,
+			Description:    entry.Summary,
+			ContentEncoded: entry.Content,
+		})
+	}
+	return marshal(rssFeed{
+		Version:      "2.0",
+		XmlnsAtom:    atomNamespace,
+		XmlnsContent: contentNamespace,
+		Channel:      channel,
+	})
+}
@@ -0,0 +1,199 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/HugoSmits86/nativewebp"
+	"golang.org/x/image/draw"
+
+	// Registered to read dimensions of the images that are not optimized.
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/webp"
+)
+
+const WebpMimeType = "image/webp"
+
+type ImageOptions struct {
+	OptimizeImages bool  `arg:"--optimize-images,env:DOCBLOG_OPTIMIZE_IMAGES" help:"resize and recompress PNG and JPEG images"`
+	ImageWidths    []int `arg:"--image-widths,env:DOCBLOG_IMAGE_WIDTHS" help:"widths of the resized image variants, the largest one is the maximum width"`
+	ImageQuality   int   `arg:"--image-quality,env:DOCBLOG_IMAGE_QUALITY" default:"85" help:"quality of the recompressed JPEG images, from 1 to 100"`
+	ImageWebp      bool  `arg:"--image-webp,env:DOCBLOG_IMAGE_WEBP" help:"write lossless WebP variants of the optimized images"`
+}
+
+// DefaultImageWidths are the widths of the image variants if none are
+// configured.
+var DefaultImageWidths = []int{480, 960, 1600}
+
+// Image is an optimized image along with its variants.
+type Image struct {
+	// Width and Height are the dimensions of the main image.
+	Width  int
+	Height int
+	// Content is the main image, in its original format.
+	Content []byte
+	// Variants are the smaller versions of the image in the original format,
+	// along with the WebP versions of all the sizes.
+	Variants []*Variant
+}
+
+// Variant is a resized or converted version of the image.
+type Variant struct {
+	// Name is the file name of the variant, derived from the original one.
+	Name     string
+	MimeType string
+	Width    int
+	Content  []byte
+}
+
+// Optimize downscales the image to the maximum configured width, recompresses
+// it and creates its smaller variants. Images other than PNG and JPEG are only
+// inspected to find their dimensions.
+func Optimize(
+	name string,
+	mimeType string,
+	content []byte,
+	opts ImageOptions,
+) (*Image, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		// E.g. SVG images can't be decoded, but they don't have to be.
+		return &Image{Content: content}, nil
+	}
+
+	result := &Image{Width: config.Width, Height: config.Height, Content: content}
+	if mimeType != "image/png" && mimeType != "image/jpeg" {
+		return result, nil
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %v", name, err)
+	}
+
+	widths := opts.ImageWidths
+	if len(widths) == 0 {
+		widths = DefaultImageWidths
+	}
+	widths = slices.Clone(widths)
+	slices.Sort(widths)
+
+	main := src
+	if maxWidth := widths[len(widths)-1]; config.Width > maxWidth {
+		main = resize(src, maxWidth)
+	}
+
+	encoded, err := encode(main, mimeType, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s: %v", name, err)
+	}
+	// Recompressing may produce larger files, e.g. for already optimized PNG
+	// images. The original is kept then, unless it had to be resized.
+	if main != src || len(encoded) < len(content) {
+		result.Content = encoded
+	}
+	result.Width = main.Bounds().Dx()
+	result.Height = main.Bounds().Dy()
+
+	sizes := []image.Image{main}
+	for _, width := range widths {
+		if width < result.Width {
+			resized := resize(src, width)
+			resizedContent, err := encode(resized, mimeType, opts)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode %s: %v", name, err)
+			}
+
+			result.Variants = append(result.Variants, &Variant{
+				Name:     VariantName(name, width, filepath.Ext(name)),
+				MimeType: mimeType,
+				Width:    width,
+				Content:  resizedContent,
+			})
+			sizes = append(sizes, resized)
+		}
+	}
+
+	if opts.ImageWebp {
+		for _, size := range sizes {
+			webpContent, err := encode(size, WebpMimeType, opts)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode %s: %v", name, err)
+			}
+
+			width := size.Bounds().Dx()
+			webpName := VariantName(name, width, ".webp")
+			if size == main {
+				webpName = strings.TrimSuffix(name, filepath.Ext(name)) + ".webp"
+			}
+			result.Variants = append(result.Variants, &Variant{
+				Name:     webpName,
+				MimeType: WebpMimeType,
+				Width:    width,
+				Content:  webpContent,
+			})
+		}
+	}
+
+	return result, nil
+}
+
+// VariantName returns the file name of the image variant with the provided
+// width, e.g. image1-480w.png.
+func VariantName(name string, width int, ext string) string {
+	return fmt.Sprintf("%s-%dw%s",
+		strings.TrimSuffix(name, filepath.Ext(name)), width, ext)
+}
+
+// resize scales the image down to the provided width, keeping the aspect
+// ratio.
+func resize(src image.Image, width int) image.Image {
+	bounds := src.Bounds()
+	height := max(1, bounds.Dy()*width/bounds.Dx())
+
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Src, nil)
+	return dst
+}
+
+func encode(img image.Image, mimeType string, opts ImageOptions) ([]byte, error) {
+	var b bytes.Buffer
+	var err error
+
+	switch mimeType {
+	case "image/png":
+		encoder := png.Encoder{CompressionLevel: png.BestCompression}
+		err = encoder.Encode(&b, img)
+	case "image/jpeg":
+		err = jpeg.Encode(&b, img, &jpeg.Options{Quality: opts.ImageQuality})
+	case "image/gif":
+		err = gif.Encode(&b, img, nil)
+	case WebpMimeType:
+		err = nativewebp.Encode(&b, img, nil)
+	default:
+		err = fmt.Errorf("unsupported image type: %s", mimeType)
+	}
+
+	return b.Bytes(), err
+}
@@ -0,0 +1,241 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// testImage returns a gradient, so that it doesn't compress to nothing.
+func testImage(width, height int) image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			img.Set(x, y, color.NRGBA{uint8(x), uint8(y), uint8(x + y), 255})
+		}
+	}
+	return img
+}
+
+func encodeTestImage(t *testing.T, mimeType string, img image.Image) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	var err error
+	switch mimeType {
+	case "image/png":
+		err = png.Encode(&b, img)
+	case "image/jpeg":
+		err = jpeg.Encode(&b, img, &jpeg.Options{Quality: 100})
+	case "image/gif":
+		err = gif.Encode(&b, img, nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// describeVariant describes the variant by its name, type and dimensions.
+func describeVariant(v *Variant) string {
+	config, _, err := image.DecodeConfig(bytes.NewReader(v.Content))
+	if err != nil {
+		return fmt.Sprintf("%s %s %dw: %v", v.Name, v.MimeType, v.Width, err)
+	}
+	return fmt.Sprintf("%s %s %dx%d", v.Name, v.MimeType, config.Width, config.Height)
+}
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		name     string
+		mimeType string
+		width    int
+		height   int
+		opts     ImageOptions
+		// wantWidth and wantHeight are the dimensions of the main image.
+		wantWidth    int
+		wantHeight   int
+		wantVariants []string
+	}{
+		{
+			name:     "image1.png",
+			mimeType: "image/png",
+			width:    1000, height: 500,
+			opts:      ImageOptions{ImageWidths: []int{800, 200, 400}},
+			wantWidth: 800, wantHeight: 400,
+			wantVariants: []string{
+				"image1-200w.png image/png 200x100",
+				"image1-400w.png image/png 400x200",
+			},
+		},
+		{
+			name:     "image2.jpg",
+			mimeType: "image/jpeg",
+			width:    600, height: 300,
+			opts:      ImageOptions{ImageWidths: []int{200, 800}, ImageQuality: 85},
+			wantWidth: 600, wantHeight: 300,
+			wantVariants: []string{"image2-200w.jpg image/jpeg 200x100"},
+		},
+		{
+			name:     "image3.png",
+			mimeType: "image/png",
+			width:    100, height: 50,
+			opts:      ImageOptions{ImageWidths: []int{200, 400}},
+			wantWidth: 100, wantHeight: 50,
+		},
+		{
+			// The height is kept at least one pixel.
+			name:     "image4.png",
+			mimeType: "image/png",
+			width:    1000, height: 2,
+			opts:      ImageOptions{ImageWidths: []int{100}},
+			wantWidth: 100, wantHeight: 1,
+		},
+		{
+			name:     "image5.png",
+			mimeType: "image/png",
+			width:    500, height: 250,
+			opts:      ImageOptions{ImageWidths: []int{100, 400}, ImageWebp: true},
+			wantWidth: 400, wantHeight: 200,
+			wantVariants: []string{
+				"image5-100w.png image/png 100x50",
+				"image5.webp image/webp 400x200",
+				"image5-100w.webp image/webp 100x50",
+			},
+		},
+		{
+			name:     "image6.png",
+			mimeType: "image/png",
+			width:    2000, height: 1000,
+			wantWidth: 1600, wantHeight: 800,
+			wantVariants: []string{
+				"image6-480w.png image/png 480x240",
+				"image6-960w.png image/png 960x480",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := encodeTestImage(t, tt.mimeType, testImage(tt.width, tt.height))
+			img, err := Optimize(tt.name, tt.mimeType, content, tt.opts)
+			if err != nil {
+				t.Fatalf("Optimize() failed: %v", err)
+			}
+
+			if img.Width != tt.wantWidth || img.Height != tt.wantHeight {
+				t.Errorf("dimensions = %dx%d, want %dx%d",
+					img.Width, img.Height, tt.wantWidth, tt.wantHeight)
+			}
+			config, format, err := image.DecodeConfig(bytes.NewReader(img.Content))
+			if err != nil {
+				t.Fatalf("DecodeConfig() failed: %v", err)
+			}
+			if "image/"+format != tt.mimeType ||
+				config.Width != tt.wantWidth || config.Height != tt.wantHeight {
+				t.Errorf("main image is %s %dx%d, want %s %dx%d", format,
+					config.Width, config.Height, tt.mimeType, tt.wantWidth, tt.wantHeight)
+			}
+
+			var variants []string
+			for _, variant := range img.Variants {
+				variants = append(variants, describeVariant(variant))
+			}
+			if fmt.Sprint(variants) != fmt.Sprint(tt.wantVariants) {
+				t.Errorf("variants = %q, want %q", variants, tt.wantVariants)
+			}
+		})
+	}
+}
+
+func TestOptimizePassThrough(t *testing.T) {
+	gifContent := encodeTestImage(t, "image/gif", testImage(2000, 10))
+	svgContent := []byte(`<svg xmlns="http://www.w3.org/2000/svg" width="10" height="10"></svg>`)
+	tests := []struct {
+		name       string
+		mimeType   string
+		content    []byte
+		wantWidth  int
+		wantHeight int
+	}{
+		// Only the dimensions of GIF images are read, even when too wide.
+		{"image1.gif", "image/gif", gifContent, 2000, 10},
+		// SVG images can't be decoded.
+		{"image2.svg", "image/svg+xml", svgContent, 0, 0},
+		{"image3.png", "image/png", []byte("\x89PNG\r\n\x1a\nnot an image"), 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := ImageOptions{ImageWidths: []int{100}, ImageWebp: true}
+			img, err := Optimize(tt.name, tt.mimeType, tt.content, opts)
+			if err != nil {
+				t.Fatalf("Optimize() failed: %v", err)
+			}
+			if !bytes.Equal(img.Content, tt.content) {
+				t.Errorf("content changed, want it passed through")
+			}
+			if img.Width != tt.wantWidth || img.Height != tt.wantHeight {
+				t.Errorf("dimensions = %dx%d, want %dx%d",
+					img.Width, img.Height, tt.wantWidth, tt.wantHeight)
+			}
+			if len(img.Variants) != 0 {
+				t.Errorf("variants = %v, want none", img.Variants)
+			}
+		})
+	}
+}
+
+func TestOptimizeKeepsSmallerOriginal(t *testing.T) {
+	// A PNG image of a single color compresses well already, recompressing
+	// it at the best level doesn't make it smaller.
+	var b bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: png.BestCompression}
+	if err := encoder.Encode(&b, image.NewGray(image.Rect(0, 0, 100, 100))); err != nil {
+		t.Fatal(err)
+	}
+	img, err := Optimize("image1.png", "image/png", b.Bytes(), ImageOptions{ImageWidths: []int{200}})
+	if err != nil {
+		t.Fatalf("Optimize() failed: %v", err)
+	}
+	if !bytes.Equal(img.Content, b.Bytes()) {
+		t.Errorf("content = %d bytes, want the original %d bytes", len(img.Content), b.Len())
+	}
+}
+
+func TestVariantName(t *testing.T) {
+	tests := []struct {
+		name  string
+		width int
+		ext   string
+		want  string
+	}{
+		{"image1.png", 480, ".png", "image1-480w.png"},
+		{"image1.png", 480, ".webp", "image1-480w.webp"},
+		{"image1.jpeg", 1600, ".jpeg", "image1-1600w.jpeg"},
+		{"my.photo.jpg", 960, ".jpg", "my.photo-960w.jpg"},
+		{"image1", 480, ".webp", "image1-480w.webp"},
+	}
+	for _, tt := range tests {
+		if got := VariantName(tt.name, tt.width, tt.ext); got != tt.want {
+			t.Errorf("VariantName(%q, %d, %q) = %q, want %q",
+				tt.name, tt.width, tt.ext, got, tt.want)
+		}
+	}
+}
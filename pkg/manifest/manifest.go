@@ -0,0 +1,246 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Manifest keeps track of the documents processed by previous docblog runs,
+// so that unchanged documents don't have to be exported again.
+type Manifest struct {
+	Documents map[string]*Entry `json:"documents"`
+	// ChangesPageToken is the cursor of the Google Drive changes that haven't
+	// been processed yet, used by the watch mode.
+	ChangesPageToken string `json:"changes_page_token,omitempty"`
+	// Channels are the notification channels opened by the webhook mode, so
+	// that the ones left open by an interrupted run can be stopped.
+	Channels []*Channel `json:"channels,omitempty"`
+
+	path string
+	mu   sync.Mutex
+}
+
+// Entry describes the output of a single processed document.
+type Entry struct {
+	ModifiedTime time.Time `json:"modified_time"`
+	MetadataHash string    `json:"metadata_hash"`
+	OptionsHash  string    `json:"options_hash,omitempty"`
+	ContentHash  string    `json:"content_hash"`
+	Slug         string    `json:"slug,omitempty"`
+	Post         string    `json:"post"`
+	Assets       []string  `json:"assets,omitempty"`
+	Redirects    []string  `json:"redirects,omitempty"`
+	// FeedId identifies the post in the feeds, it's kept once assigned so
+	// that editing the date doesn't make the post appear as a new one.
+	FeedId string `json:"feed_id,omitempty"`
+	// AltTextImages are the hashes of the images whose alt text was looked
+	// up in the alt text file, AltTextHash is the hash of their entries.
+	AltTextImages []string `json:"alt_text_images,omitempty"`
+	AltTextHash   string   `json:"alt_text_hash,omitempty"`
+}
+
+// Channel identifies an open notification channel of Google Drive.
+type Channel struct {
+	Id         string    `json:"id"`
+	ResourceId string    `json:"resource_id"`
+	Expiration time.Time `json:"expiration"`
+}
+
+// Load reads the manifest from the provided path. A missing file results in
+// an empty manifest.
+func Load(path string) (*Manifest, error) {
+	m := &Manifest{Documents: map[string]*Entry{}, path: path}
+
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(content, m); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %s: %v", path, err)
+	}
+	if m.Documents == nil {
+		m.Documents = map[string]*Entry{}
+	}
+	return m, nil
+}
+
+// Save writes the manifest back to the path it was loaded from.
+func (m *Manifest) Save() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	content, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if dir := filepath.Dir(m.path); dir != "." {
+		if err := os.MkdirAll(dir, 0o750); err != nil {
+			return err
+		}
+	}
+
+	// Write to a temporary file first so that an interrupted run doesn't
+	// leave a truncated manifest behind.
+	tmpPath := m.path + ".tmp"
+	if err := os.WriteFile(tmpPath, append(content, '\n'), 0o640); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, m.path)
+}
+
+// Get returns the entry for the provided document ID, if any.
+func (m *Manifest) Get(docId string) (*Entry, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.Documents[docId]
+	return entry, ok
+}
+
+// DocIds returns the IDs of all the documents in the manifest.
+func (m *Manifest) DocIds() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	docIds := make([]string, 0, len(m.Documents))
+	for docId := range m.Documents {
+		docIds = append(docIds, docId)
+	}
+	slices.Sort(docIds)
+	return docIds
+}
+
+// Set records the entry for the provided document ID.
+func (m *Manifest) Set(docId string, entry *Entry) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.Documents[docId] = entry
+}
+
+// Delete removes the entry for the provided document ID.
+func (m *Manifest) Delete(docId string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.Documents, docId)
+}
+
+// PageToken returns the cursor of the unprocessed changes, if any.
+func (m *Manifest) PageToken() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.ChangesPageToken
+}
+
+// SetPageToken records the cursor of the unprocessed changes.
+func (m *Manifest) SetPageToken(pageToken string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.ChangesPageToken = pageToken
+}
+
+// OpenChannels returns the recorded notification channels.
+func (m *Manifest) OpenChannels() []*Channel {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return slices.Clone(m.Channels)
+}
+
+// AddChannel records the opened notification channel.
+func (m *Manifest) AddChannel(channel *Channel) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.Channels = append(m.Channels, channel)
+}
+
+// RemoveChannel forgets the notification channel with the provided ID.
+func (m *Manifest) RemoveChannel(channelId string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.Channels = slices.DeleteFunc(m.Channels, func(channel *Channel) bool {
+		return channel.Id == channelId
+	})
+}
+
+// IsUpToDate reports whether the document with the provided ID was already
+// processed into the same post with the same Drive modification time, index
+// metadata, options and alt text, and whether all of its outputs still exist
+// on disk.
+func (m *Manifest) IsUpToDate(
+	docId string,
+	modifiedTime time.Time,
+	metadataHash string,
+	optionsHash string,
+	altTextHash string,
+	post string,
+) bool {
+	entry, ok := m.Get(docId)
+	if !ok {
+		return false
+	}
+
+	if !entry.ModifiedTime.Equal(modifiedTime) ||
+		entry.MetadataHash != metadataHash ||
+		entry.OptionsHash != optionsHash ||
+		entry.AltTextHash != altTextHash ||
+		entry.Post != post {
+		return false
+	}
+
+	for _, path := range entry.Outputs() {
+		if _, err := os.Stat(path); err != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Outputs returns all the files written for the document.
+func (e *Entry) Outputs() []string {
+	var outputs []string
+	if e.Post != "" {
+		outputs = append(outputs, e.Post)
+	}
+	outputs = append(outputs, e.Assets...)
+	return append(outputs, e.Redirects...)
+}
+
+// Hash returns a hex-encoded SHA-256 hash of the provided content.
+func Hash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,142 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/googleapis/gax-go/v2/apierror"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Policy controls how failed requests to the Google APIs are retried. The zero
+// value doesn't retry at all.
+type Policy struct {
+	RetryInitialInterval time.Duration `arg:"--retry-initial-interval,env:DOCBLOG_RETRY_INITIAL_INTERVAL" default:"1s" help:"delay before the first retry of a failed request"`
+	RetryMaxInterval     time.Duration `arg:"--retry-max-interval,env:DOCBLOG_RETRY_MAX_INTERVAL" default:"30s" help:"maximum delay between retries of a failed request"`
+	RetryMaxElapsed      time.Duration `arg:"--retry-max-elapsed,env:DOCBLOG_RETRY_MAX_ELAPSED" default:"2m" help:"maximum time spent retrying a failed request, 0 disables retries"`
+}
+
+// Validate returns an error if the intervals are not positive or the maximum
+// elapsed time is negative.
+func (p Policy) Validate() error {
+	if p.RetryInitialInterval <= 0 {
+		return fmt.Errorf("--retry-initial-interval must be positive: %v", p.RetryInitialInterval)
+	}
+	if p.RetryMaxInterval < p.RetryInitialInterval {
+		return fmt.Errorf("--retry-max-interval must be at least --retry-initial-interval: %v",
+			p.RetryMaxInterval)
+	}
+	if p.RetryMaxElapsed < 0 {
+		return fmt.Errorf("--retry-max-elapsed must not be negative: %v", p.RetryMaxElapsed)
+	}
+	return nil
+}
+
+// Do calls the function until it succeeds, returns an error that is not
+// transient or the maximum elapsed time is exceeded. Delays between the calls
+// grow exponentially, unless the server asks for a specific one.
+func (p Policy) Do(ctx context.Context, f func() error) error {
+	start := time.Now()
+	interval := p.RetryInitialInterval
+
+	for {
+		err := f()
+		if err == nil {
+			return nil
+		}
+
+		retryAfter, ok := retryable(err)
+		if !ok {
+			return err
+		}
+
+		delay := retryAfter
+		if delay == 0 {
+			// Jitter spreads out the retries of concurrent requests, which
+			// likely failed for the same reason.
+			delay = interval/2 + rand.N(max(interval, 0)+1)
+			interval = min(2*interval, p.RetryMaxInterval)
+		}
+		if time.Since(start)+delay > p.RetryMaxElapsed {
+			return err
+		}
+
+		log.Printf("Retrying in %v: %v\n", delay.Round(time.Millisecond), err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
+
+// retryable reports whether the error is transient, i.e. the request was
+// rate limited or the server failed. It also returns the delay requested by
+// the server, if any.
+func retryable(err error) (time.Duration, bool) {
+	var googleErr *googleapi.Error
+	if errors.As(err, &googleErr) {
+		if googleErr.Code == http.StatusTooManyRequests ||
+			googleErr.Code >= http.StatusInternalServerError {
+			return parseRetryAfter(googleErr.Header.Get("Retry-After")), true
+		}
+		return 0, false
+	}
+
+	if s, ok := status.FromError(err); ok {
+		switch s.Code() {
+		case codes.ResourceExhausted, codes.Unavailable, codes.Internal,
+			codes.DeadlineExceeded, codes.Aborted:
+			var apiErr *apierror.APIError
+			if errors.As(err, &apiErr) && apiErr.Details().RetryInfo != nil {
+				return apiErr.Details().RetryInfo.GetRetryDelay().AsDuration(), true
+			}
+			return 0, true
+		}
+		return 0, false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return 0, true
+	}
+	return 0, false
+}
+
+// parseRetryAfter parses the value of the Retry-After header, which is either
+// a number of seconds or a date.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(0, time.Until(date))
+	}
+	return 0
+}
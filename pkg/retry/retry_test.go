@@ -0,0 +1,219 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package retry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+func googleError(code int, retryAfter string) error {
+	err := &googleapi.Error{Code: code, Header: http.Header{}}
+	if retryAfter != "" {
+		err.Header.Set("Retry-After", retryAfter)
+	}
+	return err
+}
+
+func TestDo(t *testing.T) {
+	policy := Policy{
+		RetryInitialInterval: time.Millisecond,
+		RetryMaxInterval:     5 * time.Millisecond,
+		RetryMaxElapsed:      time.Second,
+	}
+	tests := []struct {
+		name      string
+		policy    Policy
+		errs      []error
+		wantCalls int
+		wantErr   bool
+	}{
+		{
+			name:      "success",
+			policy:    policy,
+			wantCalls: 1,
+		},
+		{
+			name:      "transient errors",
+			policy:    policy,
+			errs:      []error{googleError(503, ""), googleError(429, "")},
+			wantCalls: 3,
+		},
+		{
+			name:      "non-retryable error",
+			policy:    policy,
+			errs:      []error{googleError(404, ""), nil},
+			wantCalls: 1,
+			wantErr:   true,
+		},
+		{
+			name:      "other error",
+			policy:    policy,
+			errs:      []error{errors.New("failed"), nil},
+			wantCalls: 1,
+			wantErr:   true,
+		},
+		{
+			name:      "zero policy",
+			errs:      []error{googleError(503, ""), nil},
+			wantCalls: 1,
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int
+			err := tt.policy.Do(context.Background(), func() error {
+				calls++
+				if calls <= len(tt.errs) {
+					return tt.errs[calls-1]
+				}
+				return nil
+			})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Do() = %v, want error: %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("got %d calls, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestDoMaxElapsed(t *testing.T) {
+	policy := Policy{
+		RetryInitialInterval: 5 * time.Millisecond,
+		RetryMaxInterval:     20 * time.Millisecond,
+		RetryMaxElapsed:      100 * time.Millisecond,
+	}
+	start := time.Now()
+	var calls int
+	want := googleError(503, "")
+	err := policy.Do(context.Background(), func() error {
+		calls++
+		return want
+	})
+	if err != want {
+		t.Errorf("Do() = %v, want the last error", err)
+	}
+	if calls < 3 {
+		t.Errorf("got %d calls, want several retries", calls)
+	}
+	if elapsed := time.Since(start); elapsed > policy.RetryMaxElapsed {
+		t.Errorf("retried for %v, want at most %v", elapsed, policy.RetryMaxElapsed)
+	}
+}
+
+func TestDoRetryAfter(t *testing.T) {
+	policy := Policy{
+		RetryInitialInterval: time.Millisecond,
+		RetryMaxInterval:     time.Millisecond,
+		RetryMaxElapsed:      5 * time.Second,
+	}
+	start := time.Now()
+	var calls int
+	err := policy.Do(context.Background(), func() error {
+		calls++
+		if calls == 1 {
+			return googleError(429, "1")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Do() failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %v, want the requested 1s", elapsed)
+	}
+
+	// The requested delay exceeding the maximum elapsed time is not waited
+	// for.
+	policy.RetryMaxElapsed = 500 * time.Millisecond
+	calls = 0
+	err = policy.Do(context.Background(), func() error {
+		calls++
+		return googleError(429, "1")
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("Do() = %v after %d calls, want error after 1", err, calls)
+	}
+}
+
+func TestDoCancelled(t *testing.T) {
+	policy := Policy{
+		RetryInitialInterval: time.Hour,
+		RetryMaxInterval:     time.Hour,
+		RetryMaxElapsed:      24 * time.Hour,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := policy.Do(ctx, func() error {
+		return googleError(503, "")
+	})
+	if err == nil {
+		t.Errorf("Do() succeeded, want error")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"3", 3 * time.Second},
+		{"0", 0},
+		{"-1", 0},
+		{"soon", 0},
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.value); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+
+	date := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	if got := parseRetryAfter(date); got <= 0 || got > time.Minute {
+		t.Errorf("parseRetryAfter(%q) = %v, want up to a minute", date, got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  Policy
+		wantErr bool
+	}{
+		{"defaults", Policy{time.Second, 30 * time.Second, 2 * time.Minute}, false},
+		{"no retries", Policy{time.Second, 30 * time.Second, 0}, false},
+		{"zero initial interval", Policy{0, 30 * time.Second, 2 * time.Minute}, true},
+		{"negative initial interval", Policy{-time.Second, 30 * time.Second, 2 * time.Minute}, true},
+		{"max below initial interval", Policy{time.Second, time.Millisecond, 2 * time.Minute}, true},
+		{"negative max elapsed", Policy{time.Second, 30 * time.Second, -time.Minute}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.policy.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() = %v, want error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
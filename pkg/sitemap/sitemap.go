@@ -0,0 +1,157 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sitemap writes the sitemaps of the posts, see
+// https://www.sitemaps.org/protocol.html.
+package sitemap
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+const (
+	FileName       = "sitemap.xml"
+	RobotsFileName = "robots.txt"
+	// MaxUrls is the maximum number of URLs in a single sitemap, the URLs are
+	// split into several sitemaps listed by an index above that.
+	MaxUrls = 50000
+)
+
+const namespace = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+// SitemapOptions control the sitemap.
+type SitemapOptions struct {
+	SitemapOutputPath string `arg:"--sitemap-output,env:DOCBLOG_SITEMAP_OUTPUT" help:"directory to write sitemap.xml to, requires --site-url"`
+	Robots            bool   `arg:"--robots,env:DOCBLOG_ROBOTS" help:"write robots.txt referencing the sitemap along with it"`
+}
+
+// Url is a page of the site.
+type Url struct {
+	Loc string
+	// LastMod is the time the page was last modified, omitted if zero.
+	LastMod time.Time
+}
+
+type urlSet struct {
+	XMLName xml.Name `xml:"urlset"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Urls    []entry  `xml:"url"`
+}
+
+type sitemapIndex struct {
+	XMLName  xml.Name `xml:"sitemapindex"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Sitemaps []entry  `xml:"sitemap"`
+}
+
+type entry struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+// Files returns the sitemap files by their names, to be served from the root
+// of the site. It's a single FileName sitemap, unless there are more than
+// MaxUrls URLs. Then FileName is an index of the sitemaps named by
+// PartFileName.
+func Files(siteUrl string, urls []Url) (map[string][]byte, error) {
+	return files(siteUrl, urls, MaxUrls)
+}
+
+func files(siteUrl string, urls []Url, maxUrls int) (map[string][]byte, error) {
+	if len(urls) <= maxUrls {
+		content, err := marshal(urlSet{Xmlns: namespace, Urls: entries(urls)})
+		if err != nil {
+			return nil, err
+		}
+		return map[string][]byte{FileName: content}, nil
+	}
+
+	base, err := url.Parse(siteUrl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid site URL: %v", err)
+	}
+	files := map[string][]byte{}
+	index := sitemapIndex{Xmlns: namespace}
+	for i := 0; i*maxUrls < len(urls); i++ {
+		part := urls[i*maxUrls : min((i+1)*maxUrls, len(urls))]
+		content, err := marshal(urlSet{Xmlns: namespace, Urls: entries(part)})
+		if err != nil {
+			return nil, err
+		}
+		name := PartFileName(i + 1)
+		files[name] = content
+
+		var lastMod time.Time
+		for _, u := range part {
+			if u.LastMod.After(lastMod) {
+				lastMod = u.LastMod
+			}
+		}
+		index.Sitemaps = append(index.Sitemaps, entry{
+			Loc:     base.JoinPath(name).String(),
+			LastMod: formatTime(lastMod),
+		})
+	}
+
+	content, err := marshal(index)
+	if err != nil {
+		return nil, err
+	}
+	files[FileName] = content
+	return files, nil
+}
+
+// PartFileName returns the name of the n-th sitemap listed by the index,
+// starting from 1.
+func PartFileName(n int) string {
+	return fmt.Sprintf("sitemap-%d.xml", n)
+}
+
+// Robots returns robots.txt allowing all crawlers and referencing the sitemap.
+func Robots(siteUrl string) ([]byte, error) {
+	base, err := url.Parse(siteUrl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid site URL: %v", err)
+	}
+	return []byte(fmt.Sprintf("User-agent: *\nAllow: /\n\nSitemap: %s\n",
+		base.JoinPath(FileName))), nil
+}
+
+func entries(urls []Url) []entry {
+	entries := make([]entry, len(urls))
+	for i, u := range urls {
+		entries[i] = entry{Loc: u.Loc, LastMod: formatTime(u.LastMod)}
+	}
+	return entries
+}
+
+// formatTime formats the time in the W3C Datetime format, empty if zero.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// marshal serializes the document with the XML declaration.
+func marshal(v any) ([]byte, error) {
+	content, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]byte(xml.Header), content...), '\n'), nil
+}
@@ -0,0 +1,173 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sitemap
+
+import (
+	"encoding/xml"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+func testUrls(n int) []Url {
+	urls := make([]Url, n)
+	for i := range urls {
+		urls[i] = Url{
+			Loc:     fmt.Sprintf("https://example.com/posts/%d/", i+1),
+			LastMod: time.Date(2024, 5, i+1, 10, 0, 0, 0, time.UTC),
+		}
+	}
+	// Pages without a modification time have no lastmod.
+	urls[n-1].LastMod = time.Time{}
+	return urls
+}
+
+// fileNames returns the sorted names of the files.
+func fileNames(files map[string][]byte) []string {
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func parseUrlSet(t *testing.T, content []byte) []entry {
+	t.Helper()
+	var set urlSet
+	if err := xml.Unmarshal(content, &set); err != nil {
+		t.Fatalf("failed to parse sitemap %s: %v", content, err)
+	}
+	if set.XMLName.Space != namespace {
+		t.Errorf("namespace = %q, want %q", set.XMLName.Space, namespace)
+	}
+	return set.Urls
+}
+
+func TestFiles(t *testing.T) {
+	urls := testUrls(3)
+	files, err := Files("https://example.com", urls)
+	if err != nil {
+		t.Fatalf("Files() failed: %v", err)
+	}
+	if names := fileNames(files); !slices.Equal(names, []string{FileName}) {
+		t.Fatalf("files = %v, want only %s", names, FileName)
+	}
+
+	want := []entry{
+		{"https://example.com/posts/1/", "2024-05-01T10:00:00Z"},
+		{"https://example.com/posts/2/", "2024-05-02T10:00:00Z"},
+		{"https://example.com/posts/3/", ""},
+	}
+	if got := parseUrlSet(t, files[FileName]); !slices.Equal(got, want) {
+		t.Errorf("sitemap = %v, want %v", got, want)
+	}
+}
+
+func TestFilesIndex(t *testing.T) {
+	urls := testUrls(5)
+	files, err := files("https://example.com/blog/", urls, 2)
+	if err != nil {
+		t.Fatalf("files() failed: %v", err)
+	}
+
+	names := fileNames(files)
+	wantNames := []string{"sitemap-1.xml", "sitemap-2.xml", "sitemap-3.xml", FileName}
+	if !slices.Equal(names, wantNames) {
+		t.Fatalf("files = %v, want %v", names, wantNames)
+	}
+
+	var index sitemapIndex
+	if err := xml.Unmarshal(files[FileName], &index); err != nil {
+		t.Fatalf("failed to parse index %s: %v", files[FileName], err)
+	}
+	wantIndex := []entry{
+		{"https://example.com/blog/sitemap-1.xml", "2024-05-02T10:00:00Z"},
+		{"https://example.com/blog/sitemap-2.xml", "2024-05-04T10:00:00Z"},
+		// The only page has no modification time.
+		{"https://example.com/blog/sitemap-3.xml", ""},
+	}
+	if !slices.Equal(index.Sitemaps, wantIndex) {
+		t.Errorf("index = %v, want %v", index.Sitemaps, wantIndex)
+	}
+
+	var all []entry
+	for i, wantLen := range []int{2, 2, 1} {
+		part := parseUrlSet(t, files[PartFileName(i+1)])
+		if len(part) != wantLen {
+			t.Errorf("%s has %d URLs, want %d", PartFileName(i+1), len(part), wantLen)
+		}
+		all = append(all, part...)
+	}
+	if len(all) != len(urls) {
+		t.Fatalf("parts have %d URLs, want %d", len(all), len(urls))
+	}
+	for i, u := range urls {
+		if all[i].Loc != u.Loc {
+			t.Errorf("URL %d = %s, want %s", i, all[i].Loc, u.Loc)
+		}
+	}
+}
+
+func TestFilesLimit(t *testing.T) {
+	// Exactly the maximum number of URLs fits in a single sitemap.
+	files, err := files("https://example.com", testUrls(2), 2)
+	if err != nil {
+		t.Fatalf("files() failed: %v", err)
+	}
+	if len(files) != 1 || len(parseUrlSet(t, files[FileName])) != 2 {
+		t.Errorf("files = %v, want a single sitemap", fileNames(files))
+	}
+}
+
+func TestFilesEmpty(t *testing.T) {
+	files, err := Files("https://example.com", nil)
+	if err != nil {
+		t.Fatalf("Files() failed: %v", err)
+	}
+	if got := parseUrlSet(t, files[FileName]); len(got) != 0 {
+		t.Errorf("sitemap = %v, want no URLs", got)
+	}
+}
+
+func TestRobots(t *testing.T) {
+	tests := []struct {
+		siteUrl string
+		want    string
+	}{
+		{
+			siteUrl: "https://example.com",
+			want:    "User-agent: *\nAllow: /\n\nSitemap: https://example.com/sitemap.xml\n",
+		},
+		{
+			siteUrl: "https://example.com/blog/",
+			want:    "User-agent: *\nAllow: /\n\nSitemap: https://example.com/blog/sitemap.xml\n",
+		},
+	}
+	for _, tt := range tests {
+		got, err := Robots(tt.siteUrl)
+		if err != nil {
+			t.Fatalf("Robots(%q) failed: %v", tt.siteUrl, err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("Robots(%q) = %q, want %q", tt.siteUrl, got, tt.want)
+		}
+	}
+
+	if _, err := Robots("://invalid"); err == nil {
+		t.Errorf("Robots() of an invalid URL succeeded, want error")
+	}
+}